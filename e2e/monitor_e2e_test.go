@@ -170,3 +170,245 @@ func TestRun_DevicesFlow(t *testing.T) {
 	cancel()
 	waitForShutdown(t, errCh)
 }
+
+func TestRun_CheckNow(t *testing.T) {
+	_, cancel, errCh := startServer(t, 1)
+	defer cancel()
+
+	client := &http.Client{
+		Timeout: 15 * time.Second,
+	}
+	baseURL := "http://127.0.0.1:8080"
+
+	resp := waitForHealthReady(t, client, baseURL)
+	resp.Body.Close()
+
+	r, err := client.Post(baseURL+"/devices", "application/json",
+		strings.NewReader(`{"address":"127.0.0.1:1","check_method":"tcp_check","interval_sec":3600}`))
+	if err != nil {
+		t.Fatalf("POST /devices error: %v", err)
+	}
+	var dev struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&dev); err != nil {
+		t.Fatalf("decode device: %v", err)
+	}
+	r.Body.Close()
+
+	r, err = client.Post(baseURL+"/devices/"+dev.ID+"/check", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /devices/{id}/check error: %v", err)
+	}
+	var pending struct {
+		RequestID string `json:"request_id"`
+		Status    string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&pending); err != nil {
+		t.Fatalf("decode pending check: %v", err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusAccepted || pending.Status != "pending" || pending.RequestID == "" {
+		t.Fatalf("unexpected pending check: %d %+v", r.StatusCode, pending)
+	}
+
+	r, err = client.Post(baseURL+"/devices/"+dev.ID+"/check?wait=10", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /devices/{id}/check error: %v", err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(r.Body)
+		t.Fatalf("unexpected status from check: %d body=%s", r.StatusCode, string(b))
+	}
+
+	var h struct {
+		DeviceID  string `json:"device_id"`
+		Status    string `json:"status"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+		t.Fatalf("decode health: %v", err)
+	}
+	if h.DeviceID != dev.ID || h.Status != "DOWN" || h.RequestID == "" || h.RequestID == pending.RequestID {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+
+	cancel()
+	waitForShutdown(t, errCh)
+}
+
+func TestRun_AckAndSilence(t *testing.T) {
+	_, cancel, errCh := startServer(t, 1)
+	defer cancel()
+
+	client := &http.Client{
+		Timeout: 15 * time.Second,
+	}
+	baseURL := "http://127.0.0.1:8080"
+
+	resp := waitForHealthReady(t, client, baseURL)
+	resp.Body.Close()
+
+	r, err := client.Post(baseURL+"/devices", "application/json",
+		strings.NewReader(`{"address":"127.0.0.1:1","check_method":"tcp_check","interval_sec":3600,"labels":{"team":"e2e"}}`))
+	if err != nil {
+		t.Fatalf("POST /devices error: %v", err)
+	}
+	var dev struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&dev); err != nil {
+		t.Fatalf("decode device: %v", err)
+	}
+	r.Body.Close()
+
+	r, err = client.Post(baseURL+"/devices/"+dev.ID+"/check?wait=10", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /devices/{id}/check error: %v", err)
+	}
+	r.Body.Close()
+
+	// the result reaches the alert state right after the check returns
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		r, err = client.Post(baseURL+"/devices/"+dev.ID+"/ack", "application/json",
+			strings.NewReader(`{"author":"e2e","comment":"known outage"}`))
+		if err != nil {
+			t.Fatalf("POST /devices/{id}/ack error: %v", err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusConflict || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if r.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status from ack: %d", r.StatusCode)
+	}
+
+	ends := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	r, err = client.Post(baseURL+"/silences", "application/json",
+		strings.NewReader(`{"labels":{"team":"e2e"},"ends_at":"`+ends+`","comment":"maintenance"}`))
+	if err != nil {
+		t.Fatalf("POST /silences error: %v", err)
+	}
+	var sil struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&sil); err != nil || r.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected silence response: %d, %v", r.StatusCode, err)
+	}
+	r.Body.Close()
+
+	r, err = client.Get(baseURL + "/devices/" + dev.ID)
+	if err != nil {
+		t.Fatalf("GET /devices/{id} error: %v", err)
+	}
+	var st struct {
+		Alert struct {
+			Problem      bool `json:"problem"`
+			Acknowledged *struct {
+				Comment string `json:"comment"`
+			} `json:"acknowledged"`
+			Silenced   bool     `json:"silenced"`
+			SilencedBy []string `json:"silenced_by"`
+		} `json:"alert"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&st); err != nil {
+		t.Fatalf("decode device status: %v", err)
+	}
+	r.Body.Close()
+
+	a := st.Alert
+	if !a.Problem || a.Acknowledged == nil || a.Acknowledged.Comment != "known outage" ||
+		!a.Silenced || len(a.SilencedBy) != 1 || a.SilencedBy[0] != sil.ID {
+		t.Fatalf("unexpected alert status: %+v", a)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, baseURL+"/silences/"+sil.ID, nil)
+	r, err = client.Do(req)
+	if err != nil || r.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE /silences/{id}: %v", err)
+	}
+	r.Body.Close()
+
+	cancel()
+	waitForShutdown(t, errCh)
+}
+
+func TestRun_DeviceMaintenance(t *testing.T) {
+	_, cancel, errCh := startServer(t, 1)
+	defer cancel()
+
+	client := &http.Client{
+		Timeout: 15 * time.Second,
+	}
+	baseURL := "http://127.0.0.1:8080"
+
+	resp := waitForHealthReady(t, client, baseURL)
+	resp.Body.Close()
+
+	r, err := client.Post(baseURL+"/devices", "application/json",
+		strings.NewReader(`{"address":"127.0.0.1:1","check_method":"tcp_check","interval_sec":3600}`))
+	if err != nil {
+		t.Fatalf("POST /devices error: %v", err)
+	}
+	var dev struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&dev); err != nil {
+		t.Fatalf("decode device: %v", err)
+	}
+	r.Body.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	stamp := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+
+	// Two overlapping windows cover 90 minutes of the last three hours.
+	var ids []string
+	for _, span := range [][2]time.Duration{{-2 * time.Hour, -time.Hour}, {-90 * time.Minute, -30 * time.Minute}} {
+		r, err = client.Post(baseURL+"/maintenance", "application/json",
+			strings.NewReader(`{"device_ids":["`+dev.ID+`"],"starts_at":"`+stamp(span[0])+`","ends_at":"`+stamp(span[1])+`"}`))
+		if err != nil {
+			t.Fatalf("POST /maintenance error: %v", err)
+		}
+		var win struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&win); err != nil || r.StatusCode != http.StatusCreated {
+			t.Fatalf("unexpected maintenance response: %d, %v", r.StatusCode, err)
+		}
+		r.Body.Close()
+		ids = append(ids, win.ID)
+	}
+
+	r, err = client.Get(baseURL + "/devices/" + dev.ID + "/maintenance?from=" + stamp(-3*time.Hour) + "&to=" + stamp(0))
+	if err != nil {
+		t.Fatalf("GET /devices/{id}/maintenance error: %v", err)
+	}
+	var res struct {
+		DeviceID    string `json:"device_id"`
+		ExcludedSec int64  `json:"excluded_sec"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected maintenance status: %d, %v", r.StatusCode, err)
+	}
+	r.Body.Close()
+	if res.DeviceID != dev.ID || res.ExcludedSec != 90*60 {
+		t.Fatalf("unexpected excluded time: %+v", res)
+	}
+
+	for _, id := range ids {
+		req, _ := http.NewRequest(http.MethodDelete, baseURL+"/maintenance/"+id, nil)
+		r, err = client.Do(req)
+		if err != nil || r.StatusCode != http.StatusNoContent {
+			t.Fatalf("DELETE /maintenance/{id}: %v", err)
+		}
+		r.Body.Close()
+	}
+
+	cancel()
+	waitForShutdown(t, errCh)
+}
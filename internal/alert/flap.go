@@ -0,0 +1,72 @@
+package alert
+
+import "time"
+
+// Flap detection defaults, as in Nagios: the last 21 results and a device
+// that flaps above 20% until it drops below 5%.
+const (
+	DefaultFlapHistory = 21
+	DefaultFlapLow     = 5.0
+	DefaultFlapHigh    = 20.0
+)
+
+// SetFlapDetection configures flap detection over the last history results.
+// A device starts flapping when its flap percentage reaches high and stops
+// once it drops below low. A history shorter than 3 disables it.
+func (p *Processor) SetFlapDetection(history int, low, high float64) {
+	if low < 0 || high < low {
+		return
+	}
+	p.mu.Lock()
+	p.flapHistory, p.flapLow, p.flapHigh = history, low, high
+	p.mu.Unlock()
+}
+
+// flapPercent weighs the state changes in history, newest last, the way
+// Nagios does: changes count from 0.8 for the oldest to 1.2 for the newest
+// transition, relative to a full history of size results.
+func flapPercent(history []string, size int) float64 {
+	if size < 3 {
+		return 0
+	}
+
+	var sum float64
+	n := len(history)
+	for k := 0; k < n-1; k++ { // k = 0 is the newest transition
+		if history[n-1-k] != history[n-2-k] {
+			sum += 1.2 - 0.4*float64(k)/float64(size-2)
+		}
+	}
+	return sum / float64(size-1) * 100
+}
+
+// updateFlapLocked records status in the history of st and returns
+// TypeFlappingStart or TypeFlappingStop when st crosses a threshold. The
+// caller must hold p.mu.
+func (p *Processor) updateFlapLocked(st *State, status string, now time.Time) string {
+	if p.flapHistory < 3 {
+		st.History, st.FlapPercent = nil, 0
+		if st.Flapping {
+			st.Flapping = false
+			return TypeFlappingStop
+		}
+		return ""
+	}
+
+	st.History = append(st.History, status)
+	if len(st.History) > p.flapHistory {
+		st.History = st.History[len(st.History)-p.flapHistory:]
+	}
+	st.FlapPercent = flapPercent(st.History, p.flapHistory)
+
+	switch {
+	case !st.Flapping && st.FlapPercent >= p.flapHigh:
+		st.Flapping = true
+		st.FlappingSince = now
+		return TypeFlappingStart
+	case st.Flapping && st.FlapPercent < p.flapLow:
+		st.Flapping = false
+		return TypeFlappingStop
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package alert
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/Rin0913/monitor/internal/device"
+)
+
+func TestFlapPercent(t *testing.T) {
+	alternating := make([]string, 21)
+	for i := range alternating {
+		alternating[i] = "UP"
+		if i%2 == 1 {
+			alternating[i] = "DOWN"
+		}
+	}
+
+	tests := []struct {
+		history []string
+		want    float64
+	}{
+		{nil, 0},
+		{[]string{"UP", "UP", "UP"}, 0},
+		{alternating, 100},
+		// only the newest transition changed
+		{[]string{"UP", "UP", "DOWN"}, 1.2 / 20 * 100},
+		// only the oldest transition of a full history changed
+		{append([]string{"DOWN"}, make([]string, 20)...), 0.8 / 20 * 100},
+	}
+	for i, tt := range tests {
+		if got := flapPercent(tt.history, 21); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("#%d: flapPercent = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestFlappingSuppressesTransitions(t *testing.T) {
+	web := &device.Device{ID: "web"}
+	p, clk, rec := newTestProcessor(web)
+	p.SetFlapDetection(5, 25, 50)
+
+	report(t, p, clk, "web", "UP")
+	report(t, p, clk, "web", "DOWN")
+	report(t, p, clk, "web", "UP")
+
+	st, _ := p.DeviceStatus(context.Background(), web)
+	if !st.Flapping || st.FlappingSince == nil {
+		t.Fatalf("web not flapping: %+v", st)
+	}
+
+	report(t, p, clk, "web", "DOWN")
+	report(t, p, clk, "web", "UP")
+	report(t, p, clk, "web", "UP")
+	report(t, p, clk, "web", "UP")
+	rec.expect(t, TypeProblem, TypeFlappingStart)
+
+	// the recovery held back while flapping follows the end of flapping
+	report(t, p, clk, "web", "UP")
+	rec.expect(t, TypeProblem, TypeFlappingStart, TypeFlappingStop, TypeRecovery)
+
+	st, _ = p.DeviceStatus(context.Background(), web)
+	if st.Flapping || st.Problem {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+}
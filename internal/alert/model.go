@@ -0,0 +1,149 @@
+package alert
+
+import (
+	"path"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+)
+
+// Notification types.
+const (
+	TypeProblem         = "PROBLEM"
+	TypeRecovery        = "RECOVERY"
+	TypeAcknowledgement = "ACKNOWLEDGEMENT"
+	TypeFlappingStart   = "FLAPPINGSTART"
+	TypeFlappingStop    = "FLAPPINGSTOP"
+)
+
+// StatusUnreachable replaces the failing status of a device whose parents
+// are all down.
+const StatusUnreachable = "UNREACHABLE"
+
+// State types. A problem is SOFT until it has failed MaxCheckAttempts
+// checks in a row; only HARD problems are notified.
+const (
+	StateSoft = "SOFT"
+	StateHard = "HARD"
+)
+
+// State is the alerting state of a device, updated with every result.
+type State struct {
+	DeviceID string    `json:"device_id"`
+	Status   string    `json:"status"`
+	Problem  bool      `json:"problem"`
+	Since    time.Time `json:"since"`
+
+	StateType string `json:"state_type,omitempty"`
+	Attempt   int    `json:"attempt,omitempty"`
+
+	// Notified is set once the current problem has been notified, so the
+	// recovery is notified too.
+	Notified     bool      `json:"notified"`
+	LastNotified time.Time `json:"last_notified,omitempty"`
+	Ack          *Ack      `json:"ack,omitempty"`
+
+	// Routed is set when the current problem follows the escalation Steps
+	// a Router gave it: Escalated lists the notifiers reached so far, OnCall
+	// the schedules, and Escalation counts the steps taken since NotifiedAt.
+	Routed     bool         `json:"routed,omitempty"`
+	Route      string       `json:"route,omitempty"`
+	Steps      []Escalation `json:"steps,omitempty"`
+	NotifiedAt time.Time    `json:"notified_at,omitempty"`
+	Escalation int          `json:"escalation,omitempty"`
+	Escalated  []string     `json:"escalated,omitempty"`
+	OnCall     []string     `json:"oncall,omitempty"`
+
+	// History holds the latest statuses, oldest first, for flap detection.
+	History       []string  `json:"history,omitempty"`
+	FlapPercent   float64   `json:"flap_percent,omitempty"`
+	Flapping      bool      `json:"flapping,omitempty"`
+	FlappingSince time.Time `json:"flapping_since,omitempty"`
+}
+
+// Ack acknowledges the current problem of a device. It suppresses
+// re-notifications until the device recovers or the ack expires.
+type Ack struct {
+	Author    string    `json:"author,omitempty"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Active reports whether the ack still holds at t.
+func (a *Ack) Active(t time.Time) bool {
+	return a != nil && (a.ExpiresAt.IsZero() || t.Before(a.ExpiresAt))
+}
+
+// Silence suppresses all notifications of the matching devices between
+// StartsAt and EndsAt. A device matches if it matches every matcher set:
+// DeviceID, all Labels, and the AddressPattern glob (see path.Match).
+type Silence struct {
+	ID             string            `json:"id"`
+	DeviceID       string            `json:"device_id,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	AddressPattern string            `json:"address_pattern,omitempty"`
+	StartsAt       time.Time         `json:"starts_at"`
+	EndsAt         time.Time         `json:"ends_at"`
+	Author         string            `json:"author,omitempty"`
+	Comment        string            `json:"comment"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// Active reports whether the silence is in effect at t.
+func (s *Silence) Active(t time.Time) bool {
+	return !t.Before(s.StartsAt) && t.Before(s.EndsAt)
+}
+
+// Matches reports whether the silence applies to d.
+func (s *Silence) Matches(d *device.Device) bool {
+	if s.DeviceID != "" && s.DeviceID != d.ID {
+		return false
+	}
+	for k, v := range s.Labels {
+		if d.Labels[k] != v {
+			return false
+		}
+	}
+	if s.AddressPattern != "" {
+		if ok, _ := path.Match(s.AddressPattern, d.Address); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Notification is sent to the notifiers when a device changes state or is
+// acknowledged.
+type Notification struct {
+	Type   string               `json:"type"`
+	Device *device.Device       `json:"device"`
+	Health *health.HealthStatus `json:"health,omitempty"`
+	Since  time.Time            `json:"since"`
+	Time   time.Time            `json:"time"`
+	Ack    *Ack                 `json:"ack,omitempty"`
+	// Route names the routing rule the notification follows, if any, and
+	// OnCall the users on call for the schedules it targets.
+	Route  string   `json:"route,omitempty"`
+	OnCall []string `json:"oncall,omitempty"`
+}
+
+// DeviceStatus is the alerting view of a device.
+type DeviceStatus struct {
+	Problem      bool       `json:"problem"`
+	Status       string     `json:"status,omitempty"`
+	StateType    string     `json:"state_type,omitempty"`
+	Attempt      int        `json:"attempt,omitempty"`
+	Since        *time.Time `json:"since,omitempty"`
+	Acknowledged *Ack       `json:"acknowledged,omitempty"`
+	Silenced     bool       `json:"silenced"`
+	SilencedBy   []string   `json:"silenced_by,omitempty"`
+
+	InMaintenance bool     `json:"in_maintenance"`
+	Maintenance   []string `json:"maintenance,omitempty"`
+
+	Flapping      bool       `json:"flapping"`
+	FlapPercent   float64    `json:"flap_percent"`
+	FlappingSince *time.Time `json:"flapping_since,omitempty"`
+}
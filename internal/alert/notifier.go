@@ -0,0 +1,29 @@
+package alert
+
+import (
+	"context"
+	"log"
+)
+
+// Notifier delivers notifications to people, e.g. by mail or chat.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// LogNotifier writes notifications to the log. It is used when no other
+// notifier is configured.
+type LogNotifier struct{}
+
+func (LogNotifier) Name() string {
+	return "log"
+}
+
+func (LogNotifier) Notify(ctx context.Context, n *Notification) error {
+	status := ""
+	if n.Health != nil {
+		status = n.Health.Status
+	}
+	log.Printf("[INFO] notification %s: device %s (%s) %s", n.Type, n.Device.ID, n.Device.Address, status)
+	return nil
+}
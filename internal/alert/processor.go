@@ -0,0 +1,526 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/clock"
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+	"github.com/Rin0913/monitor/internal/maintenance"
+	"github.com/google/uuid"
+)
+
+const defaultRenotifyInterval = 30 * time.Minute
+
+var (
+	ErrNoProblem      = errors.New("alert: device has no problem to acknowledge")
+	ErrInvalidSilence = errors.New("alert: invalid silence")
+)
+
+// Processor turns check results into notifications. A device that stops
+// being UP is notified as a PROBLEM once the problem is HARD, re-notified
+// every renotify interval while the problem lasts and is not acknowledged,
+// and notified as a RECOVERY once it is UP again. Silenced devices, devices
+// in maintenance and UNREACHABLE devices are not notified at all. While a
+// device flaps, only the start and end of flapping are notified.
+type Processor struct {
+	repo        Repository
+	deviceRepo  device.Repository
+	maintenance *maintenance.Service
+	router      Router
+	healthRepo  health.Repository
+	oncall      OnCallDirectory
+
+	// mu guards the configuration below. State updates are kept consistent
+	// across replicas by Repository.UpdateState instead.
+	mu        sync.RWMutex
+	notifiers []Notifier
+	renotify  time.Duration
+	clock     clock.Clock
+
+	flapHistory       int
+	flapLow, flapHigh float64
+}
+
+func NewProcessor(repo Repository, deviceRepo device.Repository) *Processor {
+	return &Processor{
+		repo:       repo,
+		deviceRepo: deviceRepo,
+		renotify:   defaultRenotifyInterval,
+		clock:      clock.Real,
+
+		flapHistory: DefaultFlapHistory,
+		flapLow:     DefaultFlapLow,
+		flapHigh:    DefaultFlapHigh,
+	}
+}
+
+// AddNotifier adds a notifier. Without any, notifications are logged.
+func (p *Processor) AddNotifier(n Notifier) {
+	if n == nil {
+		return
+	}
+	p.mu.Lock()
+	p.notifiers = append(p.notifiers, n)
+	p.mu.Unlock()
+}
+
+// SetRenotifyInterval sets how often an unacknowledged problem is notified
+// again. Zero disables re-notification.
+func (p *Processor) SetRenotifyInterval(d time.Duration) {
+	if d < 0 {
+		return
+	}
+	p.mu.Lock()
+	p.renotify = d
+	p.mu.Unlock()
+}
+
+// SetMaintenance makes the processor flag results taken during maintenance
+// windows and suppress their notifications.
+func (p *Processor) SetMaintenance(m *maintenance.Service) {
+	p.mu.Lock()
+	p.maintenance = m
+	p.mu.Unlock()
+}
+
+// SetHealthRepo gives escalated problems the latest stored result of their
+// device.
+func (p *Processor) SetHealthRepo(r health.Repository) {
+	p.mu.Lock()
+	p.healthRepo = r
+	p.mu.Unlock()
+}
+
+func (p *Processor) SetClock(c clock.Clock) {
+	if c == nil {
+		return
+	}
+	p.mu.Lock()
+	p.clock = c
+	p.mu.Unlock()
+}
+
+// Process updates the alerting state of a device with a check result and
+// sends the resulting notification, if any. It flags h as InMaintenance and
+// turns its status into UNREACHABLE when all parents are down, so it is meant
+// to run before h is stored. Notifiers are called after the state is saved,
+// without holding p.mu.
+func (p *Processor) Process(ctx context.Context, h *health.HealthStatus) error {
+	if h == nil {
+		return nil
+	}
+
+	d, err := p.deviceRepo.GetByID(ctx, h.DeviceID)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return nil
+	}
+
+	status := h.Status
+	var (
+		out      []*delivery
+		problem  *delivery
+		previous State
+	)
+
+	p.mu.RLock()
+	now := p.clock.Now()
+	err = p.repo.UpdateState(ctx, d.ID, func(st *State) (*State, error) {
+		out, problem = nil, nil
+		h.Status = status
+
+		if st == nil {
+			st = &State{DeviceID: d.ID, Status: "UP"}
+		}
+		if st.StateType == "" {
+			// States saved before state types existed.
+			st.StateType = StateHard
+		}
+		previous = *st
+
+		windows, err := p.activeMaintenance(ctx, d, now)
+		if err != nil {
+			return nil, err
+		}
+		h.InMaintenance = len(windows) > 0
+
+		isProblem := h.Status != "UP"
+		if isProblem {
+			unreachable, err := p.unreachableLocked(ctx, d)
+			if err != nil {
+				return nil, err
+			}
+			if unreachable {
+				h.Status = StatusUnreachable
+			}
+		}
+
+		flap := p.updateFlapLocked(st, h.Status, now)
+		typ := ""
+
+		switch {
+		case isProblem:
+			if !st.Problem {
+				// Notified is only still set if the recovery was held back by
+				// flapping, so the problem stays known.
+				st.Problem = true
+				st.Since = now
+				st.StateType = StateSoft
+				st.Attempt = 0
+				st.Ack = nil
+			}
+			if st.StateType == StateSoft {
+				st.Attempt++
+				if st.Attempt >= max(d.MaxCheckAttempts, 1) {
+					st.StateType = StateHard
+				}
+			}
+
+			// The problem of an unreachable device is its parent's, which is
+			// notified instead.
+			if st.StateType != StateHard || h.Status == StatusUnreachable || st.Ack.Active(now) || st.Flapping {
+				break
+			}
+			// Not notified yet (e.g. silenced so far), or due for a reminder.
+			if !st.Notified || (p.renotify > 0 && now.Sub(st.LastNotified) >= p.renotify) {
+				typ = TypeProblem
+			}
+		default:
+			if st.Problem {
+				st.Problem = false
+				st.Since = now
+				st.StateType = StateHard
+				st.Attempt = 0
+				st.Ack = nil
+			}
+			// A recovery held back while flapping is sent once it stops.
+			if st.Notified && !st.Flapping {
+				typ = TypeRecovery
+				st.Notified = false
+			}
+		}
+		st.Status = h.Status
+
+		if flap != "" {
+			n := &Notification{Type: flap, Device: d, Health: h, Since: st.FlappingSince, Time: now}
+			targets, schedules := p.targetsLocked(st, n)
+			dl, err := p.prepareLocked(ctx, n, targets, schedules)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, dl)
+		}
+
+		if typ != "" {
+			n := &Notification{Type: typ, Device: d, Health: h, Since: st.Since, Time: now}
+			targets, schedules := p.targetsLocked(st, n)
+			dl, err := p.prepareLocked(ctx, n, targets, schedules)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, dl)
+			// A problem counts as notified unless its delivery fails, which
+			// is undone below.
+			if dl != nil && typ == TypeProblem {
+				st.Notified = true
+				st.LastNotified = now
+				problem = dl
+			}
+			if typ == TypeRecovery {
+				st.Routed, st.Route, st.Steps, st.Escalation, st.Escalated, st.OnCall = false, "", nil, 0, nil, nil
+			}
+		}
+		return st, nil
+	})
+	p.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, dl := range out {
+		if dl == nil {
+			continue
+		}
+		sent := p.deliver(ctx, dl)
+		if dl == problem && !sent {
+			// Leave the problem to be notified again with the next result.
+			if err := p.undoProblem(ctx, d.ID, now, previous); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// undoProblem marks the problem notified at t as not notified, unless its
+// state changed since.
+func (p *Processor) undoProblem(ctx context.Context, deviceID string, t time.Time, previous State) error {
+	return p.repo.UpdateState(ctx, deviceID, func(st *State) (*State, error) {
+		if st == nil || !st.Problem || !st.LastNotified.Equal(t) {
+			return nil, nil
+		}
+		st.Notified = previous.Notified
+		st.LastNotified = previous.LastNotified
+		return st, nil
+	})
+}
+
+// Acknowledge acknowledges the current problem of a device, which stops
+// re-notifications until the device recovers or expiresAt, if set, passes.
+func (p *Processor) Acknowledge(ctx context.Context, deviceID, author, comment string, expiresAt time.Time) (*Ack, error) {
+	d, err := p.deviceRepo.GetByID(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("alert: unknown device %s", deviceID)
+	}
+
+	var (
+		ack *Ack
+		dl  *delivery
+	)
+
+	p.mu.RLock()
+	now := p.clock.Now()
+	err = p.repo.UpdateState(ctx, deviceID, func(st *State) (*State, error) {
+		if st == nil || !st.Problem {
+			return nil, ErrNoProblem
+		}
+
+		st.Ack = &Ack{
+			Author:    author,
+			Comment:   comment,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		}
+		ack = st.Ack
+
+		var err error
+		n := &Notification{Type: TypeAcknowledgement, Device: d, Since: st.Since, Time: now, Ack: st.Ack}
+		targets, schedules := p.targetsLocked(st, n)
+		dl, err = p.prepareLocked(ctx, n, targets, schedules)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	})
+	p.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if dl != nil {
+		p.deliver(ctx, dl)
+	}
+	return ack, nil
+}
+
+// delivery is a notification ready to be sent to its notifiers once p.mu
+// is released.
+type delivery struct {
+	n         *Notification
+	notifiers []Notifier
+}
+
+// prepareLocked picks the notifiers n goes to: the named ones, or all of
+// them if targets is nil, and fills in the users on call for schedules. It
+// returns nil if the device is silenced or in maintenance. The caller must
+// hold p.mu.
+func (p *Processor) prepareLocked(ctx context.Context, n *Notification, targets, schedules []string) (*delivery, error) {
+	silences, err := p.activeSilences(ctx, n.Device, n.Time)
+	if err != nil {
+		return nil, err
+	}
+	if len(silences) > 0 {
+		log.Printf("[INFO] alert: %s of device %s silenced by %s", n.Type, n.Device.ID, silences[0].ID)
+		return nil, nil
+	}
+
+	windows, err := p.activeMaintenance(ctx, n.Device, n.Time)
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) > 0 {
+		log.Printf("[INFO] alert: %s of device %s suppressed by maintenance %s", n.Type, n.Device.ID, windows[0].ID)
+		return nil, nil
+	}
+	n.OnCall = p.onCallUsersLocked(ctx, schedules, n.Time)
+
+	if targets == nil {
+		notifiers := append([]Notifier{}, p.notifiers...)
+		if len(notifiers) == 0 {
+			notifiers = []Notifier{LogNotifier{}}
+		}
+		return &delivery{n: n, notifiers: notifiers}, nil
+	}
+
+	dl := &delivery{n: n}
+	for _, name := range targets {
+		nf := p.notifierLocked(name)
+		if nf == nil {
+			log.Printf("[WARN] alert: unknown notifier %s", name)
+			continue
+		}
+		dl.notifiers = append(dl.notifiers, nf)
+	}
+	return dl, nil
+}
+
+// deliver sends dl and reports whether it went out, which it did if any
+// notifier delivered it or it has no notifiers at all. Failures are logged.
+func (p *Processor) deliver(ctx context.Context, dl *delivery) bool {
+	if len(dl.notifiers) == 0 {
+		return true
+	}
+
+	failed := 0
+	for _, nf := range dl.notifiers {
+		if err := nf.Notify(ctx, dl.n); err != nil {
+			log.Printf("[WARN] alert: notifier %s: %v", nf.Name(), err)
+			failed++
+		}
+	}
+	return failed < len(dl.notifiers)
+}
+
+// unreachableLocked reports whether all parents of d are in a hard DOWN or
+// UNREACHABLE state. The caller must hold p.mu.
+func (p *Processor) unreachableLocked(ctx context.Context, d *device.Device) (bool, error) {
+	if len(d.Parents) == 0 {
+		return false, nil
+	}
+
+	for _, id := range d.Parents {
+		st, err := p.repo.GetState(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		if st == nil || !st.Problem || st.StateType == StateSoft {
+			return false, nil
+		}
+		if st.Status != "DOWN" && st.Status != StatusUnreachable {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (p *Processor) notifierLocked(name string) Notifier {
+	for _, nf := range p.notifiers {
+		if nf.Name() == name {
+			return nf
+		}
+	}
+	return nil
+}
+
+func (p *Processor) activeSilences(ctx context.Context, d *device.Device, t time.Time) ([]*Silence, error) {
+	silences, err := p.repo.ListSilences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*Silence
+	for _, s := range silences {
+		if s.Active(t) && s.Matches(d) {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (p *Processor) activeMaintenance(ctx context.Context, d *device.Device, t time.Time) ([]*maintenance.Window, error) {
+	if p.maintenance == nil {
+		return nil, nil
+	}
+	return p.maintenance.Active(ctx, d, t)
+}
+
+// AddSilence validates and stores a new silence. StartsAt defaults to now.
+func (p *Processor) AddSilence(ctx context.Context, s *Silence) error {
+	if s.DeviceID == "" && len(s.Labels) == 0 && s.AddressPattern == "" {
+		return fmt.Errorf("%w: needs a device_id, labels or address_pattern", ErrInvalidSilence)
+	}
+	if s.AddressPattern != "" {
+		if _, err := path.Match(s.AddressPattern, ""); err != nil {
+			return fmt.Errorf("%w: address_pattern: %v", ErrInvalidSilence, err)
+		}
+	}
+
+	now := p.clock.Now()
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if !s.EndsAt.After(s.StartsAt) || !s.EndsAt.After(now) {
+		return fmt.Errorf("%w: ends_at must be after starts_at and in the future", ErrInvalidSilence)
+	}
+
+	s.ID = uuid.NewString()
+	s.CreatedAt = now
+	return p.repo.SaveSilence(ctx, s)
+}
+
+func (p *Processor) Silences(ctx context.Context) ([]*Silence, error) {
+	return p.repo.ListSilences(ctx)
+}
+
+func (p *Processor) DeleteSilence(ctx context.Context, id string) error {
+	return p.repo.DeleteSilence(ctx, id)
+}
+
+// DeviceStatus returns the alerting view of d.
+func (p *Processor) DeviceStatus(ctx context.Context, d *device.Device) (*DeviceStatus, error) {
+	st, err := p.repo.GetState(ctx, d.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := p.clock.Now()
+	silences, err := p.activeSilences(ctx, d, now)
+	if err != nil {
+		return nil, err
+	}
+
+	windows, err := p.activeMaintenance(ctx, d, now)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DeviceStatus{Silenced: len(silences) > 0, InMaintenance: len(windows) > 0}
+	for _, s := range silences {
+		res.SilencedBy = append(res.SilencedBy, s.ID)
+	}
+	for _, w := range windows {
+		res.Maintenance = append(res.Maintenance, w.ID)
+	}
+	if st != nil && st.Flapping {
+		since := st.FlappingSince
+		res.Flapping = true
+		res.FlappingSince = &since
+	}
+	if st != nil {
+		res.FlapPercent = st.FlapPercent
+	}
+	if st != nil && st.Problem {
+		since := st.Since
+		res.Problem = true
+		res.Status = st.Status
+		res.StateType = st.StateType
+		res.Attempt = st.Attempt
+		res.Since = &since
+		if st.Ack.Active(now) {
+			res.Acknowledged = st.Ack
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,465 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/clock"
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+	"github.com/Rin0913/monitor/internal/maintenance"
+)
+
+func newTestProcessor(devs ...*device.Device) (*Processor, *clock.Fake, *recorder) {
+	clk := clock.NewFake(time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC))
+	rec := &recorder{}
+
+	p := NewProcessor(newMemRepo(clk), &fakeDeviceRepo{devs: devs})
+	p.SetClock(clk)
+	p.SetRenotifyInterval(10 * time.Minute)
+	p.AddNotifier(rec)
+	return p, clk, rec
+}
+
+func report(t *testing.T, p *Processor, clk *clock.Fake, id, status string) {
+	t.Helper()
+	if err := p.Process(context.Background(), &health.HealthStatus{DeviceID: id, Status: status, LastCheck: clk.Now()}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+}
+
+func TestProcessorNotifiesProblemAndRecovery(t *testing.T) {
+	p, clk, rec := newTestProcessor(&device.Device{ID: "web", Address: "10.0.0.1:80"})
+
+	report(t, p, clk, "web", "UP")
+	report(t, p, clk, "web", "DOWN")
+	clk.Advance(time.Minute)
+	report(t, p, clk, "web", "DOWN")
+	clk.Advance(10 * time.Minute)
+	report(t, p, clk, "web", "DOWN")
+	report(t, p, clk, "web", "UP")
+	report(t, p, clk, "web", "UP")
+
+	rec.expect(t, TypeProblem, TypeProblem, TypeRecovery)
+}
+
+func TestAckSuppressesRenotificationUntilRecovery(t *testing.T) {
+	p, clk, rec := newTestProcessor(&device.Device{ID: "db", Address: "10.0.0.2:5432"})
+	ctx := context.Background()
+
+	if _, err := p.Acknowledge(ctx, "db", "alice", "looking", time.Time{}); err != ErrNoProblem {
+		t.Fatalf("ack without problem: %v", err)
+	}
+
+	report(t, p, clk, "db", "DOWN")
+	if _, err := p.Acknowledge(ctx, "db", "alice", "looking", time.Time{}); err != nil {
+		t.Fatalf("Acknowledge: %v", err)
+	}
+
+	st, _ := p.DeviceStatus(ctx, &device.Device{ID: "db"})
+	if !st.Problem || st.Acknowledged == nil || st.Acknowledged.Comment != "looking" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	clk.Advance(time.Hour)
+	report(t, p, clk, "db", "DOWN")
+	report(t, p, clk, "db", "UP")
+
+	// the next problem is notified again
+	report(t, p, clk, "db", "DOWN")
+
+	rec.expect(t, TypeProblem, TypeAcknowledgement, TypeRecovery, TypeProblem)
+}
+
+func TestAckExpires(t *testing.T) {
+	p, clk, rec := newTestProcessor(&device.Device{ID: "db"})
+
+	report(t, p, clk, "db", "DOWN")
+	if _, err := p.Acknowledge(context.Background(), "db", "", "later", clk.Now().Add(15*time.Minute)); err != nil {
+		t.Fatalf("Acknowledge: %v", err)
+	}
+
+	clk.Advance(10 * time.Minute)
+	report(t, p, clk, "db", "DOWN")
+	clk.Advance(5 * time.Minute)
+	report(t, p, clk, "db", "DOWN")
+
+	rec.expect(t, TypeProblem, TypeAcknowledgement, TypeProblem)
+}
+
+func TestSilenceSuppressesMatchingDevices(t *testing.T) {
+	web := &device.Device{ID: "web", Address: "web1.example.com:443", Labels: map[string]string{"env": "prod"}}
+	db := &device.Device{ID: "db", Address: "db1.example.com:5432", Labels: map[string]string{"env": "prod"}}
+	p, clk, rec := newTestProcessor(web, db)
+	ctx := context.Background()
+
+	if err := p.AddSilence(ctx, &Silence{Comment: "no matcher", EndsAt: clk.Now().Add(time.Hour)}); err == nil {
+		t.Fatalf("silence without matcher accepted")
+	}
+
+	sil := &Silence{
+		Labels:         map[string]string{"env": "prod"},
+		AddressPattern: "web*",
+		EndsAt:         clk.Now().Add(time.Hour),
+		Comment:        "deploy",
+	}
+	if err := p.AddSilence(ctx, sil); err != nil {
+		t.Fatalf("AddSilence: %v", err)
+	}
+
+	st, _ := p.DeviceStatus(ctx, web)
+	if !st.Silenced || len(st.SilencedBy) != 1 || st.SilencedBy[0] != sil.ID {
+		t.Fatalf("web not silenced: %+v", st)
+	}
+	if st, _ := p.DeviceStatus(ctx, db); st.Silenced {
+		t.Fatalf("db silenced: %+v", st)
+	}
+
+	report(t, p, clk, "web", "DOWN")
+	report(t, p, clk, "db", "DOWN")
+	rec.expect(t, TypeProblem)
+	if rec.sent[0].Device.ID != "db" {
+		t.Fatalf("unexpected notification for %s", rec.sent[0].Device.ID)
+	}
+
+	// once the silence ends the ongoing problem is notified
+	clk.Advance(time.Hour)
+	report(t, p, clk, "web", "DOWN")
+	rec.expect(t, TypeProblem, TypeProblem)
+}
+
+func TestMaintenanceSuppressesNotifications(t *testing.T) {
+	web := &device.Device{ID: "web", Labels: map[string]string{"role": "web"}}
+	p, clk, rec := newTestProcessor(web)
+	ctx := context.Background()
+
+	windows := maintenance.NewService(&memWindows{})
+	p.SetMaintenance(windows)
+	w := &maintenance.Window{
+		Labels:   map[string]string{"role": "web"},
+		StartsAt: clk.Now(),
+		EndsAt:   clk.Now().Add(time.Hour),
+	}
+	if err := windows.Add(ctx, w); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	h := &health.HealthStatus{DeviceID: "web", Status: "DOWN", LastCheck: clk.Now()}
+	if err := p.Process(ctx, h); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if !h.InMaintenance {
+		t.Fatalf("result not flagged as in maintenance")
+	}
+	st, _ := p.DeviceStatus(ctx, web)
+	if !st.InMaintenance || len(st.Maintenance) != 1 || st.Maintenance[0] != w.ID {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	rec.expect(t)
+
+	// a problem lasting past the window is notified
+	clk.Advance(time.Hour)
+	h = &health.HealthStatus{DeviceID: "web", Status: "DOWN", LastCheck: clk.Now()}
+	if err := p.Process(ctx, h); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if h.InMaintenance {
+		t.Fatalf("result flagged after the window")
+	}
+	rec.expect(t, TypeProblem)
+}
+
+func TestSoftStatesAreNotNotified(t *testing.T) {
+	p, clk, rec := newTestProcessor(&device.Device{ID: "web", MaxCheckAttempts: 3})
+	ctx := context.Background()
+
+	report(t, p, clk, "web", "DOWN")
+	report(t, p, clk, "web", "UP")
+	report(t, p, clk, "web", "DOWN")
+	report(t, p, clk, "web", "DOWN")
+	st, _ := p.DeviceStatus(ctx, &device.Device{ID: "web"})
+	if st.StateType != StateSoft || st.Attempt != 2 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	rec.expect(t)
+
+	report(t, p, clk, "web", "DOWN")
+	st, _ = p.DeviceStatus(ctx, &device.Device{ID: "web"})
+	if st.StateType != StateHard {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	report(t, p, clk, "web", "UP")
+	rec.expect(t, TypeProblem, TypeRecovery)
+}
+
+func TestUnreachableChildrenAreNotNotified(t *testing.T) {
+	router := &device.Device{ID: "router", MaxCheckAttempts: 2}
+	web := &device.Device{ID: "web", Parents: []string{"router"}}
+	p, clk, rec := newTestProcessor(router, web)
+	ctx := context.Background()
+
+	check := func(id, status string) *health.HealthStatus {
+		t.Helper()
+		h := &health.HealthStatus{DeviceID: id, Status: status, LastCheck: clk.Now()}
+		if err := p.Process(ctx, h); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+		return h
+	}
+
+	// a soft DOWN parent does not make its children unreachable
+	check("router", "DOWN")
+	if h := check("web", "DOWN"); h.Status != "DOWN" {
+		t.Fatalf("web = %s with soft DOWN parent", h.Status)
+	}
+	check("web", "UP")
+
+	check("router", "DOWN")
+	if h := check("web", "DOWN"); h.Status != StatusUnreachable {
+		t.Fatalf("web = %s with hard DOWN parent", h.Status)
+	}
+	clk.Advance(time.Hour)
+	check("web", "DOWN")
+
+	// once the parent is back, a child still failing is notified
+	check("router", "UP")
+	if h := check("web", "DOWN"); h.Status != "DOWN" {
+		t.Fatalf("web = %s with UP parent", h.Status)
+	}
+
+	var got []string
+	for _, n := range rec.sent {
+		got = append(got, n.Type+" "+n.Device.ID)
+	}
+	want := []string{"PROBLEM web", "RECOVERY web", "PROBLEM router", "RECOVERY router", "PROBLEM web"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("notifications = %v, want %v", got, want)
+	}
+}
+
+func TestFailedProblemIsNotifiedAgain(t *testing.T) {
+	p, clk, rec := newTestProcessor(&device.Device{ID: "web"})
+
+	rec.fail = true
+	report(t, p, clk, "web", "DOWN")
+	report(t, p, clk, "web", "DOWN")
+	rec.fail = false
+	report(t, p, clk, "web", "DOWN")
+	report(t, p, clk, "web", "DOWN")
+
+	rec.expect(t, TypeProblem, TypeProblem, TypeProblem)
+}
+
+// blocker holds the notifications of one device until released.
+type blocker struct {
+	deviceID string
+	entered  chan struct{}
+	release  chan struct{}
+}
+
+func (b *blocker) Name() string {
+	return "blocker"
+}
+
+func (b *blocker) Notify(ctx context.Context, n *Notification) error {
+	if n.Device.ID == b.deviceID {
+		close(b.entered)
+		<-b.release
+	}
+	return nil
+}
+
+func TestSlowNotifierDoesNotBlockOtherDevices(t *testing.T) {
+	p, clk, _ := newTestProcessor(&device.Device{ID: "web"}, &device.Device{ID: "db"})
+	slow := &blocker{deviceID: "web", entered: make(chan struct{}), release: make(chan struct{})}
+	p.AddNotifier(slow)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Process(context.Background(), &health.HealthStatus{DeviceID: "web", Status: "DOWN", LastCheck: clk.Now()})
+	}()
+	<-slow.entered
+
+	processed := make(chan error, 1)
+	go func() {
+		processed <- p.Process(context.Background(), &health.HealthStatus{DeviceID: "db", Status: "DOWN", LastCheck: clk.Now()})
+	}()
+	select {
+	case err := <-processed:
+		if err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("processing db waited for the notifier of web")
+	}
+
+	close(slow.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+}
+
+type recorder struct {
+	name string
+	fail bool
+	sent []*Notification
+}
+
+func (r *recorder) Name() string {
+	if r.name == "" {
+		return "recorder"
+	}
+	return r.name
+}
+
+func (r *recorder) Notify(ctx context.Context, n *Notification) error {
+	r.sent = append(r.sent, n)
+	if r.fail {
+		return errors.New("delivery failed")
+	}
+	return nil
+}
+
+func (r *recorder) expect(t *testing.T, types ...string) {
+	t.Helper()
+	var got []string
+	for _, n := range r.sent {
+		got = append(got, n.Type)
+	}
+	if len(got) != len(types) {
+		t.Fatalf("notifications = %v, want %v", got, types)
+	}
+	for i := range types {
+		if got[i] != types[i] {
+			t.Fatalf("notifications = %v, want %v", got, types)
+		}
+	}
+}
+
+// memRepo keeps states in memory. UpdateState compares versions like the
+// Redis repository watches the key.
+type memRepo struct {
+	clk      clock.Clock
+	mu       sync.Mutex
+	states   map[string]State
+	versions map[string]int
+	silences map[string]Silence
+}
+
+func newMemRepo(clk clock.Clock) *memRepo {
+	return &memRepo{clk: clk, states: map[string]State{}, versions: map[string]int{}, silences: map[string]Silence{}}
+}
+
+func (r *memRepo) GetState(ctx context.Context, id string) (*State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, ok := r.states[id]
+	if !ok {
+		return nil, nil
+	}
+	return &st, nil
+}
+
+func (r *memRepo) SaveState(ctx context.Context, st *State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states[st.DeviceID] = *st
+	r.versions[st.DeviceID]++
+	return nil
+}
+
+func (r *memRepo) UpdateState(ctx context.Context, id string, fn func(st *State) (*State, error)) error {
+	for {
+		r.mu.Lock()
+		version := r.versions[id]
+		r.mu.Unlock()
+
+		st, _ := r.GetState(ctx, id)
+		next, err := fn(st)
+		if err != nil || next == nil {
+			return err
+		}
+
+		r.mu.Lock()
+		if r.versions[id] == version {
+			r.states[id] = *next
+			r.versions[id]++
+			r.mu.Unlock()
+			return nil
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *memRepo) ListSilences(ctx context.Context) ([]*Silence, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []*Silence
+	for _, s := range r.silences {
+		if r.clk.Now().Before(s.EndsAt) {
+			s := s
+			res = append(res, &s)
+		}
+	}
+	return res, nil
+}
+
+func (r *memRepo) SaveSilence(ctx context.Context, s *Silence) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.silences[s.ID] = *s
+	return nil
+}
+
+func (r *memRepo) DeleteSilence(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.silences, id)
+	return nil
+}
+
+type fakeDeviceRepo struct {
+	devs []*device.Device
+}
+
+func (r *fakeDeviceRepo) List(ctx context.Context) ([]*device.Device, error) {
+	return r.devs, nil
+}
+
+func (r *fakeDeviceRepo) GetByID(ctx context.Context, id string) (*device.Device, error) {
+	for _, d := range r.devs {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeDeviceRepo) Save(ctx context.Context, d *device.Device) error {
+	return nil
+}
+
+func (r *fakeDeviceRepo) DeleteByID(ctx context.Context, id string) error {
+	return nil
+}
+
+type memWindows struct {
+	windows []*maintenance.Window
+}
+
+func (r *memWindows) List(ctx context.Context) ([]*maintenance.Window, error) {
+	return r.windows, nil
+}
+
+func (r *memWindows) Save(ctx context.Context, w *maintenance.Window) error {
+	r.windows = append(r.windows, w)
+	return nil
+}
+
+func (r *memWindows) Delete(ctx context.Context, id string) error {
+	return nil
+}
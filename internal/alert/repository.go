@@ -0,0 +1,200 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	stateKeyPrefix = "alert:state:"
+	silencesKey    = "alert:silences"
+
+	// maxStateRetries bounds how often UpdateState retries when the state
+	// changes under it.
+	maxStateRetries = 10
+)
+
+// Repository stores the alerting state. UpdateState applies fn to the
+// state of a device, nil if there is none yet, and saves the state fn
+// returns unless it is nil. fn may run again if the state was changed
+// concurrently, e.g. by another replica, so it must not have other effects.
+type Repository interface {
+	GetState(ctx context.Context, deviceID string) (*State, error)
+	SaveState(ctx context.Context, st *State) error
+	UpdateState(ctx context.Context, deviceID string, fn func(st *State) (*State, error)) error
+	ListSilences(ctx context.Context) ([]*Silence, error)
+	SaveSilence(ctx context.Context, s *Silence) error
+	DeleteSilence(ctx context.Context, id string) error
+}
+
+type RedisRepository struct {
+	client *redis.Client
+}
+
+func NewRedisRepository(client *redis.Client) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+	}
+}
+
+func (r *RedisRepository) stateKey(deviceID string) string {
+	return stateKeyPrefix + deviceID
+}
+
+func (r *RedisRepository) GetState(ctx context.Context, deviceID string) (*State, error) {
+	if deviceID == "" {
+		return nil, fmt.Errorf("alert: empty device id")
+	}
+
+	return decodeState(r.client.Get(ctx, r.stateKey(deviceID)).Result())
+}
+
+func decodeState(s string, err error) (*State, error) {
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var st State
+	if err := json.Unmarshal([]byte(s), &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (r *RedisRepository) SaveState(ctx context.Context, st *State) error {
+	if st == nil || st.DeviceID == "" {
+		return fmt.Errorf("alert: invalid state")
+	}
+
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.stateKey(st.DeviceID), b, 0).Err()
+}
+
+// UpdateState watches the state key, so the new state is only written if
+// nobody else wrote it since it was read.
+func (r *RedisRepository) UpdateState(ctx context.Context, deviceID string, fn func(st *State) (*State, error)) error {
+	if deviceID == "" {
+		return fmt.Errorf("alert: empty device id")
+	}
+	key := r.stateKey(deviceID)
+
+	update := func(tx *redis.Tx) error {
+		st, err := decodeState(tx.Get(ctx, key).Result())
+		if err != nil {
+			return err
+		}
+		next, err := fn(st)
+		if err != nil || next == nil {
+			return err
+		}
+		if next.DeviceID != deviceID {
+			return fmt.Errorf("alert: invalid state")
+		}
+
+		b, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, b, 0)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxStateRetries; i++ {
+		err := r.client.Watch(ctx, update, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("alert: state of device %s keeps changing", deviceID)
+}
+
+// ListSilences returns the silences that have not ended yet. Ended ones
+// stay stored until the history compaction removes them.
+func (r *RedisRepository) ListSilences(ctx context.Context) ([]*Silence, error) {
+	all, err := r.allSilences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res := make([]*Silence, 0, len(all))
+	for _, s := range all {
+		if now.Before(s.EndsAt) {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+// EndedSilences returns the IDs of the silences that ended before t.
+func (r *RedisRepository) EndedSilences(ctx context.Context, t time.Time) ([]string, error) {
+	all, err := r.allSilences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, s := range all {
+		if s.EndsAt.Before(t) {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *RedisRepository) allSilences(ctx context.Context) ([]*Silence, error) {
+	values, err := r.client.HGetAll(ctx, silencesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Silence, 0, len(values))
+	for _, v := range values {
+		var s Silence
+		if err := json.Unmarshal([]byte(v), &s); err != nil {
+			return nil, err
+		}
+		res = append(res, &s)
+	}
+	return res, nil
+}
+
+func (r *RedisRepository) SaveSilence(ctx context.Context, s *Silence) error {
+	if s == nil || s.ID == "" {
+		return fmt.Errorf("alert: invalid silence")
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, silencesKey, s.ID, b).Err()
+}
+
+// DeleteSilencesIn queues the deletion of silences on pipe, so it commits
+// together with the other commands of the caller's transaction.
+func (r *RedisRepository) DeleteSilencesIn(ctx context.Context, pipe redis.Pipeliner, ids ...string) {
+	if len(ids) > 0 {
+		pipe.HDel(ctx, silencesKey, ids...)
+	}
+}
+
+func (r *RedisRepository) DeleteSilence(ctx context.Context, id string) error {
+	if id == "" {
+		return fmt.Errorf("alert: empty silence id")
+	}
+	return r.client.HDel(ctx, silencesKey, id).Err()
+}
@@ -0,0 +1,85 @@
+package alert
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Rin0913/monitor/internal/redisclient"
+)
+
+// newTestRepository returns a repository on the test database and removes
+// the alert state of the given devices before and after the test.
+func newTestRepository(t *testing.T, deviceIDs ...string) *RedisRepository {
+	t.Helper()
+
+	if os.Getenv("REDIS_ADDR") == "" && os.Getenv("REDIS_URL") == "" {
+		t.Skip("redis not configured")
+	}
+
+	client := redisclient.NewTestClientFromEnv()
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis not reachable: %v", err)
+	}
+
+	repo := NewRedisRepository(client)
+	cleanup := func() {
+		for _, id := range deviceIDs {
+			client.Del(ctx, repo.stateKey(id))
+		}
+	}
+	cleanup()
+	t.Cleanup(func() {
+		cleanup()
+		client.Close()
+	})
+
+	return repo
+}
+
+func TestUpdateStateDoesNotLoseConcurrentUpdates(t *testing.T) {
+	repo := newTestRepository(t, "web")
+	ctx := context.Background()
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.UpdateState(ctx, "web", func(st *State) (*State, error) {
+				if st == nil {
+					st = &State{DeviceID: "web"}
+				}
+				st.Attempt++
+				return st, nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("UpdateState: %v", err)
+		}
+	}
+
+	st, err := repo.GetState(ctx, "web")
+	if err != nil {
+		t.Fatalf("GetState: %v", err)
+	}
+	if st.Attempt != n {
+		t.Fatalf("Attempt = %d, want %d", st.Attempt, n)
+	}
+
+	// A nil state leaves the stored one alone.
+	if err := repo.UpdateState(ctx, "web", func(st *State) (*State, error) { return nil, nil }); err != nil {
+		t.Fatalf("UpdateState: %v", err)
+	}
+	if st, _ := repo.GetState(ctx, "web"); st == nil || st.Attempt != n {
+		t.Fatalf("state changed: %+v", st)
+	}
+}
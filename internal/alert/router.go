@@ -0,0 +1,294 @@
+package alert
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+)
+
+// Escalation is a step of an escalation policy: the notifiers to reach once
+// a problem has been notified and left unacknowledged for After. OnCall
+// lists schedules whose users on call the notifiers address. Rule names the
+// routing rule the step belongs to.
+type Escalation struct {
+	After     time.Duration `json:"after"`
+	Notifiers []string      `json:"notifiers"`
+	OnCall    []string      `json:"oncall,omitempty"`
+	Rule      string        `json:"rule,omitempty"`
+}
+
+// OnCallDirectory tells who is on call for a schedule at t.
+type OnCallDirectory interface {
+	Users(ctx context.Context, scheduleID string, t time.Time) ([]string, error)
+}
+
+// Router decides who receives a notification. Route returns the escalation
+// steps for n ordered by After, or none to leave n to every notifier.
+type Router interface {
+	Route(n *Notification) []Escalation
+}
+
+// SetRouter makes the processor notify the notifiers picked by r instead of
+// all of them.
+func (p *Processor) SetRouter(r Router) {
+	p.mu.Lock()
+	p.router = r
+	p.mu.Unlock()
+}
+
+// SetOnCall makes the processor resolve the on-call schedules of routing
+// steps through d.
+func (p *Processor) SetOnCall(d OnCallDirectory) {
+	p.mu.Lock()
+	p.oncall = d
+	p.mu.Unlock()
+}
+
+// targetsLocked returns the names of the notifiers n goes to, or nil for
+// all of them, and the on-call schedules they address. A new problem starts
+// at the first escalation steps of its route, which it keeps until it
+// recovers; everything else about a routed problem goes to whoever it
+// reached. The caller must hold p.mu.
+func (p *Processor) targetsLocked(st *State, n *Notification) ([]string, []string) {
+	if p.router == nil {
+		return nil, nil
+	}
+
+	if n.Type == TypeProblem && !st.Notified {
+		steps := p.router.Route(n)
+		st.Routed = len(steps) > 0
+		st.Route = ""
+		st.Steps = nil
+		st.NotifiedAt = n.Time
+		st.Escalation = 0
+		st.Escalated = nil
+		st.OnCall = nil
+		if !st.Routed {
+			return nil, nil
+		}
+		st.Route = steps[0].Rule
+		st.Steps = steps
+		n.Route = st.Route
+
+		// Not nil even if the first step is delayed, which would mean
+		// every notifier.
+		targets, schedules, next := dueSteps(steps, 0, 0)
+		st.Escalation = next
+		st.Escalated = merge([]string{}, targets)
+		st.OnCall = schedules
+		return append([]string{}, st.Escalated...), st.OnCall
+	}
+
+	if st.Routed {
+		n.Route = st.Route
+		return append([]string{}, st.Escalated...), st.OnCall
+	}
+	if steps := p.router.Route(n); len(steps) > 0 {
+		n.Route = steps[0].Rule
+		targets, schedules, _ := dueSteps(steps, 0, 0)
+		return merge([]string{}, targets), schedules
+	}
+	return nil, nil
+}
+
+// dueSteps returns the notifiers and on-call schedules of the steps from
+// index i on that are due after elapsed, and the index of the first step
+// not due yet.
+func dueSteps(steps []Escalation, i int, elapsed time.Duration) ([]string, []string, int) {
+	var notifiers, schedules []string
+	for ; i < len(steps) && steps[i].After <= elapsed; i++ {
+		notifiers = append(notifiers, steps[i].Notifiers...)
+		schedules = merge(schedules, steps[i].OnCall)
+	}
+	return notifiers, schedules, i
+}
+
+// onCallUsersLocked returns the users on call for schedules at t. Schedules
+// that cannot be resolved are logged and skipped. The caller must hold p.mu.
+func (p *Processor) onCallUsersLocked(ctx context.Context, schedules []string, t time.Time) []string {
+	if len(schedules) == 0 {
+		return nil
+	}
+	if p.oncall == nil {
+		log.Printf("[WARN] alert: no on-call schedules to resolve %v", schedules)
+		return nil
+	}
+
+	var res []string
+	for _, id := range schedules {
+		users, err := p.oncall.Users(ctx, id, t)
+		if err != nil {
+			log.Printf("[WARN] alert: on-call schedule %s: %v", id, err)
+			continue
+		}
+		res = merge(res, users)
+	}
+	return res
+}
+
+// merge appends the names in add missing from list.
+func merge(list, add []string) []string {
+	for _, name := range add {
+		if !contains(list, name) {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Escalate notifies the problems left unacknowledged long enough for their
+// next escalation steps. A device that cannot be escalated is logged and
+// does not hold back the others.
+func (p *Processor) Escalate(ctx context.Context) error {
+	p.mu.RLock()
+	router := p.router
+	p.mu.RUnlock()
+	if router == nil {
+		return nil
+	}
+
+	devices, err := p.deviceRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		if err := p.escalate(ctx, d); err != nil {
+			log.Printf("[ERROR] alert: escalate device %s: %v", d.ID, err)
+		}
+	}
+	return nil
+}
+
+func (p *Processor) escalate(ctx context.Context, d *device.Device) error {
+	var (
+		dl       *delivery
+		fresh    []string
+		taken    int
+		previous State
+	)
+
+	p.mu.RLock()
+	now := p.clock.Now()
+	err := p.repo.UpdateState(ctx, d.ID, func(st *State) (*State, error) {
+		dl, fresh = nil, nil
+		if st == nil || !st.Problem || !st.Notified || !st.Routed || st.Ack.Active(now) || st.Flapping || st.Status == StatusUnreachable {
+			return nil, nil
+		}
+		previous = *st
+
+		// The problem follows the steps it was routed through, even if other
+		// rules would match by now.
+		_, schedules, next := dueSteps(st.Steps, st.Escalation, now.Sub(st.NotifiedAt))
+		if next == st.Escalation {
+			return nil, nil
+		}
+
+		var oncall []string
+		for _, id := range schedules {
+			if !contains(st.OnCall, id) {
+				oncall = append(oncall, id)
+			}
+		}
+		// Notifiers the problem reached already hear of it again only to
+		// address the users of more schedules.
+		for _, step := range st.Steps[st.Escalation:next] {
+			again := len(oncall) > 0 && len(step.OnCall) > 0
+			for _, name := range step.Notifiers {
+				if !contains(fresh, name) && (again || !contains(st.Escalated, name)) {
+					fresh = append(fresh, name)
+				}
+			}
+		}
+
+		if len(fresh) > 0 {
+			h, err := p.latestHealth(ctx, d, st)
+			if err != nil {
+				return nil, err
+			}
+			n := &Notification{
+				Type:   TypeProblem,
+				Device: d,
+				Health: h,
+				Since:  st.Since,
+				Time:   now,
+				Route:  st.Route,
+			}
+			if dl, err = p.prepareLocked(ctx, n, fresh, oncall); err != nil {
+				return nil, err
+			}
+			if dl == nil {
+				return nil, nil
+			}
+		}
+
+		// Taken unless the delivery fails, which is undone below.
+		st.Escalation = next
+		st.Escalated = merge(st.Escalated, fresh)
+		st.OnCall = merge(st.OnCall, oncall)
+		taken = next
+		return st, nil
+	})
+	p.mu.RUnlock()
+	if err != nil || dl == nil {
+		return err
+	}
+
+	if p.deliver(ctx, dl) {
+		log.Printf("[INFO] alert: problem of device %s escalated to %v", d.ID, fresh)
+		return nil
+	}
+	return p.repo.UpdateState(ctx, d.ID, func(st *State) (*State, error) {
+		if st == nil || !st.Routed || !st.NotifiedAt.Equal(previous.NotifiedAt) || st.Escalation != taken {
+			return nil, nil
+		}
+		st.Escalation = previous.Escalation
+		st.Escalated = previous.Escalated
+		st.OnCall = previous.OnCall
+		return st, nil
+	})
+}
+
+// latestHealth returns the stored result of d, or one with just the status
+// of st if there is none.
+func (p *Processor) latestHealth(ctx context.Context, d *device.Device, st *State) (*health.HealthStatus, error) {
+	if p.healthRepo != nil {
+		h, err := p.healthRepo.Get(ctx, d.ID)
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			return h, nil
+		}
+	}
+	return &health.HealthStatus{DeviceID: d.ID, Status: st.Status}, nil
+}
+
+// WatchEscalations runs Escalate every interval until ctx is done.
+func (p *Processor) WatchEscalations(ctx context.Context, every time.Duration) {
+	ticker := p.clock.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := p.Escalate(ctx); err != nil {
+				log.Printf("[ERROR] alert: escalate: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+)
+
+// stubRouter routes PROBLEMs of devices labelled team=db through steps.
+type stubRouter struct {
+	steps []Escalation
+}
+
+func (r stubRouter) Route(n *Notification) []Escalation {
+	if n.Device.Labels["team"] != "db" {
+		return nil
+	}
+	return r.steps
+}
+
+func TestEscalation(t *testing.T) {
+	db := &device.Device{ID: "db", Labels: map[string]string{"team": "db"}}
+	web := &device.Device{ID: "web"}
+	p, clk, all := newTestProcessor(db, web)
+	ctx := context.Background()
+
+	teamA, teamB, oncall := &recorder{name: "team_a"}, &recorder{name: "team_b"}, &recorder{name: "oncall"}
+	p.AddNotifier(teamA)
+	p.AddNotifier(teamB)
+	p.AddNotifier(oncall)
+	p.SetRenotifyInterval(0)
+	p.SetRouter(stubRouter{steps: []Escalation{
+		{Notifiers: []string{"team_a"}},
+		{After: 15 * time.Minute, Notifiers: []string{"team_b"}},
+		{After: 30 * time.Minute, Notifiers: []string{"oncall", "team_a"}},
+	}})
+
+	report(t, p, clk, "db", "DOWN")
+	teamA.expect(t, TypeProblem)
+	teamB.expect(t)
+
+	clk.Advance(14 * time.Minute)
+	if err := p.Escalate(ctx); err != nil {
+		t.Fatalf("Escalate: %v", err)
+	}
+	teamB.expect(t)
+
+	clk.Advance(time.Minute)
+	if err := p.Escalate(ctx); err != nil {
+		t.Fatalf("Escalate: %v", err)
+	}
+	if err := p.Escalate(ctx); err != nil {
+		t.Fatalf("Escalate: %v", err)
+	}
+	teamB.expect(t, TypeProblem)
+
+	// an acknowledged problem is not escalated further
+	if _, err := p.Acknowledge(ctx, "db", "bob", "on it", time.Time{}); err != nil {
+		t.Fatalf("Acknowledge: %v", err)
+	}
+	clk.Advance(time.Hour)
+	if err := p.Escalate(ctx); err != nil {
+		t.Fatalf("Escalate: %v", err)
+	}
+	oncall.expect(t)
+
+	// everyone who heard of the problem hears of its end
+	report(t, p, clk, "db", "UP")
+	teamA.expect(t, TypeProblem, TypeAcknowledgement, TypeRecovery)
+	teamB.expect(t, TypeProblem, TypeAcknowledgement, TypeRecovery)
+	oncall.expect(t)
+
+	// unrouted notifications go to every notifier
+	report(t, p, clk, "web", "DOWN")
+	all.expect(t, TypeProblem)
+	oncall.expect(t, TypeProblem)
+}
+
+// routerFunc routes through a function, e.g. one depending on the time.
+type routerFunc func(n *Notification) []Escalation
+
+func (f routerFunc) Route(n *Notification) []Escalation {
+	return f(n)
+}
+
+func TestDelayedFirstStepNotifiesNobodyYet(t *testing.T) {
+	db := &device.Device{ID: "db", Labels: map[string]string{"team": "db"}}
+	p, clk, all := newTestProcessor(db)
+	ctx := context.Background()
+
+	teamB := &recorder{name: "team_b"}
+	p.AddNotifier(teamB)
+	p.SetRenotifyInterval(0)
+	p.SetRouter(stubRouter{steps: []Escalation{
+		{After: 15 * time.Minute, Notifiers: []string{"team_b"}},
+	}})
+
+	report(t, p, clk, "db", "DOWN")
+	all.expect(t)
+	teamB.expect(t)
+
+	clk.Advance(15 * time.Minute)
+	if err := p.Escalate(ctx); err != nil {
+		t.Fatalf("Escalate: %v", err)
+	}
+	all.expect(t)
+	teamB.expect(t, TypeProblem)
+}
+
+func TestEscalationKeepsOriginalRoute(t *testing.T) {
+	db := &device.Device{ID: "db"}
+	p, clk, all := newTestProcessor(db)
+	ctx := context.Background()
+
+	teamA, teamB := &recorder{name: "team_a"}, &recorder{name: "team_b"}
+	p.AddNotifier(teamA)
+	p.AddNotifier(teamB)
+	p.SetRenotifyInterval(0)
+	healthRepo := &memHealth{}
+	p.SetHealthRepo(healthRepo)
+
+	// Business hours end five minutes after the problem starts.
+	start := clk.Now()
+	p.SetRouter(routerFunc(func(n *Notification) []Escalation {
+		if n.Time.Sub(start) < 5*time.Minute {
+			return []Escalation{
+				{Notifiers: []string{"team_a"}, Rule: "business-hours"},
+				{After: 15 * time.Minute, Notifiers: []string{"team_b"}, Rule: "business-hours"},
+			}
+		}
+		return []Escalation{{After: time.Hour, Notifiers: []string{"recorder"}, Rule: "night"}}
+	}))
+
+	report(t, p, clk, "db", "DOWN")
+	teamA.expect(t, TypeProblem)
+
+	clk.Advance(15 * time.Minute)
+	healthRepo.h = &health.HealthStatus{DeviceID: "db", Status: "DOWN", Latency: 42, LastCheck: clk.Now()}
+	if err := p.Escalate(ctx); err != nil {
+		t.Fatalf("Escalate: %v", err)
+	}
+	teamB.expect(t, TypeProblem)
+	all.expect(t)
+
+	n := teamB.sent[0]
+	if n.Route != "business-hours" || n.Health.Latency != 42 || !n.Health.LastCheck.Equal(clk.Now()) {
+		t.Fatalf("escalated notification lacks route or latest health: %+v %+v", n, n.Health)
+	}
+}
+
+// stubOnCall has users on call for schedules, as they are now.
+type stubOnCall map[string][]string
+
+func (s stubOnCall) Users(ctx context.Context, scheduleID string, t time.Time) ([]string, error) {
+	users, ok := s[scheduleID]
+	if !ok {
+		return nil, errors.New("unknown schedule")
+	}
+	return users, nil
+}
+
+func TestEscalationReachesOnCall(t *testing.T) {
+	db := &device.Device{ID: "db", Labels: map[string]string{"team": "db"}}
+	p, clk, _ := newTestProcessor(db)
+	ctx := context.Background()
+
+	mail := &recorder{name: "mail"}
+	p.AddNotifier(mail)
+	p.SetRenotifyInterval(0)
+	oncall := stubOnCall{"primary": {"alice"}, "secondary": {"carol"}}
+	p.SetOnCall(oncall)
+	p.SetRouter(stubRouter{steps: []Escalation{
+		{Notifiers: []string{"mail"}, OnCall: []string{"primary", "missing"}},
+		{After: 15 * time.Minute, Notifiers: []string{"mail"}, OnCall: []string{"secondary"}},
+	}})
+
+	report(t, p, clk, "db", "DOWN")
+	clk.Advance(15 * time.Minute)
+	if err := p.Escalate(ctx); err != nil {
+		t.Fatalf("Escalate: %v", err)
+	}
+	// The recovery reaches whoever is on call by then.
+	oncall["primary"] = []string{"bob"}
+	report(t, p, clk, "db", "UP")
+
+	mail.expect(t, TypeProblem, TypeProblem, TypeRecovery)
+	want := [][]string{{"alice"}, {"carol"}, {"bob", "carol"}}
+	for i, n := range mail.sent {
+		if strings.Join(n.OnCall, ",") != strings.Join(want[i], ",") {
+			t.Errorf("%s #%d on call = %v, want %v", n.Type, i, n.OnCall, want[i])
+		}
+	}
+}
+
+type memHealth struct {
+	h *health.HealthStatus
+}
+
+func (r *memHealth) Get(ctx context.Context, deviceID string) (*health.HealthStatus, error) {
+	if r.h == nil || r.h.DeviceID != deviceID {
+		return nil, nil
+	}
+	return r.h, nil
+}
+
+func (r *memHealth) Save(ctx context.Context, h *health.HealthStatus, ttl time.Duration) error {
+	r.h = h
+	return nil
+}
+
+func (r *memHealth) Delete(ctx context.Context, deviceID string) error {
+	r.h = nil
+	return nil
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	compactionInterval = time.Hour
+	defaultRetention   = 30 * 24 * time.Hour
+)
+
+// commitFunc commits the commands fn queues in one transaction.
+type commitFunc func(ctx context.Context, fn func(pipe redis.Pipeliner) error) error
+
+// compactor removes the alert silences that ended more than retention ago.
+// Maintenance windows and on-call overrides are history too, but they are
+// kept: SLA reports exclude maintenance from any period asked for, and
+// overrides tell who was on call.
+type compactor struct {
+	alerts    *alert.RedisRepository
+	retention time.Duration
+}
+
+// newCompactorFromEnv takes the retention from HISTORY_RETENTION_DAYS
+// (default 30).
+func newCompactorFromEnv(client *redis.Client) *compactor {
+	retention := defaultRetention
+	if days, err := strconv.Atoi(os.Getenv("HISTORY_RETENTION_DAYS")); err == nil && days > 0 {
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+
+	return &compactor{
+		alerts:    alert.NewRedisRepository(client),
+		retention: retention,
+	}
+}
+
+// Watch compacts the history now and every interval until ctx is done.
+func (c *compactor) Watch(ctx context.Context, every time.Duration, commit commitFunc) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Compact(ctx, time.Now(), commit); err != nil && ctx.Err() == nil {
+			log.Printf("[ERROR] history compaction: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Compact deletes the silences that ended before now minus the retention.
+func (c *compactor) Compact(ctx context.Context, now time.Time, commit commitFunc) error {
+	silences, err := c.alerts.EndedSilences(ctx, now.Add(-c.retention))
+	if err != nil || len(silences) == 0 {
+		return err
+	}
+
+	err = commit(ctx, func(pipe redis.Pipeliner) error {
+		c.alerts.DeleteSilencesIn(ctx, pipe, silences...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] history compaction: removed %d silences", len(silences))
+	return nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"github.com/Rin0913/monitor/internal/redisclient"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCompactionIsFenced(t *testing.T) {
+	if os.Getenv("REDIS_ADDR") == "" && os.Getenv("REDIS_URL") == "" {
+		t.Skip("redis not configured")
+	}
+
+	client := redisclient.NewTestClientFromEnv()
+	defer client.Close()
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis not reachable: %v", err)
+	}
+	client.Del(ctx, leaderKey, leaderTokenKey)
+	defer client.Del(ctx, leaderKey, leaderTokenKey)
+
+	c := newCompactorFromEnv(client)
+	now := time.Now()
+	old, recent := now.Add(-c.retention-time.Hour), now.Add(-time.Hour)
+
+	for _, s := range []*alert.Silence{
+		{ID: "compact-old", DeviceID: "web", StartsAt: old.Add(-time.Hour), EndsAt: old},
+		{ID: "compact-recent", DeviceID: "web", StartsAt: recent.Add(-time.Hour), EndsAt: recent},
+	} {
+		if err := c.alerts.SaveSilence(ctx, s); err != nil {
+			t.Fatalf("save silence: %v", err)
+		}
+		defer c.alerts.DeleteSilence(ctx, s.ID)
+	}
+
+	e := NewElector(client, "a", time.Minute)
+	e.campaign(ctx)
+	ok, token := e.IsLeader()
+	if !ok {
+		t.Fatalf("not elected")
+	}
+	fenced := func(token int64) commitFunc {
+		return func(ctx context.Context, fn func(pipe redis.Pipeliner) error) error {
+			return e.Fenced(ctx, token, fn)
+		}
+	}
+
+	// A replica holding an outdated token must not delete anything.
+	if err := c.Compact(ctx, now, fenced(token-1)); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("Compact with a stale token: %v, want ErrNotLeader", err)
+	}
+	if ids, _ := c.alerts.EndedSilences(ctx, now); len(ids) != 2 {
+		t.Fatalf("stale leader deleted silences: %v", ids)
+	}
+
+	if err := c.Compact(ctx, now, fenced(token)); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	ids, err := c.alerts.EndedSilences(ctx, now)
+	if err != nil {
+		t.Fatalf("list silences: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "compact-recent" {
+		t.Fatalf("unexpected silences after compaction: %v", ids)
+	}
+}
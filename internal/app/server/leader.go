@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	leaderKey      = "leader:server"
+	leaderTokenKey = "leader:server:token"
+)
+
+var ErrNotLeader = errors.New("not the leader")
+
+// acquireScript takes the lease if it is free and renews it if it is held
+// by ARGV[1]. It returns the fencing token of the holder, or nil if another
+// replica holds the lease. Every new lease increments the token.
+var acquireScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return tonumber(redis.call('GET', KEYS[2]))
+end
+if holder then
+	return false
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return redis.call('INCR', KEYS[2])
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Duty is work that must run on exactly one replica. It runs while the
+// replica leads and its context is canceled when the leadership is lost.
+// token is the fencing token of the leadership: duties whose writes must not
+// outlive it, like history compaction, commit them through Elector.Fenced.
+// Scheduler bootstrap and escalations may overlap with a successor, as they
+// only add missing jobs and update alert states by compare-and-set.
+//
+// Notifications of check results are not a duty: every result is processed
+// once, by the replica whose worker claimed its job or that received its
+// report, and the alert state of a device changes by compare-and-set, so a
+// change is notified by exactly one replica.
+type Duty func(ctx context.Context, token int64)
+
+// Elector elects one leader among the server replicas sharing a Redis, using
+// a lease that the leader renews every third of its TTL.
+type Elector struct {
+	client *redis.Client
+	id     string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	token   int64
+	renewed time.Time
+	leader  string
+	duties  []Duty
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewElector(client *redis.Client, id string, ttl time.Duration) *Elector {
+	return &Elector{
+		client: client,
+		id:     id,
+		ttl:    ttl,
+	}
+}
+
+// NewElectorFromEnv identifies the replica by SERVER_ID, or the host name
+// and pid, and takes the lease TTL from LEADER_LEASE_SEC (default 15).
+func NewElectorFromEnv(client *redis.Client) *Elector {
+	id := os.Getenv("SERVER_ID")
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	ttl := 15 * time.Second
+	if sec, err := strconv.Atoi(os.Getenv("LEADER_LEASE_SEC")); err == nil && sec > 0 {
+		ttl = time.Duration(sec) * time.Second
+	}
+
+	return NewElector(client, id, ttl)
+}
+
+// OnElected registers a duty started every time this replica becomes the
+// leader. Duties must be registered before Run.
+func (e *Elector) OnElected(d Duty) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.duties = append(e.duties, d)
+}
+
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this replica leads, with its fencing token.
+func (e *Elector) IsLeader() (bool, int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.token != 0, e.token
+}
+
+// Leader returns the replica holding the lease and its fencing token, or an
+// empty id if there is no leader.
+func (e *Elector) Leader(ctx context.Context) (string, int64, error) {
+	vals, err := e.client.MGet(ctx, leaderKey, leaderTokenKey).Result()
+	if err != nil {
+		return "", 0, err
+	}
+	id, _ := vals[0].(string)
+	if id == "" {
+		return "", 0, nil
+	}
+	s, _ := vals[1].(string)
+	token, _ := strconv.ParseInt(s, 10, 64)
+	return id, token, nil
+}
+
+// Run campaigns for the leadership until ctx is done, then gives it up.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) campaign(ctx context.Context) {
+	token, err := acquireScript.Run(ctx, e.client, []string{leaderKey, leaderTokenKey},
+		e.id, e.ttl.Milliseconds()).Int64()
+	if errors.Is(err, redis.Nil) {
+		token, err = 0, nil
+	}
+
+	leader := e.id
+	if err == nil && token == 0 {
+		leader, _, err = e.Leader(ctx)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[WARN] leader election: %v", err)
+		}
+		// The lease cannot be renewed, so another replica may take over
+		// once it expires.
+		if e.token != 0 && time.Since(e.renewed) >= e.ttl {
+			log.Printf("[WARN] leader election: %s lost the leadership (token %d)", e.id, e.token)
+			e.stopDutiesLocked()
+		}
+		return
+	}
+
+	if token != 0 {
+		e.renewed = time.Now()
+	}
+
+	if token != e.token {
+		if e.token != 0 {
+			log.Printf("[WARN] leader election: %s lost the leadership (token %d)", e.id, e.token)
+			e.stopDutiesLocked()
+		}
+		if token != 0 {
+			log.Printf("[INFO] leader election: %s is the leader (token %d)", e.id, token)
+			e.startDutiesLocked(ctx, token)
+		}
+	}
+
+	if token == 0 && leader != e.leader {
+		if leader == "" {
+			log.Printf("[INFO] leader election: no leader")
+		} else {
+			log.Printf("[INFO] leader election: %s follows %s", e.id, leader)
+		}
+	}
+	e.leader = leader
+}
+
+func (e *Elector) startDutiesLocked(ctx context.Context, token int64) {
+	dutyCtx, cancel := context.WithCancel(ctx)
+	e.token = token
+	e.cancel = cancel
+
+	for _, d := range e.duties {
+		e.wg.Add(1)
+		go func(d Duty) {
+			defer e.wg.Done()
+			d(dutyCtx, token)
+		}(d)
+	}
+}
+
+func (e *Elector) stopDutiesLocked() {
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	e.token = 0
+}
+
+func (e *Elector) resign() {
+	e.mu.Lock()
+	held := e.token != 0
+	e.stopDutiesLocked()
+	e.mu.Unlock()
+
+	e.wg.Wait()
+
+	if !held {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := releaseScript.Run(ctx, e.client, []string{leaderKey}, e.id).Err(); err != nil {
+		log.Printf("[WARN] leader election: release lease: %v", err)
+		return
+	}
+	log.Printf("[INFO] leader election: %s resigned", e.id)
+}
+
+// Fenced runs fn in a transaction that only commits while token is still
+// the current fencing token, so a replica that lost the leadership without
+// noticing cannot overwrite the work of its successor.
+func (e *Elector) Fenced(ctx context.Context, token int64, fn func(pipe redis.Pipeliner) error) error {
+	return e.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, leaderTokenKey).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if current != token {
+			return ErrNotLeader
+		}
+
+		_, err = tx.TxPipelined(ctx, fn)
+		if errors.Is(err, redis.TxFailedErr) {
+			return ErrNotLeader
+		}
+		return err
+	}, leaderTokenKey)
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/redisclient"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestElectorFailover(t *testing.T) {
+	if os.Getenv("REDIS_ADDR") == "" && os.Getenv("REDIS_URL") == "" {
+		t.Skip("redis not configured")
+	}
+
+	client := redisclient.NewTestClientFromEnv()
+	defer client.Close()
+	bg := context.Background()
+	client.Del(bg, leaderKey, leaderTokenKey)
+	defer client.Del(bg, leaderKey, leaderTokenKey)
+
+	var running atomic.Int32
+	duty := func(ctx context.Context, token int64) {
+		running.Add(1)
+		<-ctx.Done()
+		running.Add(-1)
+	}
+
+	a := NewElector(client, "a", 300*time.Millisecond)
+	b := NewElector(client, "b", 300*time.Millisecond)
+	a.OnElected(duty)
+	b.OnElected(duty)
+
+	ctxA, stopA := context.WithCancel(bg)
+	doneA := make(chan struct{})
+	go func() { defer close(doneA); a.Run(ctxA) }()
+
+	waitFor(t, func() bool { ok, _ := a.IsLeader(); return ok })
+
+	ctxB, stopB := context.WithCancel(bg)
+	defer stopB()
+	go b.Run(ctxB)
+
+	time.Sleep(400 * time.Millisecond)
+	if ok, _ := b.IsLeader(); ok {
+		t.Fatalf("two leaders")
+	}
+	if n := running.Load(); n != 1 {
+		t.Fatalf("duty running on %d replicas", n)
+	}
+
+	_, tokenA := a.IsLeader()
+	if id, token, err := b.Leader(bg); err != nil || id != "a" || token != tokenA {
+		t.Fatalf("Leader() = %q, %d, %v; want a, %d", id, token, err, tokenA)
+	}
+
+	stopA()
+	<-doneA
+
+	waitFor(t, func() bool { ok, _ := b.IsLeader(); return ok })
+	_, tokenB := b.IsLeader()
+	if tokenB <= tokenA {
+		t.Fatalf("fencing token did not grow: %d -> %d", tokenA, tokenB)
+	}
+
+	// the former leader is fenced off
+	write := func(pipe redis.Pipeliner) error {
+		pipe.Set(bg, "leader:test", "x", time.Second)
+		return nil
+	}
+	if err := a.Fenced(bg, tokenA, write); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("stale token accepted: %v", err)
+	}
+	if err := b.Fenced(bg, tokenB, write); err != nil {
+		t.Fatalf("fenced write: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
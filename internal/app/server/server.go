@@ -4,18 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/Rin0913/monitor/internal/alert"
 	"github.com/Rin0913/monitor/internal/httpserver"
+	"github.com/Rin0913/monitor/internal/notify"
 	"github.com/Rin0913/monitor/internal/redisclient"
+	"github.com/Rin0913/monitor/internal/routing"
 	"github.com/Rin0913/monitor/internal/worker"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	overloadCheckInterval   = 15 * time.Second
+	escalationCheckInterval = 30 * time.Second
 )
 
 func Run(ctx context.Context, workerNum int) error {
 	redisClient := redisclient.NewClientFromEnv()
 	httpServer := httpserver.NewServer(redisClient)
+	defer httpServer.Close()
 
 	mux := http.NewServeMux()
 	httpServer.RegisterRoutes(mux)
@@ -29,8 +40,40 @@ func Run(ctx context.Context, workerNum int) error {
 		MaxHeaderBytes: 1 << 20,
 	}
 
+	notifiers, templates, err := notify.LoadConfig("notifiers.yaml")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("[ERROR] load notifiers.yaml: %v", err)
+	}
+	httpServer.SetTemplates(templates)
+	for _, n := range notifiers {
+		if smtp, ok := n.(*notify.SMTPNotifier); ok {
+			smtp.SetOnCall(httpServer.OnCall())
+		}
+		httpServer.Alerts().AddNotifier(n)
+		log.Printf("[INFO] notifier %s loaded", n.Name())
+	}
+
+	router, err := routing.LoadConfig("notifiers.yaml")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("[ERROR] load routing from notifiers.yaml: %v", err)
+	}
+	if router != nil {
+		for _, name := range router.Notifiers() {
+			if !hasNotifier(notifiers, name) {
+				log.Printf("[WARN] routing refers to unknown notifier %s", name)
+			}
+		}
+		if templates != nil {
+			if err := router.SetTemplates(templates); err != nil {
+				log.Printf("[ERROR] load routing templates: %v", err)
+			}
+		}
+		httpServer.SetRouting(router)
+	}
+
 	engine := worker.NewEngine()
 	_ = engine.LoadConfig("checkers.yaml")
+	defer engine.Close()
 
 	manager := worker.NewManager(workerNum, 2*time.Second, func(id int) worker.Worker {
 		return worker.NewInternalWorker(
@@ -38,12 +81,53 @@ func Run(ctx context.Context, workerNum int) error {
 			engine,
 			httpServer.HealthRepo(),
 			httpServer.Scheduler(),
+			httpServer.Alerts(),
 		)
 	})
 
 	manager.Start(ctx)
 	defer manager.Stop()
 
+	elector := NewElectorFromEnv(redisClient)
+	compactor := newCompactorFromEnv(redisClient)
+	if sched := httpServer.Scheduler(); sched.Shared() {
+		elector.OnElected(func(ctx context.Context, token int64) {
+			if err := sched.Bootstrap(ctx); err != nil {
+				log.Printf("[ERROR] scheduler bootstrap: %v", err)
+			}
+		})
+		elector.OnElected(func(ctx context.Context, token int64) {
+			sched.WatchOverload(ctx, overloadCheckInterval)
+		})
+		elector.OnElected(func(ctx context.Context, token int64) {
+			httpServer.Alerts().WatchEscalations(ctx, escalationCheckInterval)
+		})
+		elector.OnElected(func(ctx context.Context, token int64) {
+			compactor.Watch(ctx, compactionInterval, func(ctx context.Context, fn func(pipe redis.Pipeliner) error) error {
+				return elector.Fenced(ctx, token, fn)
+			})
+		})
+	} else {
+		go sched.WatchOverload(ctx, overloadCheckInterval)
+		go httpServer.Alerts().WatchEscalations(ctx, escalationCheckInterval)
+		go compactor.Watch(ctx, compactionInterval, func(ctx context.Context, fn func(pipe redis.Pipeliner) error) error {
+			_, err := redisClient.TxPipelined(ctx, fn)
+			return err
+		})
+	}
+	httpServer.SetLeaderInfo(elector)
+
+	electorDone := make(chan struct{})
+	electorCtx, stopElector := context.WithCancel(ctx)
+	go func() {
+		defer close(electorDone)
+		elector.Run(electorCtx)
+	}()
+	defer func() {
+		stopElector()
+		<-electorDone
+	}()
+
 	errCh := make(chan error, 1)
 
 	go func() {
@@ -68,3 +152,12 @@ func Run(ctx context.Context, workerNum int) error {
 		return err
 	}
 }
+
+func hasNotifier(notifiers []alert.Notifier, name string) bool {
+	for _, n := range notifiers {
+		if n.Name() == name {
+			return true
+		}
+	}
+	return false
+}
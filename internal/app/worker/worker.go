@@ -12,6 +12,7 @@ import (
 func Run(ctx context.Context, serverURL string, workerID string, workerKey string, workerNum int) error {
 	engine := worker.NewEngine()
 	_ = engine.LoadConfig("checkers.yaml")
+	defer engine.Close()
 
 	manager := worker.NewManager(workerNum, 2*time.Second, func(id int) worker.Worker {
 		return worker.NewRemoteWorker(
@@ -0,0 +1,66 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeFiresTimersInOrder(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	late := f.NewTimer(2 * time.Second)
+	early := f.After(time.Second)
+	ticker := f.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	f.Advance(999 * time.Millisecond)
+	select {
+	case <-early:
+		t.Fatalf("timer fired early")
+	default:
+	}
+
+	f.Advance(time.Millisecond)
+	if got := <-early; !got.Equal(start.Add(time.Second)) {
+		t.Fatalf("timer fired at %v", got)
+	}
+	<-ticker.C()
+
+	if !late.Stop() {
+		t.Fatalf("pending timer not stopped")
+	}
+	f.Advance(5 * time.Second)
+	select {
+	case <-late.C():
+		t.Fatalf("stopped timer fired")
+	default:
+	}
+
+	// a ticker that fell behind fires once and keeps its period
+	if got := <-ticker.C(); !got.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("ticker fired at %v", got)
+	}
+	f.Advance(time.Second)
+	if got := <-ticker.C(); !got.Equal(start.Add(7 * time.Second)) {
+		t.Fatalf("ticker fired at %v", got)
+	}
+}
+
+func TestFakeSleepWaitsForAdvance(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+
+	done := make(chan struct{})
+	go func() {
+		f.Sleep(time.Minute)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	<-done
+
+	if f.Waiters() != 0 {
+		t.Fatalf("sleep left %d waiters", f.Waiters())
+	}
+}
@@ -0,0 +1,126 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse("2006-01-02 15:04 Mon", s)
+	if err != nil {
+		t.Fatalf("parse %q: %v", s, err)
+	}
+	return v
+}
+
+func TestNext(t *testing.T) {
+	cases := []struct {
+		expr, from, want string
+	}{
+		{"*/5 9-18 * * MON-FRI", "2026-10-16 08:58 Fri", "2026-10-16 09:00 Fri"},
+		{"*/5 9-18 * * MON-FRI", "2026-10-16 09:00 Fri", "2026-10-16 09:05 Fri"},
+		{"*/5 9-18 * * MON-FRI", "2026-10-16 18:55 Fri", "2026-10-19 09:00 Mon"},
+		{"0 2 * * *", "2026-10-16 02:00 Fri", "2026-10-17 02:00 Sat"},
+		{"30 4 1,15 * *", "2026-10-16 00:00 Fri", "2026-11-01 04:30 Sun"},
+		{"0 0 * * 7", "2026-10-16 00:00 Fri", "2026-10-18 00:00 Sun"},
+		{"0 0 13 * FRI", "2026-10-10 00:00 Sat", "2026-10-13 00:00 Tue"},
+		{"0 0 29 FEB *", "2026-03-01 00:00 Sun", "2028-02-29 00:00 Tue"},
+		{"@hourly", "2026-10-16 10:15 Fri", "2026-10-16 11:00 Fri"},
+		{"10-20/5 * * * *", "2026-10-16 10:16 Fri", "2026-10-16 10:20 Fri"},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		got := s.Next(mustTime(t, c.from))
+		if want := mustTime(t, c.want); !got.Equal(want) {
+			t.Fatalf("%s from %s: got %s, want %s", c.expr, c.from, got.Format("2006-01-02 15:04 Mon"), c.want)
+		}
+	}
+}
+
+func TestNextInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	if err != nil {
+		t.Skipf("tzdata not available: %v", err)
+	}
+
+	s, _ := Parse("0 9 * * *")
+	from := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC) // 08:00 in Taipei
+	got := s.Next(from.In(loc))
+	if want := time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got.UTC(), want)
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Fatalf("expected zero time, got %v", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * * FUNDAY"} {
+		if _, err := Parse(expr); err == nil {
+			t.Fatalf("%q should not parse", expr)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	business, err := ParseWindow("09:00", "18:00", []string{"MON-FRI"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	overnight, err := ParseWindow("22:00", "02:00", []string{"SAT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contains := []struct {
+		w    *Window
+		at   string
+		want bool
+	}{
+		{business, "2026-10-16 09:00 Fri", true},
+		{business, "2026-10-16 17:59 Fri", true},
+		{business, "2026-10-16 18:00 Fri", false},
+		{business, "2026-10-17 12:00 Sat", false},
+		{overnight, "2026-10-17 23:00 Sat", true},
+		{overnight, "2026-10-18 01:00 Sun", true},
+		{overnight, "2026-10-18 23:00 Sun", false},
+		{overnight, "2026-10-17 01:00 Sat", false},
+	}
+	for _, c := range contains {
+		if got := c.w.Contains(mustTime(t, c.at)); got != c.want {
+			t.Fatalf("Contains(%s) = %v, want %v", c.at, got, c.want)
+		}
+	}
+
+	next := []struct {
+		w        *Window
+		at, want string
+	}{
+		{business, "2026-10-16 10:00 Fri", "2026-10-16 10:00 Fri"},
+		{business, "2026-10-16 18:30 Fri", "2026-10-19 09:00 Mon"},
+		{overnight, "2026-10-16 12:00 Fri", "2026-10-17 22:00 Sat"},
+	}
+	for _, c := range next {
+		if got := c.w.NextStart(mustTime(t, c.at)); !got.Equal(mustTime(t, c.want)) {
+			t.Fatalf("NextStart(%s) = %s, want %s", c.at, got.Format("2006-01-02 15:04 Mon"), c.want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"9", "18:00"}, {"25:00", "18:00"}, {"09:00", "18:60"}} {
+		if _, err := ParseWindow(bad[0], bad[1], nil); err == nil {
+			t.Fatalf("%v should not parse", bad)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily time-of-day window such as 09:00-18:00 on MON-FRI,
+// evaluated in the location of the times passed to it. A window whose end is
+// before its start spans midnight; Days then refers to the day it starts.
+type Window struct {
+	start, end int // minutes since midnight
+	days       uint64
+}
+
+func ParseWindow(start, end string, days []string) (*Window, error) {
+	w := &Window{}
+
+	var err error
+	if w.start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if w.end, err = parseClock(end); err != nil {
+		return nil, err
+	}
+
+	if len(days) == 0 {
+		w.days = 0x7f
+	}
+	for _, d := range days {
+		v, err := parseField(d, dows)
+		if err != nil {
+			return nil, err
+		}
+		w.days |= v
+	}
+	if w.days&(1<<7) != 0 {
+		w.days |= 1
+	}
+
+	return w, nil
+}
+
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("cron: invalid time of day %q", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("cron: invalid time of day %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func (w *Window) dayAllowed(t time.Time) bool {
+	return w.days&(1<<uint(t.Weekday())) != 0
+}
+
+// Contains reports whether t falls inside the window.
+func (w *Window) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+
+	switch {
+	case w.start == w.end:
+		return w.dayAllowed(t)
+	case w.start < w.end:
+		return w.dayAllowed(t) && m >= w.start && m < w.end
+	default:
+		yesterday := t.AddDate(0, 0, -1)
+		return (w.dayAllowed(t) && m >= w.start) || (w.dayAllowed(yesterday) && m < w.end)
+	}
+}
+
+// NextStart returns the first time not before t at which the window is
+// open. It returns t itself when t is inside the window.
+func (w *Window) NextStart(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+
+	loc := t.Location()
+	for i := 0; i <= 7; i++ {
+		day := t.AddDate(0, 0, i)
+		start := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, loc)
+		if !start.Before(t) && w.dayAllowed(start) {
+			return start
+		}
+	}
+
+	return time.Time{}
+}
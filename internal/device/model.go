@@ -6,4 +6,39 @@ type Device struct {
 	Name        string `json:"name"`
 	CheckMethod string `json:"check_method"`
 	IntervalSec int    `json:"interval_sec"`
+	TimeoutSec  int    `json:"timeout_sec,omitempty"`
+
+	// Labels are free-form key/value pairs used to select devices, e.g.
+	// by silences.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Parents are the devices this one is reached through. While all of
+	// them are in a hard DOWN or UNREACHABLE state, failures of this device
+	// are recorded as UNREACHABLE and not notified.
+	Parents []string `json:"parents,omitempty"`
+
+	// MaxCheckAttempts is how many consecutive failed checks a problem
+	// stays SOFT before it becomes HARD and is notified (1 if unset).
+	MaxCheckAttempts int `json:"max_check_attempts,omitempty"`
+
+	// RetryIntervalSec replaces IntervalSec while the device is not UP,
+	// doubling on each further failure up to MaxRetryIntervalSec. While the
+	// device stays UP its interval may grow up to MaxIntervalSec.
+	RetryIntervalSec    int `json:"retry_interval_sec,omitempty"`
+	MaxRetryIntervalSec int `json:"max_retry_interval_sec,omitempty"`
+	MaxIntervalSec      int `json:"max_interval_sec,omitempty"`
+
+	// Cron and ActiveWindow are mutually exclusive calendar schedules,
+	// evaluated in Timezone (UTC if empty). With Cron the device is checked
+	// at the cron times; with ActiveWindow it is checked every IntervalSec
+	// while the window is open.
+	Cron         string      `json:"cron,omitempty"`
+	ActiveWindow *TimeWindow `json:"active_window,omitempty"`
+	Timezone     string      `json:"timezone,omitempty"`
+}
+
+type TimeWindow struct {
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Days  []string `json:"days,omitempty"`
 }
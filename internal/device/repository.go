@@ -3,8 +3,12 @@ package device
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
+	"github.com/Rin0913/monitor/internal/cron"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
@@ -13,6 +17,15 @@ const (
 	deviceIDsKey        = "device:ids"
 	deviceIDKeyPrefix   = "device:id:"
 	deviceAddrKeyPrefix = "device:addr:"
+
+	// maxWatchRetries bounds how often a write retries when the devices it
+	// depends on change under it.
+	maxWatchRetries = 10
+)
+
+var (
+	ErrUnknownParent   = errors.New("device: unknown parent")
+	ErrDependencyCycle = errors.New("device: dependency cycle")
 )
 
 type Repository interface {
@@ -32,6 +45,29 @@ func NewRedisRepository(client *redis.Client) *RedisRepository {
 	}
 }
 
+// ValidateSchedule checks the calendar schedule fields of d.
+func ValidateSchedule(d *Device) error {
+	if d.Cron != "" && d.ActiveWindow != nil {
+		return fmt.Errorf("device: cron and active_window are mutually exclusive")
+	}
+	if d.Cron != "" {
+		if _, err := cron.Parse(d.Cron); err != nil {
+			return fmt.Errorf("device: %w", err)
+		}
+	}
+	if w := d.ActiveWindow; w != nil {
+		if _, err := cron.ParseWindow(w.Start, w.End, w.Days); err != nil {
+			return fmt.Errorf("device: %w", err)
+		}
+	}
+	if d.Timezone != "" {
+		if _, err := time.LoadLocation(d.Timezone); err != nil {
+			return fmt.Errorf("device: invalid timezone %q", d.Timezone)
+		}
+	}
+	return nil
+}
+
 func (r *RedisRepository) idKey(id string) string {
 	return deviceIDKeyPrefix + id
 }
@@ -45,6 +81,10 @@ func (r *RedisRepository) List(ctx context.Context) ([]*Device, error) {
 	if err != nil {
 		return nil, err
 	}
+	return r.getAll(ctx, r.client, ids)
+}
+
+func (r *RedisRepository) getAll(ctx context.Context, c redis.Cmdable, ids []string) ([]*Device, error) {
 	if len(ids) == 0 {
 		return []*Device{}, nil
 	}
@@ -54,7 +94,7 @@ func (r *RedisRepository) List(ctx context.Context) ([]*Device, error) {
 		keys[i] = r.idKey(id)
 	}
 
-	values, err := r.client.MGet(ctx, keys...).Result()
+	values, err := c.MGet(ctx, keys...).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +117,37 @@ func (r *RedisRepository) List(ctx context.Context) ([]*Device, error) {
 	return res, nil
 }
 
+// watchAll lists the devices inside tx and watches all of them, so the
+// transaction fails if any device is saved or deleted meanwhile.
+func (r *RedisRepository) watchAll(ctx context.Context, tx *redis.Tx) ([]*Device, error) {
+	ids, err := tx.SMembers(ctx, deviceIDsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = r.idKey(id)
+	}
+	if len(keys) > 0 {
+		if err := tx.Watch(ctx, keys...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return r.getAll(ctx, tx, ids)
+}
+
+// watch runs fn in a transaction watching keys and retries it while other
+// writers get in the way.
+func (r *RedisRepository) watch(ctx context.Context, id string, fn func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxWatchRetries; i++ {
+		err := r.client.Watch(ctx, fn, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("device: %s keeps changing", id)
+}
+
 func (r *RedisRepository) GetByID(ctx context.Context, id string) (*Device, error) {
 	if id == "" {
 		return nil, fmt.Errorf("device: empty id")
@@ -105,74 +176,171 @@ func (r *RedisRepository) Save(ctx context.Context, d *Device) error {
 	if d.IntervalSec <= 0 {
 		return fmt.Errorf("device: invalid interval_sec")
 	}
+	if d.TimeoutSec < 0 || (d.TimeoutSec > 0 && d.TimeoutSec >= d.IntervalSec) {
+		return fmt.Errorf("device: invalid timeout_sec")
+	}
+	if d.RetryIntervalSec < 0 || d.MaxRetryIntervalSec < 0 || d.MaxIntervalSec < 0 {
+		return fmt.Errorf("device: invalid adaptive interval")
+	}
+	if d.MaxCheckAttempts < 0 {
+		return fmt.Errorf("device: invalid max_check_attempts")
+	}
+	if err := ValidateSchedule(d); err != nil {
+		return err
+	}
 	if d.ID == "" {
 		d.ID = uuid.NewString()
 	}
 
-	key := r.idKey(d.ID)
-
-	var old Device
-	oldAddress := ""
-	existing, err := r.client.Get(ctx, key).Result()
-	if err != nil && err != redis.Nil {
+	b, err := json.Marshal(d)
+	if err != nil {
 		return err
 	}
-	if err == nil {
-		if err := json.Unmarshal([]byte(existing), &old); err != nil {
+	key := r.idKey(d.ID)
+
+	// The parents are checked in the transaction that stores d, so two
+	// concurrent saves cannot close a cycle between them.
+	save := func(tx *redis.Tx) error {
+		if err := r.checkParents(ctx, tx, d); err != nil {
+			return err
+		}
+
+		var old Device
+		oldAddress := ""
+		existing, err := tx.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
 			return err
 		}
-		oldAddress = old.Address
+		if err == nil {
+			if err := json.Unmarshal([]byte(existing), &old); err != nil {
+				return err
+			}
+			oldAddress = old.Address
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, b, 0)
+			pipe.SAdd(ctx, deviceIDsKey, d.ID)
+
+			if d.Address != "" {
+				pipe.SAdd(ctx, r.addrKey(d.Address), d.ID)
+			}
+
+			if oldAddress != "" && oldAddress != d.Address {
+				pipe.SRem(ctx, r.addrKey(oldAddress), d.ID)
+			}
+			return nil
+		})
+		return err
 	}
 
-	b, err := json.Marshal(d)
+	return r.watch(ctx, d.ID, save, deviceIDsKey, key)
+}
+
+// checkParents makes sure the parents of d exist and that d does not end up
+// among its own ancestors. It watches the devices it reads on tx.
+func (r *RedisRepository) checkParents(ctx context.Context, tx *redis.Tx, d *Device) error {
+	if len(d.Parents) == 0 {
+		return nil
+	}
+
+	devices, err := r.watchAll(ctx, tx)
 	if err != nil {
 		return err
 	}
+	byID := make(map[string]*Device, len(devices)+1)
+	for _, dev := range devices {
+		byID[dev.ID] = dev
+	}
+	byID[d.ID] = d
 
-	pipe := r.client.TxPipeline()
+	for _, id := range d.Parents {
+		if byID[id] == nil {
+			return fmt.Errorf("%w %s", ErrUnknownParent, id)
+		}
+	}
 
-	pipe.Set(ctx, key, b, 0)
-	pipe.SAdd(ctx, deviceIDsKey, d.ID)
+	visited := make(map[string]bool)
+	var visit func(id string) error
+	visit = func(id string) error {
+		if id == d.ID {
+			return fmt.Errorf("%w through %s", ErrDependencyCycle, d.ID)
+		}
+		if visited[id] {
+			return nil
+		}
+		visited[id] = true
 
-	if d.Address != "" {
-		pipe.SAdd(ctx, r.addrKey(d.Address), d.ID)
+		if dev := byID[id]; dev != nil {
+			for _, p := range dev.Parents {
+				if err := visit(p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
 	}
 
-	if oldAddress != "" && oldAddress != d.Address {
-		pipe.SRem(ctx, r.addrKey(oldAddress), d.ID)
+	for _, id := range d.Parents {
+		if err := visit(id); err != nil {
+			return err
+		}
 	}
-
-	_, err = pipe.Exec(ctx)
-	return err
+	return nil
 }
 
+// DeleteByID deletes a device and removes it from the parents of its
+// children, so none of them is left depending on a device that is gone.
 func (r *RedisRepository) DeleteByID(ctx context.Context, id string) error {
 	if id == "" {
 		return fmt.Errorf("device: empty id")
 	}
-
 	key := r.idKey(id)
-	s, err := r.client.Get(ctx, key).Result()
-	if err == redis.Nil {
-		return nil
-	}
-	if err != nil {
-		return err
-	}
 
-	var d Device
-	if err := json.Unmarshal([]byte(s), &d); err != nil {
-		return err
-	}
+	del := func(tx *redis.Tx) error {
+		s, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 
-	pipe := r.client.TxPipeline()
+		var d Device
+		if err := json.Unmarshal([]byte(s), &d); err != nil {
+			return err
+		}
 
-	pipe.Del(ctx, key)
-	pipe.SRem(ctx, deviceIDsKey, id)
-	if d.Address != "" {
-		pipe.SRem(ctx, r.addrKey(d.Address), id)
+		devices, err := r.watchAll(ctx, tx)
+		if err != nil {
+			return err
+		}
+		children := make(map[string][]byte)
+		for _, child := range devices {
+			if !slices.Contains(child.Parents, id) {
+				continue
+			}
+			child.Parents = slices.DeleteFunc(child.Parents, func(p string) bool { return p == id })
+			b, err := json.Marshal(child)
+			if err != nil {
+				return err
+			}
+			children[child.ID] = b
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.SRem(ctx, deviceIDsKey, id)
+			if d.Address != "" {
+				pipe.SRem(ctx, r.addrKey(d.Address), id)
+			}
+			for childID, b := range children {
+				pipe.Set(ctx, r.idKey(childID), b, 0)
+			}
+			return nil
+		})
+		return err
 	}
 
-	_, err = pipe.Exec(ctx)
-	return err
+	return r.watch(ctx, id, del, deviceIDsKey, key)
 }
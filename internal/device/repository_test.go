@@ -0,0 +1,136 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Rin0913/monitor/internal/redisclient"
+)
+
+// newTestRepository returns a repository on the test database and removes
+// the devices with the given IDs before and after the test.
+func newTestRepository(t *testing.T, ids ...string) *RedisRepository {
+	t.Helper()
+
+	if os.Getenv("REDIS_ADDR") == "" && os.Getenv("REDIS_URL") == "" {
+		t.Skip("redis not configured")
+	}
+
+	client := redisclient.NewTestClientFromEnv()
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis not reachable: %v", err)
+	}
+
+	repo := NewRedisRepository(client)
+	cleanup := func() {
+		for _, id := range ids {
+			_ = repo.DeleteByID(ctx, id)
+		}
+	}
+	cleanup()
+	t.Cleanup(func() {
+		cleanup()
+		client.Close()
+	})
+
+	return repo
+}
+
+func TestSaveRejectsDependencyCycles(t *testing.T) {
+	repo := newTestRepository(t, "router", "switch", "web")
+	ctx := context.Background()
+
+	router := &Device{ID: "router", Address: "10.0.0.1", IntervalSec: 10}
+	sw := &Device{ID: "switch", Address: "10.0.1.1", IntervalSec: 10, Parents: []string{"router"}}
+	web := &Device{ID: "web", Address: "10.0.1.10", IntervalSec: 10, Parents: []string{"switch", "router"}}
+	for _, d := range []*Device{router, sw, web} {
+		if err := repo.Save(ctx, d); err != nil {
+			t.Fatalf("Save %s: %v", d.ID, err)
+		}
+	}
+
+	if err := repo.Save(ctx, &Device{Address: "x", IntervalSec: 10, Parents: []string{"missing"}}); !errors.Is(err, ErrUnknownParent) {
+		t.Fatalf("unknown parent: %v", err)
+	}
+
+	self := &Device{ID: "router", Address: "10.0.0.1", IntervalSec: 10, Parents: []string{"router"}}
+	if err := repo.Save(ctx, self); !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("self parent: %v", err)
+	}
+
+	router.Parents = []string{"web"}
+	if err := repo.Save(ctx, router); !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got, _ := repo.GetByID(ctx, "router"); len(got.Parents) != 0 {
+		t.Fatalf("rejected save was stored: %+v", got)
+	}
+}
+
+func TestConcurrentSavesCannotCloseACycle(t *testing.T) {
+	repo := newTestRepository(t, "a", "b")
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		a := &Device{ID: "a", Address: "10.0.0.1", IntervalSec: 10}
+		b := &Device{ID: "b", Address: "10.0.0.2", IntervalSec: 10}
+		for _, d := range []*Device{a, b} {
+			if err := repo.Save(ctx, d); err != nil {
+				t.Fatalf("Save %s: %v", d.ID, err)
+			}
+		}
+
+		a.Parents, b.Parents = []string{"b"}, []string{"a"}
+		var wg sync.WaitGroup
+		for _, d := range []*Device{a, b} {
+			wg.Add(1)
+			go func(d *Device) {
+				defer wg.Done()
+				if err := repo.Save(ctx, d); err != nil && !errors.Is(err, ErrDependencyCycle) {
+					t.Errorf("Save %s: %v", d.ID, err)
+				}
+			}(d)
+		}
+		wg.Wait()
+
+		gotA, _ := repo.GetByID(ctx, "a")
+		gotB, _ := repo.GetByID(ctx, "b")
+		if len(gotA.Parents) > 0 && len(gotB.Parents) > 0 {
+			t.Fatalf("cycle stored: %v, %v", gotA.Parents, gotB.Parents)
+		}
+	}
+}
+
+func TestDeleteByIDDetachesChildren(t *testing.T) {
+	repo := newTestRepository(t, "router", "switch", "web")
+	ctx := context.Background()
+
+	for _, d := range []*Device{
+		{ID: "router", Address: "10.0.0.1", IntervalSec: 10},
+		{ID: "switch", Address: "10.0.1.1", IntervalSec: 10, Parents: []string{"router"}},
+		{ID: "web", Address: "10.0.1.10", IntervalSec: 10, Parents: []string{"switch", "router"}},
+	} {
+		if err := repo.Save(ctx, d); err != nil {
+			t.Fatalf("Save %s: %v", d.ID, err)
+		}
+	}
+
+	if err := repo.DeleteByID(ctx, "switch"); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	web, err := repo.GetByID(ctx, "web")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if len(web.Parents) != 1 || web.Parents[0] != "router" {
+		t.Fatalf("parents of web = %v, want [router]", web.Parents)
+	}
+	if sw, _ := repo.GetByID(ctx, "switch"); sw != nil {
+		t.Fatalf("switch not deleted: %+v", sw)
+	}
+}
@@ -9,4 +9,11 @@ type HealthStatus struct {
 	LastCheck time.Time              `json:"last_check"`
 	Runner    string                 `json:"runner"`
 	Data      map[string]interface{} `json:"data,omitempty"`
+
+	// RequestID is the on-demand check request the result answers, if any.
+	RequestID string `json:"request_id,omitempty"`
+
+	// InMaintenance marks results taken during a maintenance window of the
+	// device.
+	InMaintenance bool `json:"in_maintenance,omitempty"`
 }
@@ -0,0 +1,118 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+)
+
+type ackRequest struct {
+	Author    string     `json:"author"`
+	Comment   string     `json:"comment"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ackDevice acknowledges the current problem of a device.
+func (s *Server) ackDevice(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	var req ackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Comment == "" {
+		http.Error(w, "missing comment", http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	dev, err := s.deviceRepo.GetByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return
+	}
+	if dev == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ack, err := s.alerts.Acknowledge(r.Context(), id, req.Author, req.Comment, expiresAt)
+	if errors.Is(err, alert.ErrNoProblem) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] acknowledge device %s: %v", id, err)
+		http.Error(w, "failed to acknowledge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ack)
+}
+
+func (s *Server) addSilence(w http.ResponseWriter, r *http.Request) {
+	var sil alert.Silence
+	if err := json.NewDecoder(r.Body).Decode(&sil); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	err := s.alerts.AddSilence(r.Context(), &sil)
+	if errors.Is(err, alert.ErrInvalidSilence) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] add silence: %v", err)
+		http.Error(w, "failed to add silence", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(sil)
+}
+
+func (s *Server) listSilences(w http.ResponseWriter, r *http.Request) {
+	silences, err := s.alerts.Silences(r.Context())
+	if err != nil {
+		http.Error(w, "failed to list silences", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(silences)
+}
+
+func (s *Server) deleteSilence(w http.ResponseWriter, r *http.Request) {
+	if err := s.alerts.DeleteSilence(r.Context(), r.PathValue("id")); err != nil {
+		http.Error(w, "failed to delete silence", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) registerAlertRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /devices/{id}/ack", s.ackDevice)
+	mux.HandleFunc("POST /silences", s.addSilence)
+	mux.HandleFunc("GET /silences", s.listSilences)
+	mux.HandleFunc("DELETE /silences/{id}", s.deleteSilence)
+}
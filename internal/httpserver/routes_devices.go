@@ -1,16 +1,37 @@
 package httpserver
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/Rin0913/monitor/internal/alert"
 	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+	"github.com/Rin0913/monitor/internal/scheduler"
 )
 
 type addDeviceRequest struct {
 	Address     string  `json:"address"`
 	CheckMethod *string `json:"check_method"`
 	IntervalSec *int    `json:"interval_sec"`
+	TimeoutSec  *int    `json:"timeout_sec"`
+
+	Labels map[string]string `json:"labels"`
+
+	Parents          []string `json:"parents"`
+	MaxCheckAttempts int      `json:"max_check_attempts"`
+
+	RetryIntervalSec    int `json:"retry_interval_sec"`
+	MaxRetryIntervalSec int `json:"max_retry_interval_sec"`
+	MaxIntervalSec      int `json:"max_interval_sec"`
+
+	Cron         string             `json:"cron"`
+	ActiveWindow *device.TimeWindow `json:"active_window"`
+	Timezone     string             `json:"timezone"`
 }
 
 func (s *Server) addDevice(w http.ResponseWriter, r *http.Request) {
@@ -48,14 +69,67 @@ func (s *Server) addDevice(w http.ResponseWriter, r *http.Request) {
 		interval = *req.IntervalSec
 	}
 
+	timeout := 0
+	if req.TimeoutSec != nil {
+		if *req.TimeoutSec <= 0 {
+			http.Error(w, "timeout_sec must be > 0", http.StatusBadRequest)
+			return
+		}
+		if *req.TimeoutSec >= interval {
+			http.Error(w, "timeout_sec must be < interval_sec", http.StatusBadRequest)
+			return
+		}
+		timeout = *req.TimeoutSec
+	}
+
+	if req.RetryIntervalSec < 0 || req.MaxRetryIntervalSec < 0 || req.MaxIntervalSec < 0 {
+		http.Error(w, "adaptive intervals must be >= 0", http.StatusBadRequest)
+		return
+	}
+	if req.MaxRetryIntervalSec > 0 && req.MaxRetryIntervalSec < req.RetryIntervalSec {
+		http.Error(w, "max_retry_interval_sec must be >= retry_interval_sec", http.StatusBadRequest)
+		return
+	}
+	if req.MaxIntervalSec > 0 && req.MaxIntervalSec < interval {
+		http.Error(w, "max_interval_sec must be >= interval_sec", http.StatusBadRequest)
+		return
+	}
+
+	if req.MaxCheckAttempts < 0 {
+		http.Error(w, "max_check_attempts must be >= 0", http.StatusBadRequest)
+		return
+	}
+
 	d := &device.Device{
 		Address:     req.Address,
 		Name:        req.Address,
 		CheckMethod: checkMethod,
 		IntervalSec: interval,
+		TimeoutSec:  timeout,
+		Labels:      req.Labels,
+
+		Parents:          req.Parents,
+		MaxCheckAttempts: req.MaxCheckAttempts,
+
+		RetryIntervalSec:    req.RetryIntervalSec,
+		MaxRetryIntervalSec: req.MaxRetryIntervalSec,
+		MaxIntervalSec:      req.MaxIntervalSec,
+
+		Cron:         req.Cron,
+		ActiveWindow: req.ActiveWindow,
+		Timezone:     req.Timezone,
+	}
+
+	if err := device.ValidateSchedule(d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	if err := s.deviceRepo.Save(r.Context(), d); err != nil {
+		if errors.Is(err, device.ErrUnknownParent) || errors.Is(err, device.ErrDependencyCycle) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "failed to save device", http.StatusInternalServerError)
 		return
 	}
@@ -110,23 +184,120 @@ func (s *Server) getDeviceStatus(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to get health", http.StatusInternalServerError)
 		return
 	}
+
+	alerts, err := s.alerts.DeviceStatus(r.Context(), dev)
+	if err != nil {
+		http.Error(w, "failed to get alert status", http.StatusInternalServerError)
+		return
+	}
+
 	if h == nil {
 		resp := map[string]interface{}{
 			"status":     "unknown",
 			"latency_ms": -1,
 			"last_check": "unknown",
 		}
+		if js := s.scheduler.Status(id); js != nil {
+			resp["schedule"] = js
+		}
+		resp["alert"] = alerts
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(resp)
 		return
 	}
 
+	resp := deviceStatusResponse{
+		HealthStatus: h,
+		Schedule:     s.scheduler.Status(id),
+		Alert:        alerts,
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(h)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+type deviceStatusResponse struct {
+	*health.HealthStatus
+	Schedule *scheduler.JobStatus `json:"schedule,omitempty"`
+	Alert    *alert.DeviceStatus  `json:"alert,omitempty"`
+}
+
+const maxCheckWait = 60 * time.Second
+
+// checkDevice queues an immediate check of a device. With ?wait=N it waits
+// up to N seconds for the result and returns it.
+func (s *Server) checkDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			http.Error(w, "wait must be a number of seconds", http.StatusBadRequest)
+			return
+		}
+		wait = time.Duration(sec) * time.Second
+		if wait > maxCheckWait {
+			wait = maxCheckWait
+		}
+	}
+
+	dev, err := s.deviceRepo.GetByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return
+	}
+	if dev == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	requestID, result := s.scheduler.RunNow(ctx, dev)
+
+	pending := map[string]interface{}{
+		"device_id":  id,
+		"request_id": requestID,
+		"status":     "pending",
+	}
+
+	if wait <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(pending)
+		return
+	}
+
+	// The server's write timeout would cut long waits short.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 5*time.Second))
+
+	select {
+	case h := <-result:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h)
+	case <-ctx.Done():
+		if r.Context().Err() != nil {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(pending)
+	}
 }
 
 func (s *Server) registerDeviceRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /devices", s.addDevice)
 	mux.HandleFunc("GET /devices", s.listDevices)
 	mux.HandleFunc("GET /devices/{id}", s.getDeviceStatus)
+	mux.HandleFunc("POST /devices/{id}/check", s.checkDevice)
 }
@@ -1,7 +1,11 @@
 package httpserver
 
 import (
+	"encoding/json"
+	"log"
 	"net/http"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
 )
 
 func (s *Server) health(w http.ResponseWriter, r *http.Request) {
@@ -9,6 +13,46 @@ func (s *Server) health(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("Hello!"))
 }
 
+type statusResponse struct {
+	Replica         string `json:"replica,omitempty"`
+	Leader          string `json:"leader,omitempty"`
+	LeaderError     string `json:"leader_error,omitempty"`
+	IsLeader        bool   `json:"is_leader"`
+	FencingToken    int64  `json:"fencing_token,omitempty"`
+	SharedScheduler bool   `json:"shared_scheduler"`
+
+	Lag      scheduler.LagStats       `json:"lag"`
+	Deferred *scheduler.DeferredStats `json:"deferred,omitempty"`
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	resp := statusResponse{
+		SharedScheduler: s.scheduler.Shared(),
+		Lag:             s.scheduler.Lag(),
+		Deferred:        s.scheduler.Deferred(),
+	}
+
+	if s.leader != nil {
+		resp.Replica = s.leader.ID()
+		resp.IsLeader, _ = s.leader.IsLeader()
+
+		// The rest of the status is still worth reporting when Redis is
+		// unreachable.
+		id, token, err := s.leader.Leader(r.Context())
+		if err != nil {
+			log.Printf("[ERROR] get leader: %v", err)
+			resp.LeaderError = "failed to get leader"
+		} else {
+			resp.Leader = id
+			resp.FencingToken = token
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
 func (s *Server) registerHealthRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /health", s.health)
+	mux.HandleFunc("GET /status", s.status)
 }
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -21,12 +22,14 @@ type workerPollRequest struct {
 }
 
 type workerReportRequest struct {
-	WorkerID  string     `json:"worker_id"`
-	JobID     string     `json:"job_id"`
-	DeviceID  string     `json:"device_id"`
-	Status    string     `json:"status"`
-	LatencyMS int        `json:"latency_ms"`
-	LastCheck *time.Time `json:"last_check,omitempty"`
+	WorkerID  string                 `json:"worker_id"`
+	JobID     string                 `json:"job_id"`
+	DeviceID  string                 `json:"device_id"`
+	Status    string                 `json:"status"`
+	LatencyMS int                    `json:"latency_ms"`
+	LastCheck *time.Time             `json:"last_check,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
 }
 
 func (s *Server) verifyWorkerRequest(r *http.Request, body []byte) bool {
@@ -157,22 +160,47 @@ func (s *Server) workerReportJob(w http.ResponseWriter, r *http.Request) {
 		checkedAt = *req.LastCheck
 	}
 
+	data := req.Data
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["job_id"] = req.JobID
+
 	h := &health.HealthStatus{
 		DeviceID:  req.DeviceID,
 		Status:    req.Status,
 		Latency:   req.LatencyMS,
 		Runner:    req.WorkerID,
 		LastCheck: checkedAt,
-		Data: map[string]interface{}{
-			"job_id": req.JobID,
-		},
+		Data:      data,
+		RequestID: req.RequestID,
+	}
+
+	dev, err := s.deviceRepo.GetByID(r.Context(), req.DeviceID)
+	if err != nil {
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return
+	}
+	if dev == nil {
+		// The device was deleted while its check ran. The result is dropped,
+		// but a RunNow caller may still be waiting for it.
+		s.scheduler.Report(h)
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 
-	if err := s.healthRepo.Save(r.Context(), h, 5*time.Minute); err != nil {
+	// Alert processing flags the result, so it comes before saving.
+	if err := s.alerts.Process(r.Context(), h); err != nil {
+		log.Printf("[ERROR] process alerts for device %s: %v", h.DeviceID, err)
+	}
+
+	if err := s.healthRepo.Save(r.Context(), h, scheduler.ResultTTL(dev)); err != nil {
 		http.Error(w, "failed to save health", http.StatusInternalServerError)
 		return
 	}
 
+	s.scheduler.Report(h)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
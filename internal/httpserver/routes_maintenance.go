@@ -0,0 +1,108 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/maintenance"
+)
+
+// defaultMaintenancePeriod is how far GET /devices/{id}/maintenance looks
+// back without from.
+const defaultMaintenancePeriod = 30 * 24 * time.Hour
+
+func (s *Server) addMaintenance(w http.ResponseWriter, r *http.Request) {
+	var win maintenance.Window
+	if err := json.NewDecoder(r.Body).Decode(&win); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.windows.Add(r.Context(), &win); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(win)
+}
+
+func (s *Server) listMaintenance(w http.ResponseWriter, r *http.Request) {
+	windows, err := s.windows.List(r.Context())
+	if err != nil {
+		http.Error(w, "failed to list maintenance windows", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(windows)
+}
+
+func (s *Server) deleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	if err := s.windows.Delete(r.Context(), r.PathValue("id")); err != nil {
+		http.Error(w, "failed to delete maintenance window", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type deviceMaintenanceResponse struct {
+	DeviceID    string    `json:"device_id"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	ExcludedSec int64     `json:"excluded_sec"`
+}
+
+// deviceMaintenance reports how much of [from, to) the device spent in
+// maintenance, for uptime and SLA figures to leave out.
+func (s *Server) deviceMaintenance(w http.ResponseWriter, r *http.Request) {
+	to := time.Now()
+	from := to.Add(-defaultMaintenancePeriod)
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := r.URL.Query().Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	dev, err := s.deviceRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return
+	}
+	if dev == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	excluded, err := s.windows.Excluded(r.Context(), dev, from, to)
+	if err != nil {
+		http.Error(w, "failed to get maintenance windows", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(deviceMaintenanceResponse{
+		DeviceID:    dev.ID,
+		From:        from,
+		To:          to,
+		ExcludedSec: int64(excluded / time.Second),
+	})
+}
+
+func (s *Server) registerMaintenanceRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /maintenance", s.addMaintenance)
+	mux.HandleFunc("GET /maintenance", s.listMaintenance)
+	mux.HandleFunc("DELETE /maintenance/{id}", s.deleteMaintenance)
+	mux.HandleFunc("GET /devices/{id}/maintenance", s.deviceMaintenance)
+}
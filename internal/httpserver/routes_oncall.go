@@ -0,0 +1,150 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/oncall"
+)
+
+func (s *Server) saveSchedule(w http.ResponseWriter, r *http.Request) {
+	var sch oncall.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&sch); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	sch.ID = r.PathValue("id")
+
+	err := s.oncall.Save(r.Context(), &sch)
+	if errors.Is(err, oncall.ErrInvalidSchedule) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] save schedule %s: %v", sch.ID, err)
+		http.Error(w, "failed to save schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sch)
+}
+
+func (s *Server) listSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := s.oncall.List(r.Context())
+	if err != nil {
+		http.Error(w, "failed to list schedules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(schedules)
+}
+
+func (s *Server) getSchedule(w http.ResponseWriter, r *http.Request) {
+	sch, err := s.oncall.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "failed to get schedule", http.StatusInternalServerError)
+		return
+	}
+	if sch == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sch)
+}
+
+func (s *Server) deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := s.oncall.Delete(r.Context(), r.PathValue("id")); err != nil {
+		http.Error(w, "failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) addOverride(w http.ResponseWriter, r *http.Request) {
+	var o oncall.Override
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.oncall.AddOverride(r.Context(), r.PathValue("id"), &o); err != nil {
+		switch {
+		case errors.Is(err, oncall.ErrUnknownSchedule):
+			http.NotFound(w, r)
+		case errors.Is(err, oncall.ErrInvalidOverride):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("[ERROR] add override to schedule %s: %v", r.PathValue("id"), err)
+			http.Error(w, "failed to add override", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(o)
+}
+
+func (s *Server) listOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := s.oncall.Overrides(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "failed to list overrides", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(overrides)
+}
+
+func (s *Server) deleteOverride(w http.ResponseWriter, r *http.Request) {
+	if err := s.oncall.DeleteOverride(r.Context(), r.PathValue("id"), r.PathValue("override")); err != nil {
+		http.Error(w, "failed to delete override", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// whoIsOnCall reports who is on call for a schedule, now or at the time
+// given in RFC 3339 by the time query parameter.
+func (s *Server) whoIsOnCall(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if v := r.URL.Query().Get("time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid time", http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+
+	res, err := s.oncall.OnCall(r.Context(), r.PathValue("id"), at)
+	if err != nil {
+		if errors.Is(err, oncall.ErrUnknownSchedule) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "failed to get on-call users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) registerOnCallRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /oncall/schedules", s.listSchedules)
+	mux.HandleFunc("PUT /oncall/schedules/{id}", s.saveSchedule)
+	mux.HandleFunc("GET /oncall/schedules/{id}", s.getSchedule)
+	mux.HandleFunc("DELETE /oncall/schedules/{id}", s.deleteSchedule)
+	mux.HandleFunc("GET /oncall/schedules/{id}/oncall", s.whoIsOnCall)
+	mux.HandleFunc("POST /oncall/schedules/{id}/overrides", s.addOverride)
+	mux.HandleFunc("GET /oncall/schedules/{id}/overrides", s.listOverrides)
+	mux.HandleFunc("DELETE /oncall/schedules/{id}/overrides/{override}", s.deleteOverride)
+}
@@ -0,0 +1,86 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"github.com/Rin0913/monitor/internal/health"
+	"github.com/Rin0913/monitor/internal/routing"
+)
+
+type dryRunRequest struct {
+	DeviceID string     `json:"device_id"`
+	Type     string     `json:"type"`
+	Status   string     `json:"status"`
+	Time     *time.Time `json:"time"`
+}
+
+type dryRunResponse struct {
+	*routing.Result
+	// NotifyAll is set when no step applies and every notifier is used.
+	NotifyAll bool `json:"notify_all"`
+}
+
+// routingDryRun shows how a notification about a device would be routed.
+func (s *Server) routingDryRun(w http.ResponseWriter, r *http.Request) {
+	if s.routing == nil {
+		http.Error(w, "no routing rules configured", http.StatusNotFound)
+		return
+	}
+
+	var req dryRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.DeviceID == "" {
+		http.Error(w, "missing device_id", http.StatusBadRequest)
+		return
+	}
+
+	dev, err := s.deviceRepo.GetByID(r.Context(), req.DeviceID)
+	if err != nil {
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return
+	}
+	if dev == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = alert.TypeProblem
+	}
+	if req.Status == "" {
+		req.Status = "DOWN"
+		if req.Type == alert.TypeRecovery {
+			req.Status = "UP"
+		}
+	}
+	at := time.Now()
+	if req.Time != nil {
+		at = *req.Time
+	}
+
+	n := &alert.Notification{
+		Type:   req.Type,
+		Device: dev,
+		Health: &health.HealthStatus{DeviceID: dev.ID, Status: req.Status, LastCheck: at},
+		Since:  at,
+		Time:   at,
+	}
+	res := s.routing.Evaluate(n)
+	resp := dryRunResponse{
+		Result:    res,
+		NotifyAll: len(res.Steps) == 0,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) registerRoutingRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /routing/dry-run", s.routingDryRun)
+}
@@ -0,0 +1,110 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"github.com/Rin0913/monitor/internal/health"
+	"github.com/Rin0913/monitor/internal/notify"
+)
+
+type previewRequest struct {
+	DeviceID string                 `json:"device_id"`
+	Type     string                 `json:"type"`
+	Status   string                 `json:"status"`
+	Notifier string                 `json:"notifier"`
+	Route    string                 `json:"route"`
+	Template *notify.TemplateConfig `json:"template"`
+}
+
+// previewNotification renders a notification about a device with the
+// configured templates, or with the template in the request. The latest
+// health and alert state of the device are used unless a status is given.
+func (s *Server) previewNotification(w http.ResponseWriter, r *http.Request) {
+	var req previewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.DeviceID == "" {
+		http.Error(w, "missing device_id", http.StatusBadRequest)
+		return
+	}
+
+	dev, err := s.deviceRepo.GetByID(r.Context(), req.DeviceID)
+	if err != nil {
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return
+	}
+	if dev == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = alert.TypeProblem
+	}
+	now := time.Now()
+
+	h, err := s.healthRepo.Get(r.Context(), dev.ID)
+	if err != nil {
+		http.Error(w, "failed to get health", http.StatusInternalServerError)
+		return
+	}
+	if h == nil || req.Status != "" {
+		if req.Status == "" {
+			req.Status = "DOWN"
+			if req.Type == alert.TypeRecovery {
+				req.Status = "UP"
+			}
+		}
+		h = &health.HealthStatus{DeviceID: dev.ID, Status: req.Status, LastCheck: now}
+	}
+
+	st, err := s.alerts.DeviceStatus(r.Context(), dev)
+	if err != nil {
+		http.Error(w, "failed to get alert status", http.StatusInternalServerError)
+		return
+	}
+
+	n := &alert.Notification{
+		Type:   req.Type,
+		Device: dev,
+		Health: h,
+		Since:  h.LastCheck,
+		Time:   now,
+		Route:  req.Route,
+	}
+	if n.Route == "" && s.routing != nil {
+		if res := s.routing.Evaluate(n); len(res.Steps) > 0 {
+			n.Route = res.Steps[0].Rule
+		}
+	}
+	if st.Since != nil {
+		n.Since = *st.Since
+	}
+	n.Ack = st.Acknowledged
+	if n.Ack == nil && req.Type == alert.TypeAcknowledgement {
+		n.Ack = &alert.Ack{Author: "preview", Comment: "acknowledged", CreatedAt: now}
+	}
+
+	var msg *notify.Message
+	if req.Template != nil {
+		msg, err = s.templates.Preview(n, req.Notifier, *req.Template)
+	} else {
+		msg, err = s.templates.Render(n, req.Notifier)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(msg)
+}
+
+func (s *Server) registerTemplateRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /notifications/preview", s.previewNotification)
+}
@@ -1,12 +1,23 @@
 package httpserver
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Rin0913/monitor/internal/alert"
 	"github.com/Rin0913/monitor/internal/device"
 	"github.com/Rin0913/monitor/internal/health"
+	"github.com/Rin0913/monitor/internal/maintenance"
+	"github.com/Rin0913/monitor/internal/notify"
+	"github.com/Rin0913/monitor/internal/oncall"
+	"github.com/Rin0913/monitor/internal/routing"
 	"github.com/Rin0913/monitor/internal/scheduler"
 	"github.com/redis/go-redis/v9"
 )
@@ -15,29 +26,178 @@ type Server struct {
 	deviceRepo device.Repository
 	healthRepo health.Repository
 	scheduler  *scheduler.Scheduler
+	alerts     *alert.Processor
+	windows    *maintenance.Service
+	routing    *routing.Engine
+	templates  *notify.Templates
+	oncall     *oncall.Service
+	leader     LeaderInfo
 
 	presharedWorkerKey string
 }
 
+// LeaderInfo reports the leader election among the server replicas.
+type LeaderInfo interface {
+	ID() string
+	IsLeader() (bool, int64)
+	Leader(ctx context.Context) (string, int64, error)
+}
+
 func NewServer(redisClient *redis.Client) *Server {
 	deviceRepo := device.NewRedisRepository(redisClient)
 	healthRepo := health.NewRedisRepository(redisClient)
-	scheduler := scheduler.New(deviceRepo, healthRepo)
+	scheduler := scheduler.New(deviceRepo, healthRepo, schedulerOptionsFromEnv(redisClient)...)
 
-	_ = scheduler.Bootstrap(context.Background())
+	// A shared queue is bootstrapped by the leader replica.
+	if !scheduler.Shared() {
+		_ = scheduler.Bootstrap(context.Background())
+	}
+
+	windows := maintenance.NewService(maintenance.NewRedisRepository(redisClient))
+	schedules := oncall.NewService(oncall.NewRedisRepository(redisClient))
+	alerts := alert.NewProcessor(alert.NewRedisRepository(redisClient), deviceRepo)
+	alerts.SetMaintenance(windows)
+	alerts.SetHealthRepo(healthRepo)
+	alerts.SetOnCall(schedules)
+	if min, err := strconv.Atoi(os.Getenv("ALERT_RENOTIFY_MIN")); err == nil && min >= 0 {
+		alerts.SetRenotifyInterval(time.Duration(min) * time.Minute)
+	}
+	flapHistory, flapLow, flapHigh := alert.DefaultFlapHistory, alert.DefaultFlapLow, alert.DefaultFlapHigh
+	if n, err := strconv.Atoi(os.Getenv("ALERT_FLAP_HISTORY")); err == nil {
+		flapHistory = n
+	}
+	if pct, err := strconv.ParseFloat(os.Getenv("ALERT_FLAP_LOW_PCT"), 64); err == nil {
+		flapLow = pct
+	}
+	if pct, err := strconv.ParseFloat(os.Getenv("ALERT_FLAP_HIGH_PCT"), 64); err == nil {
+		flapHigh = pct
+	}
+	alerts.SetFlapDetection(flapHistory, flapLow, flapHigh)
 
 	return &Server{
 		deviceRepo:         deviceRepo,
 		healthRepo:         healthRepo,
 		scheduler:          scheduler,
+		alerts:             alerts,
+		windows:            windows,
+		templates:          notify.NewTemplates(),
+		oncall:             schedules,
 		presharedWorkerKey: os.Getenv("PRESHARED_WORKER_KEY"),
 	}
 }
 
+func schedulerOptionsFromEnv(redisClient *redis.Client) []scheduler.Option {
+	var opts []scheduler.Option
+
+	switch mode := os.Getenv("SCHEDULER_MODE"); mode {
+	case "", "memory":
+	case "redis":
+		log.Println("[INFO] scheduler: job queue shared through redis")
+		opts = append(opts, scheduler.WithRedis(redisClient))
+	default:
+		log.Printf("[WARN] unknown SCHEDULER_MODE %q, using memory", mode)
+	}
+
+	if pct, err := strconv.ParseFloat(os.Getenv("SCHEDULER_JITTER_PCT"), 64); err == nil && pct > 0 {
+		opts = append(opts, scheduler.WithJitter(pct/100))
+	}
+	if os.Getenv("SCHEDULER_NO_SPREAD") == "1" {
+		opts = append(opts, scheduler.WithoutSpread())
+	}
+	if sec, err := strconv.Atoi(os.Getenv("SCHEDULER_LAG_WARN_SEC")); err == nil && sec > 0 {
+		opts = append(opts, scheduler.WithLagThreshold(time.Duration(sec)*time.Second))
+	}
+	if url := os.Getenv("SCHEDULER_ALERT_WEBHOOK"); url != "" {
+		opts = append(opts, scheduler.WithOverloadHook(overloadWebhook(url)))
+	}
+	if n, err := strconv.Atoi(os.Getenv("SCHEDULER_MAX_PER_HOST")); err == nil && n > 0 {
+		opts = append(opts, scheduler.WithHostLimit(n))
+	}
+	// e.g. "cmd_ping=2,tcp_check=10"
+	for _, entry := range strings.Split(os.Getenv("SCHEDULER_MAX_PER_METHOD"), ",") {
+		method, limit, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			log.Printf("[WARN] invalid SCHEDULER_MAX_PER_METHOD entry %q", entry)
+			continue
+		}
+		opts = append(opts, scheduler.WithMethodLimit(strings.TrimSpace(method), n))
+	}
+
+	return opts
+}
+
 func (s *Server) Scheduler() *scheduler.Scheduler {
 	return s.scheduler
 }
 
+// overloadWebhook posts the scheduler state to url whenever it becomes
+// overloaded or recovers.
+func overloadWebhook(url string) func(bool, scheduler.LagStats) {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	return func(overloaded bool, st scheduler.LagStats) {
+		event := "scheduler_recovered"
+		if overloaded {
+			event = "scheduler_overloaded"
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"event": event,
+			"lag":   st,
+		})
+
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("[WARN] scheduler alert webhook: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("[WARN] scheduler alert webhook: status %d", resp.StatusCode)
+		}
+	}
+}
+
+// Close stops the scheduler.
+func (s *Server) Close() error {
+	return s.scheduler.Close()
+}
+
+// SetLeaderInfo makes GET /status report the leader election.
+func (s *Server) SetLeaderInfo(l LeaderInfo) {
+	s.leader = l
+}
+
+// SetRouting routes notifications through e and enables the routing dry-run.
+func (s *Server) SetRouting(e *routing.Engine) {
+	if e == nil {
+		return
+	}
+	s.routing = e
+	s.alerts.SetRouter(e)
+}
+
+// SetTemplates makes the notification preview render with the templates
+// the notifiers use.
+func (s *Server) SetTemplates(t *notify.Templates) {
+	if t == nil {
+		return
+	}
+	s.templates = t
+}
+
+func (s *Server) Alerts() *alert.Processor {
+	return s.alerts
+}
+
+// OnCall returns the on-call schedules notifiers resolve recipients with.
+func (s *Server) OnCall() *oncall.Service {
+	return s.oncall
+}
+
 func (s *Server) HealthRepo() health.Repository {
 	return s.healthRepo
 }
@@ -46,4 +206,9 @@ func (s *Server) RegisterRoutes(mux *http.ServeMux) {
 	s.registerHealthRoutes(mux)
 	s.registerDeviceRoutes(mux)
 	s.registerInternalRoutes(mux)
+	s.registerAlertRoutes(mux)
+	s.registerMaintenanceRoutes(mux)
+	s.registerRoutingRoutes(mux)
+	s.registerTemplateRoutes(mux)
+	s.registerOnCallRoutes(mux)
 }
@@ -0,0 +1,123 @@
+package maintenance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/device"
+)
+
+var base = time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC) // a Monday
+
+func TestWindowActive(t *testing.T) {
+	once := &Window{DeviceIDs: []string{"web"}, StartsAt: base.Add(time.Hour), EndsAt: base.Add(2 * time.Hour)}
+	weekly := &Window{Labels: map[string]string{"env": "prod"}, Cron: "0 2 * * SUN", DurationSec: 7200, Timezone: "Asia/Taipei"}
+	for _, w := range []*Window{once, weekly} {
+		if err := w.Validate(); err != nil {
+			t.Fatalf("Validate: %v", err)
+		}
+	}
+
+	tests := []struct {
+		w    *Window
+		at   time.Time
+		want bool
+	}{
+		{once, base.Add(59 * time.Minute), false},
+		{once, base.Add(time.Hour), true},
+		{once, base.Add(2 * time.Hour), false},
+		// Sunday 02:00-04:00 in Taipei is Saturday 18:00-20:00 UTC.
+		{weekly, base.Add(-30*time.Hour - time.Minute), false},
+		{weekly, base.Add(-30 * time.Hour), true},
+		{weekly, base.Add(-28*time.Hour - time.Second), true},
+		{weekly, base.Add(-28 * time.Hour), false},
+		{weekly, base.Add(-6 * time.Hour), false},
+		{weekly, base.Add(6*24*time.Hour - 5*time.Hour), true},
+	}
+	for i, tt := range tests {
+		if got := tt.w.Active(tt.at); got != tt.want {
+			t.Errorf("#%d: Active(%s) = %v, want %v", i, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestWindowValidate(t *testing.T) {
+	bad := []*Window{
+		{StartsAt: base, EndsAt: base.Add(time.Hour)},
+		{DeviceIDs: []string{"web"}, StartsAt: base, EndsAt: base},
+		{DeviceIDs: []string{"web"}, Cron: "0 2 * * *"},
+		{DeviceIDs: []string{"web"}, Cron: "0 2 * * *", DurationSec: 60, StartsAt: base},
+		{DeviceIDs: []string{"web"}, Cron: "0 2 * * *", DurationSec: 60, Timezone: "Nowhere/City"},
+	}
+	for i, w := range bad {
+		if err := w.Validate(); err == nil {
+			t.Errorf("#%d: invalid window accepted", i)
+		}
+	}
+}
+
+func TestServiceActiveAndExcluded(t *testing.T) {
+	svc := NewService(newMemRepo())
+	ctx := context.Background()
+
+	web := &device.Device{ID: "web", Labels: map[string]string{"env": "prod"}}
+	db := &device.Device{ID: "db", Labels: map[string]string{"env": "staging"}}
+
+	daily := &Window{Labels: map[string]string{"env": "prod"}, Cron: "0 1 * * *", DurationSec: 3600}
+	// Overlaps the daily window of the first day by half an hour.
+	once := &Window{DeviceIDs: []string{"web"}, StartsAt: base.Add(90 * time.Minute), EndsAt: base.Add(3 * time.Hour)}
+	for _, w := range []*Window{daily, once} {
+		if err := svc.Add(ctx, w); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	active, err := svc.Active(ctx, web, base.Add(95*time.Minute))
+	if err != nil || len(active) != 2 {
+		t.Fatalf("Active(web) = %v, %v", active, err)
+	}
+	if active, _ := svc.Active(ctx, db, base.Add(95*time.Minute)); len(active) != 0 {
+		t.Fatalf("db in maintenance: %v", active)
+	}
+
+	got, err := svc.Excluded(ctx, web, base, base.Add(48*time.Hour))
+	if err != nil {
+		t.Fatalf("Excluded: %v", err)
+	}
+	if want := 3 * time.Hour; got != want {
+		t.Fatalf("Excluded = %s, want %s", got, want)
+	}
+
+	// Periods are clipped to the range.
+	got, _ = svc.Excluded(ctx, web, base.Add(150*time.Minute), base.Add(24*time.Hour+90*time.Minute))
+	if want := time.Hour; got != want {
+		t.Fatalf("clipped Excluded = %s, want %s", got, want)
+	}
+}
+
+type memRepo struct {
+	windows map[string]*Window
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{windows: make(map[string]*Window)}
+}
+
+func (r *memRepo) List(ctx context.Context) ([]*Window, error) {
+	res := make([]*Window, 0, len(r.windows))
+	for _, w := range r.windows {
+		res = append(res, w)
+	}
+	return res, nil
+}
+
+func (r *memRepo) Save(ctx context.Context, w *Window) error {
+	r.windows[w.ID] = w
+	return nil
+}
+
+func (r *memRepo) Delete(ctx context.Context, id string) error {
+	delete(r.windows, id)
+	return nil
+}
@@ -0,0 +1,131 @@
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/cron"
+	"github.com/Rin0913/monitor/internal/device"
+)
+
+// Window is a planned maintenance of some devices, either one-off between
+// StartsAt and EndsAt, or recurring for DurationSec from every Cron time
+// (evaluated in Timezone, UTC if empty). It applies to the devices listed in
+// DeviceIDs and to the devices carrying all of Labels.
+type Window struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name,omitempty"`
+	DeviceIDs []string          `json:"device_ids,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+
+	StartsAt time.Time `json:"starts_at,omitempty"`
+	EndsAt   time.Time `json:"ends_at,omitempty"`
+
+	Cron        string `json:"cron,omitempty"`
+	DurationSec int    `json:"duration_sec,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	schedule *cron.Schedule
+	loc      *time.Location
+}
+
+// Validate checks w and prepares its recurrence.
+func (w *Window) Validate() error {
+	if len(w.DeviceIDs) == 0 && len(w.Labels) == 0 {
+		return fmt.Errorf("maintenance: window needs device_ids or labels")
+	}
+
+	if w.Cron == "" {
+		if w.DurationSec != 0 || w.Timezone != "" {
+			return fmt.Errorf("maintenance: duration_sec and timezone need cron")
+		}
+		if w.StartsAt.IsZero() || !w.EndsAt.After(w.StartsAt) {
+			return fmt.Errorf("maintenance: ends_at must be after starts_at")
+		}
+		return nil
+	}
+
+	if !w.StartsAt.IsZero() || !w.EndsAt.IsZero() {
+		return fmt.Errorf("maintenance: starts_at and ends_at cannot be combined with cron")
+	}
+	if w.DurationSec <= 0 {
+		return fmt.Errorf("maintenance: recurring window needs duration_sec > 0")
+	}
+
+	s, err := cron.Parse(w.Cron)
+	if err != nil {
+		return fmt.Errorf("maintenance: %w", err)
+	}
+	loc := time.UTC
+	if w.Timezone != "" {
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("maintenance: invalid timezone %q", w.Timezone)
+		}
+	}
+	w.schedule, w.loc = s, loc
+	return nil
+}
+
+// Applies reports whether w covers device d.
+func (w *Window) Applies(d *device.Device) bool {
+	for _, id := range w.DeviceIDs {
+		if id == d.ID {
+			return true
+		}
+	}
+	if len(w.Labels) == 0 {
+		return false
+	}
+	for k, v := range w.Labels {
+		if d.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Active reports whether the maintenance is in progress at t.
+func (w *Window) Active(t time.Time) bool {
+	if w.schedule == nil {
+		return !t.Before(w.StartsAt) && t.Before(w.EndsAt)
+	}
+
+	// The latest start that may still be in progress fires after
+	// t - duration.
+	start := w.schedule.Next(t.Add(-w.duration()).In(w.loc))
+	return !start.IsZero() && !start.After(t)
+}
+
+// Occurrences returns the periods of maintenance overlapping [from, to),
+// clipped to it.
+func (w *Window) Occurrences(from, to time.Time) [][2]time.Time {
+	clip := func(s, e time.Time) [2]time.Time {
+		if s.Before(from) {
+			s = from
+		}
+		if e.After(to) {
+			e = to
+		}
+		return [2]time.Time{s, e}
+	}
+
+	if w.schedule == nil {
+		if w.EndsAt.After(from) && w.StartsAt.Before(to) {
+			return [][2]time.Time{clip(w.StartsAt, w.EndsAt)}
+		}
+		return nil
+	}
+
+	var res [][2]time.Time
+	for s := w.schedule.Next(from.Add(-w.duration()).In(w.loc)); !s.IsZero() && s.Before(to); s = w.schedule.Next(s) {
+		res = append(res, clip(s, s.Add(w.duration())))
+	}
+	return res
+}
+
+func (w *Window) duration() time.Duration {
+	return time.Duration(w.DurationSec) * time.Second
+}
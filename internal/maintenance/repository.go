@@ -0,0 +1,72 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const windowsKey = "maintenance:windows"
+
+type Repository interface {
+	List(ctx context.Context) ([]*Window, error)
+	Save(ctx context.Context, w *Window) error
+	Delete(ctx context.Context, id string) error
+}
+
+type RedisRepository struct {
+	client *redis.Client
+}
+
+func NewRedisRepository(client *redis.Client) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+	}
+}
+
+// List returns the stored windows. A window that cannot be decoded, e.g.
+// one with a timezone unknown to this host, is logged and skipped so the
+// others still apply.
+func (r *RedisRepository) List(ctx context.Context) ([]*Window, error) {
+	values, err := r.client.HGetAll(ctx, windowsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Window, 0, len(values))
+	for id, v := range values {
+		var w Window
+		if err := json.Unmarshal([]byte(v), &w); err != nil {
+			log.Printf("[WARN] maintenance: skip window %s: %v", id, err)
+			continue
+		}
+		if err := w.Validate(); err != nil {
+			log.Printf("[WARN] maintenance: skip window %s: %v", id, err)
+			continue
+		}
+		res = append(res, &w)
+	}
+	return res, nil
+}
+
+func (r *RedisRepository) Save(ctx context.Context, w *Window) error {
+	if w == nil || w.ID == "" {
+		return fmt.Errorf("maintenance: invalid window")
+	}
+
+	b, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, windowsKey, w.ID, b).Err()
+}
+
+func (r *RedisRepository) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return fmt.Errorf("maintenance: empty window id")
+	}
+	return r.client.HDel(ctx, windowsKey, id).Err()
+}
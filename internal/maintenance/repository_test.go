@@ -0,0 +1,51 @@
+package maintenance
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/redisclient"
+)
+
+func TestRedisRepositorySkipsInvalidWindows(t *testing.T) {
+	if os.Getenv("REDIS_ADDR") == "" && os.Getenv("REDIS_URL") == "" {
+		t.Skip("redis not configured")
+	}
+
+	client := redisclient.NewTestClientFromEnv()
+	defer client.Close()
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis not reachable: %v", err)
+	}
+	repo := NewRedisRepository(client)
+
+	good := &Window{ID: "repo-good", DeviceIDs: []string{"web"}, StartsAt: base, EndsAt: base.Add(time.Hour)}
+	if err := repo.Save(ctx, good); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	defer repo.Delete(ctx, good.ID)
+
+	// e.g. stored by a host that knows a timezone this one does not
+	bad := `{"id":"repo-bad","device_ids":["web"],"cron":"0 2 * * *","duration_sec":60,"timezone":"Mars/Olympus"}`
+	client.HSet(ctx, windowsKey, "repo-bad", bad)
+	client.HSet(ctx, windowsKey, "repo-broken", "{")
+	defer client.HDel(ctx, windowsKey, "repo-bad", "repo-broken")
+
+	windows, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	found := false
+	for _, w := range windows {
+		if w.ID == "repo-bad" || w.ID == "repo-broken" {
+			t.Fatalf("invalid window listed: %+v", w)
+		}
+		found = found || w.ID == good.ID
+	}
+	if !found {
+		t.Fatalf("valid window missing: %+v", windows)
+	}
+}
@@ -0,0 +1,86 @@
+package maintenance
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/google/uuid"
+)
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+// Add validates and stores a new window.
+func (s *Service) Add(ctx context.Context, w *Window) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	w.ID = uuid.NewString()
+	w.CreatedAt = time.Now()
+	return s.repo.Save(ctx, w)
+}
+
+func (s *Service) List(ctx context.Context) ([]*Window, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// Active returns the windows of d in progress at t.
+func (s *Service) Active(ctx context.Context, d *device.Device, t time.Time) ([]*Window, error) {
+	windows, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*Window
+	for _, w := range windows {
+		if w.Applies(d) && w.Active(t) {
+			res = append(res, w)
+		}
+	}
+	return res, nil
+}
+
+// Excluded returns how much of [from, to) d spent in maintenance, counting
+// overlapping windows once, so uptime and SLA figures can leave it out.
+func (s *Service) Excluded(ctx context.Context, d *device.Device, from, to time.Time) (time.Duration, error) {
+	windows, err := s.repo.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var periods [][2]time.Time
+	for _, w := range windows {
+		if w.Applies(d) {
+			periods = append(periods, w.Occurrences(from, to)...)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i][0].Before(periods[j][0])
+	})
+
+	var total time.Duration
+	var end time.Time
+	for _, p := range periods {
+		if p[0].Before(end) {
+			p[0] = end
+		}
+		if p[1].After(p[0]) {
+			total += p[1].Sub(p[0])
+			end = p[1]
+		}
+	}
+	return total, nil
+}
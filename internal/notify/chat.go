@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+)
+
+// Message colours by notification and status.
+const (
+	colorProblem  = "#d50200"
+	colorWarning  = "#f2a900"
+	colorRecovery = "#2eb886"
+	colorInfo     = "#439fe0"
+)
+
+func color(n *alert.Notification) string {
+	switch n.Type {
+	case alert.TypeRecovery:
+		return colorRecovery
+	case alert.TypeAcknowledgement:
+		return colorInfo
+	case alert.TypeFlappingStart, alert.TypeFlappingStop:
+		return colorWarning
+	}
+	if n.Health != nil && n.Health.Status != "DOWN" {
+		// UNKNOWN, UNREACHABLE and the like
+		return colorWarning
+	}
+	return colorProblem
+}
+
+type fact struct {
+	name, value string
+}
+
+func facts(n *alert.Notification) []fact {
+	res := []fact{
+		{"Device", n.Device.Name},
+		{"Address", n.Device.Address},
+	}
+	if h := n.Health; h != nil {
+		res = append(res,
+			fact{"Status", h.Status},
+			fact{"Latency", strconv.Itoa(h.Latency) + " ms"},
+		)
+		if h.Runner != "" {
+			res = append(res, fact{"Runner", h.Runner})
+		}
+	}
+	res = append(res, fact{"Since", n.Since.UTC().Format(time.RFC3339)})
+	if len(n.OnCall) > 0 {
+		res = append(res, fact{"On call", strings.Join(n.OnCall, ", ")})
+	}
+	if a := n.Ack; a != nil {
+		by := a.Author
+		if by == "" {
+			by = "someone"
+		}
+		res = append(res, fact{"Acknowledged", by + ": " + a.Comment})
+	}
+	return res
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Fallback  string       `json:"fallback"`
+	Color     string       `json:"color"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Text      string       `json:"text,omitempty"`
+	Fields    []slackField `json:"fields"`
+	Footer    string       `json:"footer,omitempty"`
+	Ts        int64        `json:"ts"`
+}
+
+type slackPayload struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	IconURL     string            `json:"icon_url,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// slackMessage renders n as a Slack message with a coloured attachment,
+// which Mattermost accepts as well.
+func slackMessage(n *alert.Notification, msg *Message, opts WebhookOptions, link string) slackPayload {
+	var fields []slackField
+	for _, f := range facts(n) {
+		fields = append(fields, slackField{Title: f.name, Value: f.value, Short: len(f.value) < 40})
+	}
+	return slackPayload{
+		Channel:  opts.Channel,
+		Username: opts.Username,
+		IconURL:  opts.IconURL,
+		Text:     msg.Subject,
+		Attachments: []slackAttachment{{
+			Fallback:  msg.Subject,
+			Color:     color(n),
+			Title:     msg.Subject,
+			TitleLink: link,
+			Text:      msg.Body,
+			Fields:    fields,
+			Footer:    "monitor",
+			Ts:        n.Time.Unix(),
+		}},
+	}
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordPayload struct {
+	Username  string         `json:"username,omitempty"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Embeds    []discordEmbed `json:"embeds"`
+}
+
+func discordMessage(n *alert.Notification, msg *Message, opts WebhookOptions, link string) discordPayload {
+	var fields []discordField
+	for _, f := range facts(n) {
+		fields = append(fields, discordField{Name: f.name, Value: f.value, Inline: len(f.value) < 40})
+	}
+	rgb, _ := strconv.ParseInt(strings.TrimPrefix(color(n), "#"), 16, 32)
+	return discordPayload{
+		Username:  opts.Username,
+		AvatarURL: opts.IconURL,
+		Embeds: []discordEmbed{{
+			Title:       msg.Subject,
+			URL:         link,
+			Description: msg.Body,
+			Color:       int(rgb),
+			Fields:      fields,
+			Timestamp:   n.Time.UTC().Format(time.RFC3339),
+		}},
+	}
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type teamsSection struct {
+	ActivityTitle string      `json:"activityTitle"`
+	Facts         []teamsFact `json:"facts"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsPayload struct {
+	Type            string         `json:"@type"`
+	Context         string         `json:"@context"`
+	ThemeColor      string         `json:"themeColor"`
+	Summary         string         `json:"summary"`
+	Title           string         `json:"title"`
+	Text            string         `json:"text,omitempty"`
+	Sections        []teamsSection `json:"sections"`
+	PotentialAction []teamsAction  `json:"potentialAction,omitempty"`
+}
+
+// teamsMessage renders n as a Microsoft Teams MessageCard.
+func teamsMessage(n *alert.Notification, msg *Message, link string) teamsPayload {
+	var fs []teamsFact
+	for _, f := range facts(n) {
+		fs = append(fs, teamsFact{Name: f.name, Value: f.value})
+	}
+	res := teamsPayload{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: strings.TrimPrefix(color(n), "#"),
+		Summary:    msg.Subject,
+		Title:      msg.Subject,
+		Text:       msg.Body,
+		Sections: []teamsSection{{
+			ActivityTitle: n.Device.Address,
+			Facts:         fs,
+		}},
+	}
+	if link != "" {
+		res.PotentialAction = []teamsAction{{
+			Type:    "OpenUri",
+			Name:    "Open",
+			Targets: []teamsTarget{{OS: "default", URI: link}},
+		}}
+	}
+	return res
+}
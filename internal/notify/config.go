@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"go.yaml.in/yaml/v4"
+)
+
+// Config is the notifier part of notifiers.yaml. Templates are used by
+// every notifier; routing rules may override them with their own, which the
+// routing package hands to Templates.SetRoute.
+type Config struct {
+	Notifiers map[string]NotifierEntry  `yaml:"notifiers"`
+	Templates map[string]TemplateConfig `yaml:"templates"`
+}
+
+type NotifierEntry struct {
+	Type       string `yaml:"type"`
+	TimeoutSec int    `yaml:"timeout_sec"`
+
+	// smtp
+	Host          string      `yaml:"host"`
+	Port          int         `yaml:"port"`
+	Security      string      `yaml:"security"`
+	Username      string      `yaml:"username"`
+	PasswordEnv   string      `yaml:"password_env"`
+	From          string      `yaml:"from"`
+	To            []Recipient `yaml:"to"`
+	Subject       string      `yaml:"subject"`
+	Body          string      `yaml:"body"`
+	TLSServerName string      `yaml:"tls_server_name"`
+	TLSSkipVerify bool        `yaml:"tls_skip_verify"`
+
+	// webhook, slack, mattermost, discord, teams
+	URL         string            `yaml:"url"`
+	URLEnv      string            `yaml:"url_env"`
+	Channel     string            `yaml:"channel"`
+	DisplayName string            `yaml:"display_name"`
+	IconURL     string            `yaml:"icon_url"`
+	Link        string            `yaml:"link"`
+	Headers     map[string]string `yaml:"headers"`
+
+	// Templates override the templates of the listed events. Subject and
+	// Body above are shorthands for every event without its own.
+	Templates map[string]TemplateConfig `yaml:"templates"`
+}
+
+// LoadConfig builds the notifiers described in the file at path, ordered by
+// name, and the templates they render with.
+func LoadConfig(path string) ([]alert.Notifier, *Templates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := NewTemplates()
+	if err := tmpl.SetGlobal(cfg.Templates); err != nil {
+		return nil, nil, fmt.Errorf("notify: %w", err)
+	}
+
+	names := make([]string, 0, len(cfg.Notifiers))
+	for name := range cfg.Notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]alert.Notifier, 0, len(names))
+	for _, name := range names {
+		n, err := cfg.Notifiers[name].build(name, tmpl)
+		if err != nil {
+			return nil, nil, fmt.Errorf("notify: %s: %w", name, err)
+		}
+		res = append(res, n)
+	}
+	return res, tmpl, nil
+}
+
+// templates returns the template overrides of the notifier, with Subject
+// and Body filling the events that do not set them.
+func (e NotifierEntry) templates() map[string]TemplateConfig {
+	cfg := make(map[string]TemplateConfig, len(e.Templates))
+	for event, c := range e.Templates {
+		cfg[event] = c
+	}
+	if e.Subject == "" && e.Body == "" {
+		return cfg
+	}
+	for _, event := range events {
+		c := cfg[event]
+		if c.Subject == "" {
+			c.Subject = e.Subject
+		}
+		if c.Body == "" {
+			c.Body = e.Body
+		}
+		cfg[event] = c
+	}
+	return cfg
+}
+
+func (e NotifierEntry) build(name string, tmpl *Templates) (alert.Notifier, error) {
+	switch e.Type {
+	case "smtp":
+		opts, err := e.smtpOptions()
+		if err != nil {
+			return nil, err
+		}
+		if err := tmpl.setNotifier(name, mailDefaults, e.templates()); err != nil {
+			return nil, err
+		}
+		opts.Templates = tmpl
+		return NewSMTPNotifier(name, opts), nil
+	case FormatJSON, FormatSlack, FormatMattermost, FormatDiscord, FormatTeams:
+		opts, err := e.webhookOptions()
+		if err != nil {
+			return nil, err
+		}
+		if err := tmpl.setNotifier(name, chatDefaults, e.templates()); err != nil {
+			return nil, err
+		}
+		opts.Templates = tmpl
+		return NewWebhookNotifier(name, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", e.Type)
+	}
+}
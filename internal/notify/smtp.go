@@ -0,0 +1,331 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+)
+
+const defaultSMTPTimeout = 10 * time.Second
+
+// Recipient is an address that receives the notifications matching all of
+// its filters: notification Types, DeviceIDs and device Labels. A recipient
+// without filters receives everything. A recipient with OnCall instead of
+// an Address is whoever is on call for that schedule when the notification
+// is sent.
+type Recipient struct {
+	Address   string            `yaml:"address"`
+	OnCall    string            `yaml:"oncall"`
+	Types     []string          `yaml:"types"`
+	DeviceIDs []string          `yaml:"device_ids"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+// Matches reports whether r should receive n.
+func (r Recipient) Matches(n *alert.Notification) bool {
+	if len(r.Types) > 0 && !contains(r.Types, n.Type) {
+		return false
+	}
+	if len(r.DeviceIDs) > 0 && !contains(r.DeviceIDs, n.Device.ID) {
+		return false
+	}
+	for k, v := range r.Labels {
+		if n.Device.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// OnCallDirectory tells who is on call for a schedule at t.
+type OnCallDirectory interface {
+	Users(ctx context.Context, scheduleID string, t time.Time) ([]string, error)
+}
+
+// SMTPOptions configures an SMTPNotifier. Security is "" for plain SMTP,
+// "starttls" to upgrade the connection, or "tls" for implicit TLS. Mails are
+// rendered with Templates, which default to the built-in ones.
+type SMTPOptions struct {
+	Addr       string
+	Security   string
+	Username   string
+	Password   string
+	From       string
+	Recipients []Recipient
+	Templates  *Templates
+	TLSConfig  *tls.Config
+	Timeout    time.Duration
+}
+
+// SMTPNotifier mails notifications to the matching recipients.
+type SMTPNotifier struct {
+	name   string
+	opts   SMTPOptions
+	oncall OnCallDirectory
+}
+
+func NewSMTPNotifier(name string, opts SMTPOptions) *SMTPNotifier {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultSMTPTimeout
+	}
+	if opts.Templates == nil {
+		opts.Templates = NewTemplates()
+	}
+	opts.Templates.ensureNotifier(name, mailDefaults)
+	return &SMTPNotifier{name: name, opts: opts}
+}
+
+func (s *SMTPNotifier) Name() string {
+	return s.name
+}
+
+// SetOnCall resolves the recipients that name an on-call schedule through
+// d. It must be called before the first notification.
+func (s *SMTPNotifier) SetOnCall(d OnCallDirectory) {
+	s.oncall = d
+}
+
+func (s *SMTPNotifier) Notify(ctx context.Context, n *alert.Notification) error {
+	to, resolveErr := s.recipients(ctx, n)
+	if len(to) == 0 {
+		return resolveErr
+	}
+
+	msg, err := s.message(n, to)
+	if err != nil {
+		return err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	if err := s.send(sendCtx, to, msg); err != nil {
+		return err
+	}
+	// The mail went out, so the notification counts as delivered.
+	if resolveErr != nil {
+		log.Printf("[WARN] %v", resolveErr)
+	}
+	return nil
+}
+
+// recipients returns the addresses n is mailed to: the matching recipients
+// and the users on call the notification was routed to. Schedules that
+// cannot be resolved are reported after the others have been collected.
+func (s *SMTPNotifier) recipients(ctx context.Context, n *alert.Notification) ([]string, error) {
+	var to []string
+	var err error
+	add := func(addr string) {
+		if !contains(to, addr) {
+			to = append(to, addr)
+		}
+	}
+
+	for _, r := range s.opts.Recipients {
+		if !r.Matches(n) {
+			continue
+		}
+		if r.OnCall == "" {
+			add(r.Address)
+			continue
+		}
+		if s.oncall == nil {
+			err = fmt.Errorf("smtp: no on-call schedules for %s", r.OnCall)
+			continue
+		}
+		users, uerr := s.oncall.Users(ctx, r.OnCall, n.Time)
+		if uerr != nil {
+			err = fmt.Errorf("smtp: %w", uerr)
+			continue
+		}
+		for _, u := range users {
+			add(u)
+		}
+	}
+	for _, u := range n.OnCall {
+		add(u)
+	}
+	return to, err
+}
+
+func (s *SMTPNotifier) message(n *alert.Notification, to []string) ([]byte, error) {
+	m, err := s.opts.Templates.Render(n, s.name)
+	if err != nil {
+		return nil, fmt.Errorf("smtp: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.opts.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+		msg.WriteString("\r\n")
+		msg.WriteString(m.Body)
+		return msg.Bytes(), nil
+	}
+
+	// Plain text and HTML alternatives of the same message.
+	mw := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n", mw.Boundary())
+	msg.WriteString("\r\n")
+	for _, part := range []struct{ typ, content string }{
+		{"text/plain", m.Body},
+		{"text/html", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.typ + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+func (s *SMTPNotifier) send(ctx context.Context, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+
+	tlsConfig := s.opts.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if s.opts.Security == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer c.Close()
+
+	if s.opts.Security == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp: %s does not support STARTTLS", s.opts.Addr)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp: starttls: %w", err)
+		}
+	}
+
+	if s.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.opts.Username, s.opts.Password, host)); err != nil {
+			return fmt.Errorf("smtp: auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(s.opts.From); err != nil {
+		return fmt.Errorf("smtp: mail from: %w", err)
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return fmt.Errorf("smtp: rcpt %s: %w", addr, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp: data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: data: %w", err)
+	}
+	return c.Quit()
+}
+
+func (e NotifierEntry) smtpOptions() (SMTPOptions, error) {
+	if e.Host == "" || e.From == "" {
+		return SMTPOptions{}, fmt.Errorf("smtp needs host and from")
+	}
+	for _, r := range e.To {
+		if (r.Address == "") == (r.OnCall == "") {
+			return SMTPOptions{}, fmt.Errorf("smtp recipients need either address or oncall")
+		}
+	}
+
+	port := e.Port
+	switch e.Security {
+	case "":
+		if port == 0 {
+			port = 25
+		}
+	case "starttls":
+		if port == 0 {
+			port = 587
+		}
+	case "tls":
+		if port == 0 {
+			port = 465
+		}
+	default:
+		return SMTPOptions{}, fmt.Errorf("unsupported security %q", e.Security)
+	}
+
+	return SMTPOptions{
+		Addr:       net.JoinHostPort(e.Host, strconv.Itoa(port)),
+		Security:   e.Security,
+		Username:   e.Username,
+		Password:   os.Getenv(e.PasswordEnv),
+		From:       e.From,
+		Recipients: e.To,
+		Timeout:    time.Duration(e.TimeoutSec) * time.Second,
+		TLSConfig: &tls.Config{
+			ServerName:         e.TLSServerName,
+			InsecureSkipVerify: e.TLSSkipVerify,
+		},
+	}, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
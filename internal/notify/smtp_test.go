@@ -0,0 +1,348 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+)
+
+// mail is a message received by fakeSMTP.
+type mail struct {
+	From string
+	To   []string
+	Data string
+	Auth string
+	TLS  bool
+}
+
+// fakeSMTP is a minimal SMTP server that records the mails it receives.
+// With implicitTLS the listener speaks TLS from the start, otherwise
+// STARTTLS is offered.
+type fakeSMTP struct {
+	addr string
+	cert tls.Certificate
+
+	mu    sync.Mutex
+	mails []mail
+}
+
+func newFakeSMTP(t *testing.T, implicitTLS bool) *fakeSMTP {
+	t.Helper()
+
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	cert := ts.TLS.Certificates[0]
+	ts.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if implicitTLS {
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeSMTP{addr: ln.Addr().String(), cert: cert}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, implicitTLS)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn, isTLS bool) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	var m mail
+	m.TLS = isTLS
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch cmd {
+		case "EHLO", "HELO":
+			if m.TLS {
+				reply("250-fake\r\n250 AUTH PLAIN")
+			} else {
+				reply("250-fake\r\n250-STARTTLS\r\n250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{s.cert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, m.TLS = tlsConn, bufio.NewReader(tlsConn), true
+		case "AUTH":
+			fields := strings.Fields(line)
+			if len(fields) == 3 {
+				b, _ := base64.StdEncoding.DecodeString(fields[2])
+				m.Auth = string(b)
+			}
+			reply("235 ok")
+		case "MAIL":
+			m.From = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			reply("250 ok")
+		case "RCPT":
+			m.To = append(m.To, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			m.Data = data.String()
+			s.mu.Lock()
+			s.mails = append(s.mails, m)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTP) received() []mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mail(nil), s.mails...)
+}
+
+func testNotification(typ string) *alert.Notification {
+	at := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	return &alert.Notification{
+		Type: typ,
+		Device: &device.Device{
+			ID:      "web",
+			Name:    "web1",
+			Address: "10.0.0.1:443",
+			Labels:  map[string]string{"team": "web"},
+		},
+		Health: &health.HealthStatus{DeviceID: "web", Status: "DOWN", Latency: 12, LastCheck: at},
+		Since:  at,
+		Time:   at,
+	}
+}
+
+func TestSMTPNotifierRoutesRecipients(t *testing.T) {
+	srv := newFakeSMTP(t, false)
+
+	tmpl := NewTemplates()
+	if err := tmpl.setNotifier("mail", mailDefaults, map[string]TemplateConfig{
+		EventProblem: {Subject: "{{.Device.Address}} {{.Health.Status}}"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := NewSMTPNotifier("mail", SMTPOptions{
+		Addr:     srv.addr,
+		Username: "monitor",
+		Password: "secret",
+		From:     "monitor@example.com",
+		Recipients: []Recipient{
+			{Address: "oncall@example.com"},
+			{Address: "web@example.com", Labels: map[string]string{"team": "web"}, Types: []string{alert.TypeProblem}},
+			{Address: "db@example.com", Labels: map[string]string{"team": "db"}},
+		},
+		Templates: tmpl,
+	})
+
+	if err := n.Notify(context.Background(), testNotification(alert.TypeProblem)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if err := n.Notify(context.Background(), testNotification(alert.TypeRecovery)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	mails := srv.received()
+	if len(mails) != 2 {
+		t.Fatalf("got %d mails, want 2", len(mails))
+	}
+
+	m := mails[0]
+	if m.From != "monitor@example.com" || strings.Join(m.To, ",") != "oncall@example.com,web@example.com" {
+		t.Fatalf("unexpected envelope: %+v", m)
+	}
+	if m.Auth != "\x00monitor\x00secret" {
+		t.Fatalf("unexpected auth: %q", m.Auth)
+	}
+	if !strings.Contains(m.Data, "Subject: 10.0.0.1:443 DOWN\r\n") {
+		t.Fatalf("subject not rendered:\n%s", m.Data)
+	}
+	if !strings.Contains(m.Data, "PROBLEM for web1 (10.0.0.1:443)") || !strings.Contains(m.Data, "Latency: 12 ms") {
+		t.Fatalf("default body not rendered:\n%s", m.Data)
+	}
+
+	if strings.Join(mails[1].To, ",") != "oncall@example.com" {
+		t.Fatalf("recovery sent to %v", mails[1].To)
+	}
+}
+
+func TestSMTPNotifierTLS(t *testing.T) {
+	for _, security := range []string{"starttls", "tls"} {
+		t.Run(security, func(t *testing.T) {
+			srv := newFakeSMTP(t, security == "tls")
+
+			host, port, _ := net.SplitHostPort(srv.addr)
+			entry := NotifierEntry{
+				Type:          "smtp",
+				Host:          host,
+				Security:      security,
+				From:          "monitor@example.com",
+				To:            []Recipient{{Address: "oncall@example.com"}},
+				Subject:       `{{.Type}} {{.Device.ID}}`,
+				TLSSkipVerify: true,
+			}
+			entry.Port, _ = strconv.Atoi(port)
+
+			n, err := entry.build("mail", NewTemplates())
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			if err := n.Notify(context.Background(), testNotification(alert.TypeProblem)); err != nil {
+				t.Fatalf("Notify: %v", err)
+			}
+
+			mails := srv.received()
+			if len(mails) != 1 || !mails[0].TLS {
+				t.Fatalf("mail not sent over TLS: %+v", mails)
+			}
+			if !strings.Contains(mails[0].Data, "Subject: PROBLEM web\r\n") {
+				t.Fatalf("subject not rendered:\n%s", mails[0].Data)
+			}
+		})
+	}
+}
+
+func TestSMTPNotifierRequiresStartTLS(t *testing.T) {
+	// An implicit TLS server never offers STARTTLS over plain text.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		_, _ = conn.Write([]byte("220 fake ESMTP\r\n"))
+		_, _ = r.ReadString('\n')
+		_, _ = conn.Write([]byte("250 fake\r\n"))
+		_, _ = r.ReadString('\n')
+	}()
+
+	n := NewSMTPNotifier("mail", SMTPOptions{
+		Addr:       ln.Addr().String(),
+		Security:   "starttls",
+		From:       "monitor@example.com",
+		Recipients: []Recipient{{Address: "oncall@example.com"}},
+	})
+	if err := n.Notify(context.Background(), testNotification(alert.TypeProblem)); err == nil {
+		t.Fatalf("mail sent without STARTTLS")
+	}
+}
+
+type stubOnCall map[string][]string
+
+func (s stubOnCall) Users(ctx context.Context, scheduleID string, t time.Time) ([]string, error) {
+	users, ok := s[scheduleID]
+	if !ok {
+		return nil, fmt.Errorf("unknown schedule %s", scheduleID)
+	}
+	return users, nil
+}
+
+func TestSMTPNotifierOnCallRecipients(t *testing.T) {
+	srv := newFakeSMTP(t, false)
+
+	n := NewSMTPNotifier("mail", SMTPOptions{
+		Addr: srv.addr,
+		From: "monitor@example.com",
+		Recipients: []Recipient{
+			{Address: "ops@example.com"},
+			{OnCall: "web"},
+			{OnCall: "db"},
+		},
+	})
+	n.SetOnCall(stubOnCall{"web": {"alice@example.com", "ops@example.com"}})
+
+	// The unknown schedule is logged, the others are still mailed.
+	if err := n.Notify(context.Background(), testNotification(alert.TypeProblem)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	mails := srv.received()
+	if len(mails) != 1 || strings.Join(mails[0].To, ",") != "ops@example.com,alice@example.com" {
+		t.Fatalf("unexpected mails: %+v", mails)
+	}
+
+	// Users on call picked by routing are mailed by a notifier without
+	// recipients of its own.
+	entry := NotifierEntry{Type: "smtp", Host: "127.0.0.1", From: "monitor@example.com"}
+	_, port, _ := net.SplitHostPort(srv.addr)
+	entry.Port, _ = strconv.Atoi(port)
+	routed, err := entry.build("routed", NewTemplates())
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	notif := testNotification(alert.TypeProblem)
+	notif.OnCall = []string{"bob@example.com"}
+	if err := routed.Notify(context.Background(), notif); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if mails := srv.received(); len(mails) != 2 || strings.Join(mails[1].To, ",") != "bob@example.com" {
+		t.Fatalf("unexpected mails: %+v", mails)
+	}
+
+	// Without anybody to mail, the failure is returned.
+	only := NewSMTPNotifier("mail", SMTPOptions{
+		Addr:       srv.addr,
+		From:       "monitor@example.com",
+		Recipients: []Recipient{{OnCall: "db"}},
+	})
+	only.SetOnCall(stubOnCall{})
+	if err := only.Notify(context.Background(), testNotification(alert.TypeProblem)); err == nil || !strings.Contains(err.Error(), "unknown schedule db") {
+		t.Fatalf("Notify = %v", err)
+	}
+}
@@ -0,0 +1,309 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+)
+
+// Events that templates are defined for. FLAPPING covers the start and the
+// end of flapping.
+const (
+	EventProblem  = "PROBLEM"
+	EventRecovery = "RECOVERY"
+	EventAck      = "ACK"
+	EventFlapping = "FLAPPING"
+)
+
+var events = []string{EventProblem, EventRecovery, EventAck, EventFlapping}
+
+// Event returns the template event of a notification type.
+func Event(typ string) string {
+	switch typ {
+	case alert.TypeAcknowledgement:
+		return EventAck
+	case alert.TypeFlappingStart, alert.TypeFlappingStop:
+		return EventFlapping
+	}
+	return typ
+}
+
+var defaultSubjects = map[string]string{
+	EventProblem:  `{{.Type}}: {{.Device.Name}}{{with .Health}} is {{.Status}}{{end}}`,
+	EventRecovery: `{{.Type}}: {{.Device.Name}}{{with .Health}} is {{.Status}}{{end}}`,
+	EventAck:      `{{.Type}}: {{.Device.Name}} acknowledged`,
+	EventFlapping: `{{.Type}}: {{.Device.Name}} {{if eq .Type "FLAPPINGSTART"}}started{{else}}stopped{{end}} flapping`,
+}
+
+const defaultMailBody = `{{.Type}} for {{.Device.Name}} ({{.Device.Address}})
+{{with .Health}}
+Status:  {{.Status}}
+Latency: {{.Latency}} ms
+Checked: {{timestamp .LastCheck}}
+{{end}}
+Since:   {{timestamp .Since}} ({{duration .Duration}})
+{{with .Ack}}
+Acknowledged by {{.Author}}: {{.Comment}}
+{{end}}`
+
+// TemplateConfig holds the templates of an event. Subject and Body are
+// text/template, HTML is html/template; empty ones fall back to the next
+// level.
+type TemplateConfig struct {
+	Subject string `yaml:"subject" json:"subject,omitempty"`
+	Body    string `yaml:"body" json:"body,omitempty"`
+	HTML    string `yaml:"html" json:"html,omitempty"`
+}
+
+// Message is a rendered notification.
+type Message struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// TemplateData is what templates are executed with: the notification and
+// how long its state has lasted.
+type TemplateData struct {
+	*alert.Notification
+	Event    string
+	Duration time.Duration
+}
+
+type eventTemplates struct {
+	subject *template.Template
+	body    *template.Template
+	html    *htmltemplate.Template
+}
+
+// templateSet maps events to their templates.
+type templateSet map[string]*eventTemplates
+
+var funcs = template.FuncMap{
+	"duration":   humanDuration,
+	"timestamp":  func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"formatTime": func(layout string, t time.Time) string { return t.Format(layout) },
+	"inZone":     inZone,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"join":       strings.Join,
+}
+
+func compileSet(name string, cfg map[string]TemplateConfig) (templateSet, error) {
+	set := make(templateSet)
+	for event, c := range cfg {
+		if !contains(events, event) {
+			return nil, fmt.Errorf("templates %s: unknown event %q", name, event)
+		}
+		et, err := compileEvent(name+"/"+event, c)
+		if err != nil {
+			return nil, err
+		}
+		set[event] = et
+	}
+	return set, nil
+}
+
+func compileEvent(name string, c TemplateConfig) (*eventTemplates, error) {
+	et := &eventTemplates{}
+
+	var err error
+	if c.Subject != "" {
+		if et.subject, err = template.New(name + "/subject").Funcs(funcs).Parse(c.Subject); err != nil {
+			return nil, err
+		}
+	}
+	if c.Body != "" {
+		if et.body, err = template.New(name + "/body").Funcs(funcs).Parse(c.Body); err != nil {
+			return nil, err
+		}
+	}
+	if c.HTML != "" {
+		if et.html, err = htmltemplate.New(name + "/html").Funcs(htmltemplate.FuncMap(funcs)).Parse(c.HTML); err != nil {
+			return nil, err
+		}
+	}
+	return et, nil
+}
+
+func mustCompileSet(name string, subjects map[string]string, body string) templateSet {
+	cfg := make(map[string]TemplateConfig)
+	for _, event := range events {
+		cfg[event] = TemplateConfig{Subject: subjects[event], Body: body}
+	}
+	set, err := compileSet(name, cfg)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// Built-in templates of mail and chat notifiers.
+var (
+	mailDefaults = mustCompileSet("mail", defaultSubjects, defaultMailBody)
+	chatDefaults = mustCompileSet("chat", defaultSubjects, "")
+)
+
+type notifierTemplates struct {
+	defaults  templateSet
+	overrides templateSet
+}
+
+// Templates renders notifications. The templates of an event are looked up
+// in the overrides of the notification's route, then of the notifier, then
+// the global ones, and last the built-in defaults of the notifier kind.
+type Templates struct {
+	global    templateSet
+	notifiers map[string]notifierTemplates
+	routes    map[string]templateSet
+}
+
+func NewTemplates() *Templates {
+	return &Templates{
+		global:    make(templateSet),
+		notifiers: make(map[string]notifierTemplates),
+		routes:    make(map[string]templateSet),
+	}
+}
+
+// SetGlobal sets the templates every notifier uses unless overridden.
+func (t *Templates) SetGlobal(cfg map[string]TemplateConfig) error {
+	set, err := compileSet("global", cfg)
+	if err != nil {
+		return err
+	}
+	t.global = set
+	return nil
+}
+
+// SetRoute sets the templates of the notifications following a routing rule.
+func (t *Templates) SetRoute(rule string, cfg map[string]TemplateConfig) error {
+	set, err := compileSet("route "+rule, cfg)
+	if err != nil {
+		return err
+	}
+	t.routes[rule] = set
+	return nil
+}
+
+func (t *Templates) setNotifier(name string, defaults templateSet, cfg map[string]TemplateConfig) error {
+	set, err := compileSet("notifier "+name, cfg)
+	if err != nil {
+		return err
+	}
+	t.notifiers[name] = notifierTemplates{defaults: defaults, overrides: set}
+	return nil
+}
+
+// ensureNotifier makes sure a notifier created outside LoadConfig renders
+// with the defaults of its kind.
+func (t *Templates) ensureNotifier(name string, defaults templateSet) {
+	if _, ok := t.notifiers[name]; !ok {
+		t.notifiers[name] = notifierTemplates{defaults: defaults}
+	}
+}
+
+// Render renders n for the named notifier.
+func (t *Templates) Render(n *alert.Notification, notifier string) (*Message, error) {
+	return t.render(n, notifier, nil)
+}
+
+// Preview renders n for the named notifier like Render, with cfg taking
+// precedence over every configured template.
+func (t *Templates) Preview(n *alert.Notification, notifier string, cfg TemplateConfig) (*Message, error) {
+	et, err := compileEvent("preview", cfg)
+	if err != nil {
+		return nil, err
+	}
+	return t.render(n, notifier, et)
+}
+
+func (t *Templates) render(n *alert.Notification, notifier string, first *eventTemplates) (*Message, error) {
+	event := Event(n.Type)
+
+	nt, ok := t.notifiers[notifier]
+	if !ok {
+		nt.defaults = mailDefaults
+	}
+	layers := []*eventTemplates{first, t.routes[n.Route][event], nt.overrides[event], t.global[event], nt.defaults[event]}
+
+	data := &TemplateData{Notification: n, Event: event, Duration: n.Time.Sub(n.Since)}
+	msg := &Message{}
+
+	for _, l := range layers {
+		if l != nil && l.subject != nil {
+			s, err := execute(l.subject, data)
+			if err != nil {
+				return nil, err
+			}
+			msg.Subject = strings.TrimSpace(s)
+			break
+		}
+	}
+	for _, l := range layers {
+		if l != nil && l.body != nil {
+			s, err := execute(l.body, data)
+			if err != nil {
+				return nil, err
+			}
+			msg.Body = s
+			break
+		}
+	}
+	for _, l := range layers {
+		if l != nil && l.html != nil {
+			var b bytes.Buffer
+			if err := l.html.Execute(&b, data); err != nil {
+				return nil, err
+			}
+			msg.HTML = b.String()
+			break
+		}
+	}
+	return msg, nil
+}
+
+func execute(tmpl *template.Template, data *TemplateData) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// humanDuration formats d like "2d 3h 4m", or in seconds below a minute.
+func humanDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return d.String()
+	}
+
+	days := d / (24 * time.Hour)
+	hours := d % (24 * time.Hour) / time.Hour
+	minutes := d % time.Hour / time.Minute
+
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	return strings.Join(parts, " ")
+}
+
+func inZone(name string, t time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return t, err
+	}
+	return t.In(loc), nil
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+)
+
+func TestTemplatesLookupOrder(t *testing.T) {
+	tmpl := NewTemplates()
+	if err := tmpl.SetGlobal(map[string]TemplateConfig{
+		EventProblem:  {Subject: "global {{.Device.Name}}", Body: "global body"},
+		EventRecovery: {Body: "global recovery"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.setNotifier("mail", mailDefaults, map[string]TemplateConfig{
+		EventProblem: {Subject: "mail {{.Device.Name}}"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.SetRoute("db", map[string]TemplateConfig{
+		EventProblem: {Subject: "db {{.Device.Name}}"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		notifier, route, typ string
+		subject, body        string
+	}{
+		{"mail", "db", alert.TypeProblem, "db web1", "global body"},
+		{"mail", "", alert.TypeProblem, "mail web1", "global body"},
+		{"chat", "", alert.TypeProblem, "global web1", "global body"},
+		{"mail", "db", alert.TypeRecovery, "RECOVERY: web1 is DOWN", "global recovery"},
+	}
+	for _, tt := range tests {
+		n := testNotification(tt.typ)
+		n.Route = tt.route
+		msg, err := tmpl.Render(n, tt.notifier)
+		if err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		if msg.Subject != tt.subject || msg.Body != tt.body {
+			t.Errorf("%s/%s/%s: got %q / %q, want %q / %q", tt.notifier, tt.route, tt.typ, msg.Subject, msg.Body, tt.subject, tt.body)
+		}
+	}
+
+	preview, err := tmpl.Preview(testNotification(alert.TypeProblem), "mail", TemplateConfig{Subject: "preview"})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if preview.Subject != "preview" || preview.Body != "global body" {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	tmpl := NewTemplates()
+	err := tmpl.SetGlobal(map[string]TemplateConfig{
+		EventFlapping: {
+			Subject: `{{upper .Device.Name}} {{.Event}}`,
+			Body:    `{{duration .Duration}}|{{timestamp .Since}}|{{formatTime "15:04" (inZone "Asia/Taipei" .Since)}}|{{join .Device.Parents ","}}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := testNotification(alert.TypeFlappingStart)
+	n.Time = n.Since.Add(26*time.Hour + 5*time.Minute + 30*time.Second)
+	n.Device.Parents = []string{"core", "edge"}
+
+	msg, err := tmpl.Render(n, "mail")
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if msg.Subject != "WEB1 FLAPPING" {
+		t.Errorf("subject = %q", msg.Subject)
+	}
+	if want := "1d 2h 5m|2026-03-02T07:00:00Z|15:00|core,edge"; msg.Body != want {
+		t.Errorf("body = %q, want %q", msg.Body, want)
+	}
+
+	if got := humanDuration(42 * time.Second); got != "42s" {
+		t.Errorf("humanDuration = %q", got)
+	}
+}
+
+func TestTemplatesRejectUnknownEvents(t *testing.T) {
+	tmpl := NewTemplates()
+	if err := tmpl.SetGlobal(map[string]TemplateConfig{"OUTAGE": {Subject: "x"}}); err == nil {
+		t.Fatalf("unknown event accepted")
+	}
+	if err := tmpl.SetRoute("db", map[string]TemplateConfig{EventProblem: {Subject: "{{.Nope"}}); err == nil {
+		t.Fatalf("invalid template accepted")
+	}
+}
+
+func TestSMTPNotifierHTML(t *testing.T) {
+	srv := newFakeSMTP(t, false)
+
+	tmpl := NewTemplates()
+	if err := tmpl.SetGlobal(map[string]TemplateConfig{
+		EventProblem: {HTML: `<p>{{.Device.Name}} is <b>{{.Health.Status}}</b></p>`},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := NewSMTPNotifier("mail", SMTPOptions{
+		Addr:       srv.addr,
+		From:       "monitor@example.com",
+		Recipients: []Recipient{{Address: "oncall@example.com"}},
+		Templates:  tmpl,
+	})
+	if err := n.Notify(context.Background(), testNotification(alert.TypeProblem)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	mails := srv.received()
+	if len(mails) != 1 {
+		t.Fatalf("got %d mails, want 1", len(mails))
+	}
+	data := mails[0].Data
+	for _, want := range []string{
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=UTF-8",
+		"PROBLEM for web1 (10.0.0.1:443)",
+		"Content-Type: text/html; charset=UTF-8",
+		"<p>web1 is <b>DOWN</b></p>",
+	} {
+		if !strings.Contains(data, want) {
+			t.Fatalf("mail lacks %q:\n%s", want, data)
+		}
+	}
+}
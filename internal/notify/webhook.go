@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// Webhook formats. FormatJSON posts the notification itself, the others
+// render the native message format of the chat tool.
+const (
+	FormatJSON       = "webhook"
+	FormatSlack      = "slack"
+	FormatMattermost = "mattermost"
+	FormatDiscord    = "discord"
+	FormatTeams      = "teams"
+)
+
+// WebhookOptions configures a WebhookNotifier. Channel, Username and IconURL
+// override the defaults of the incoming webhook where the chat tool allows
+// it. Link, executed with the *alert.Notification, is the URL the message
+// links to, e.g. a dashboard page of the device. The title and text of the
+// message are rendered with Templates, which default to the built-in ones.
+type WebhookOptions struct {
+	URL       string
+	Format    string
+	Channel   string
+	Username  string
+	IconURL   string
+	Link      *template.Template
+	Headers   map[string]string
+	Templates *Templates
+	Timeout   time.Duration
+}
+
+// WebhookNotifier posts notifications to a webhook.
+type WebhookNotifier struct {
+	name   string
+	opts   WebhookOptions
+	client *http.Client
+}
+
+func NewWebhookNotifier(name string, opts WebhookOptions) *WebhookNotifier {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultWebhookTimeout
+	}
+	if opts.Format == "" {
+		opts.Format = FormatJSON
+	}
+	if opts.Templates == nil {
+		opts.Templates = NewTemplates()
+	}
+	opts.Templates.ensureNotifier(name, chatDefaults)
+	return &WebhookNotifier{
+		name:   name,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+	}
+}
+
+func (w *WebhookNotifier) Name() string {
+	return w.name
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n *alert.Notification) error {
+	payload, err := w.payload(n)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// jsonPayload is what FormatJSON posts: the notification and its rendered
+// message.
+type jsonPayload struct {
+	*alert.Notification
+	Message *Message `json:"message"`
+}
+
+func (w *WebhookNotifier) payload(n *alert.Notification) (interface{}, error) {
+	msg, err := w.opts.Templates.Render(n, w.name)
+	if err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+
+	link := ""
+	if w.opts.Link != nil {
+		var b strings.Builder
+		if err := w.opts.Link.Execute(&b, n); err != nil {
+			return nil, fmt.Errorf("webhook: link: %w", err)
+		}
+		link = b.String()
+	}
+
+	switch w.opts.Format {
+	case FormatJSON:
+		return jsonPayload{Notification: n, Message: msg}, nil
+	case FormatSlack, FormatMattermost:
+		return slackMessage(n, msg, w.opts, link), nil
+	case FormatDiscord:
+		return discordMessage(n, msg, w.opts, link), nil
+	case FormatTeams:
+		return teamsMessage(n, msg, link), nil
+	default:
+		return nil, fmt.Errorf("webhook: unknown format %q", w.opts.Format)
+	}
+}
+
+func (e NotifierEntry) webhookOptions() (WebhookOptions, error) {
+	url := e.URL
+	if e.URLEnv != "" {
+		url = os.Getenv(e.URLEnv)
+	}
+	if url == "" {
+		return WebhookOptions{}, fmt.Errorf("%s needs url or url_env", e.Type)
+	}
+
+	opts := WebhookOptions{
+		URL:      url,
+		Format:   e.Type,
+		Channel:  e.Channel,
+		Username: e.DisplayName,
+		IconURL:  e.IconURL,
+		Headers:  e.Headers,
+		Timeout:  time.Duration(e.TimeoutSec) * time.Second,
+	}
+	if e.Link != "" {
+		link, err := template.New("link").Parse(e.Link)
+		if err != nil {
+			return WebhookOptions{}, err
+		}
+		opts.Link = link
+	}
+	return opts, nil
+}
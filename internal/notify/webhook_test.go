@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Rin0913/monitor/internal/alert"
+)
+
+// serveWebhook records the JSON bodies posted to it.
+func serveWebhook(t *testing.T, status int) (*httptest.Server, *[]map[string]interface{}) {
+	t.Helper()
+
+	var bodies []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Errorf("invalid json %s: %v", b, err)
+		}
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("no_text"))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &bodies
+}
+
+// lookup walks a decoded JSON document, e.g. lookup(v, "embeds", 0, "title").
+func lookup(v interface{}, path ...interface{}) interface{} {
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			m, _ := v.(map[string]interface{})
+			v = m[k]
+		case int:
+			a, _ := v.([]interface{})
+			if k >= len(a) {
+				return nil
+			}
+			v = a[k]
+		}
+	}
+	return v
+}
+
+func TestWebhookFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   map[string][]interface{}
+	}{
+		{FormatJSON, map[string][]interface{}{
+			"PROBLEM": {"type"},
+			"web":     {"device", "id"},
+			"DOWN":    {"health", "status"},
+			"alice":   {"oncall", 0},
+		}},
+		{FormatSlack, map[string][]interface{}{
+			"#ops":                        {"channel"},
+			"monitor-bot":                 {"username"},
+			"#d50200":                     {"attachments", 0, "color"},
+			"PROBLEM: web1 is DOWN":       {"attachments", 0, "title"},
+			"https://mon.example.com/web": {"attachments", 0, "title_link"},
+			"Latency":                     {"attachments", 0, "fields", 3, "title"},
+			"12 ms":                       {"attachments", 0, "fields", 3, "value"},
+			"internal#1":                  {"attachments", 0, "fields", 4, "value"},
+			"On call":                     {"attachments", 0, "fields", 6, "title"},
+		}},
+		{FormatMattermost, map[string][]interface{}{
+			"#d50200":      {"attachments", 0, "color"},
+			"10.0.0.1:443": {"attachments", 0, "fields", 1, "value"},
+		}},
+		{FormatDiscord, map[string][]interface{}{
+			"monitor-bot":                 {"username"},
+			"PROBLEM: web1 is DOWN":       {"embeds", 0, "title"},
+			"https://mon.example.com/web": {"embeds", 0, "url"},
+			"Runner":                      {"embeds", 0, "fields", 4, "name"},
+		}},
+		{FormatTeams, map[string][]interface{}{
+			"MessageCard":                 {"@type"},
+			"d50200":                      {"themeColor"},
+			"PROBLEM: web1 is DOWN":       {"title"},
+			"DOWN":                        {"sections", 0, "facts", 2, "value"},
+			"https://mon.example.com/web": {"potentialAction", 0, "targets", 0, "uri"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			ts, bodies := serveWebhook(t, http.StatusOK)
+
+			entry := NotifierEntry{
+				Type:        tt.format,
+				URL:         ts.URL,
+				Channel:     "#ops",
+				DisplayName: "monitor-bot",
+				Link:        "https://mon.example.com/{{.Device.ID}}",
+			}
+			n, err := entry.build("chat", NewTemplates())
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+
+			notif := testNotification(alert.TypeProblem)
+			notif.Health.Runner = "internal#1"
+			notif.OnCall = []string{"alice"}
+			if err := n.Notify(context.Background(), notif); err != nil {
+				t.Fatalf("Notify: %v", err)
+			}
+
+			if len(*bodies) != 1 {
+				t.Fatalf("got %d requests", len(*bodies))
+			}
+			body := (*bodies)[0]
+			for want, path := range tt.want {
+				if got := lookup(body, path...); got != want {
+					t.Errorf("%v = %v, want %q", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookColourByStatus(t *testing.T) {
+	recovery := testNotification(alert.TypeRecovery)
+	recovery.Health.Status = "UP"
+	unknown := testNotification(alert.TypeProblem)
+	unknown.Health.Status = "UNKNOWN"
+
+	for n, want := range map[*alert.Notification]string{
+		testNotification(alert.TypeProblem): colorProblem,
+		unknown:                             colorWarning,
+		recovery:                            colorRecovery,
+	} {
+		if got := color(n); got != want {
+			t.Errorf("color(%s %s) = %s, want %s", n.Type, n.Health.Status, got, want)
+		}
+	}
+}
+
+func TestWebhookReportsFailures(t *testing.T) {
+	ts, _ := serveWebhook(t, http.StatusBadRequest)
+
+	n := NewWebhookNotifier("chat", WebhookOptions{URL: ts.URL, Format: FormatSlack})
+	err := n.Notify(context.Background(), testNotification(alert.TypeProblem))
+	if err == nil || !strings.Contains(err.Error(), "no_text") {
+		t.Fatalf("expected failure with response body, got %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	ts, bodies := serveWebhook(t, http.StatusNoContent)
+	t.Setenv("TEST_HOOK_URL", ts.URL)
+
+	path := filepath.Join(t.TempDir(), "notifiers.yaml")
+	config := `
+notifiers:
+  ops_chat:
+    type: slack
+    url_env: TEST_HOOK_URL
+  audit:
+    type: webhook
+    url: ` + ts.URL + `
+    headers:
+      Authorization: Bearer token
+    templates:
+      PROBLEM:
+        subject: "audit {{.Device.ID}}"
+templates:
+  PROBLEM:
+    subject: "global {{.Device.ID}}"
+`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	notifiers, tmpl, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(notifiers) != 2 || notifiers[0].Name() != "audit" || notifiers[1].Name() != "ops_chat" {
+		t.Fatalf("unexpected notifiers: %v", notifiers)
+	}
+	for _, n := range notifiers {
+		if err := n.Notify(context.Background(), testNotification(alert.TypeProblem)); err != nil {
+			t.Fatalf("%s: %v", n.Name(), err)
+		}
+	}
+	if len(*bodies) != 2 {
+		t.Fatalf("got %d requests", len(*bodies))
+	}
+
+	n := testNotification(alert.TypeProblem)
+	for notifier, want := range map[string]string{"audit": "audit web", "ops_chat": "global web"} {
+		if msg, err := tmpl.Render(n, notifier); err != nil || msg.Subject != want {
+			t.Errorf("%s: subject %+v, %v, want %q", notifier, msg, err, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("notifiers:\n  x:\n    type: pager\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadConfig(path); err == nil {
+		t.Fatalf("unknown type accepted")
+	}
+}
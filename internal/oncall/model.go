@@ -0,0 +1,219 @@
+package oncall
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultShiftDays = 7
+
+// Schedule says who is on call. Each rotation hands off to the next of its
+// Users every ShiftDays days at Handoff (HH:MM, midnight if empty) in
+// Timezone (UTC if empty), the first user taking the shift starting on
+// Start (YYYY-MM-DD). All rotations are on call at the same time, e.g. a
+// primary and a secondary one. Users are the addresses notifiers reach
+// them at.
+type Schedule struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Timezone  string     `json:"timezone,omitempty"`
+	Rotations []Rotation `json:"rotations"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	loc *time.Location
+}
+
+type Rotation struct {
+	Name      string   `json:"name"`
+	Users     []string `json:"users"`
+	Start     string   `json:"start"`
+	Handoff   string   `json:"handoff,omitempty"`
+	ShiftDays int      `json:"shift_days,omitempty"`
+
+	start  time.Time // the day of Start, in UTC
+	hour   int
+	minute int
+}
+
+// Override puts User on call instead of the rotation users between StartsAt
+// and EndsAt, for the named Rotation or, if empty, for all of them.
+type Override struct {
+	ID         string    `json:"id"`
+	ScheduleID string    `json:"schedule_id"`
+	Rotation   string    `json:"rotation,omitempty"`
+	User       string    `json:"user"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Shift is who is on call for a rotation, from Start to End. Override is
+// the ID of the override that put User on call, if any.
+type Shift struct {
+	Rotation string    `json:"rotation"`
+	User     string    `json:"user"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Override string    `json:"override,omitempty"`
+}
+
+// Validate checks s and prepares its rotations.
+func (s *Schedule) Validate() error {
+	if s.ID == "" {
+		return fmt.Errorf("%w: schedule needs an id", ErrInvalidSchedule)
+	}
+	if len(s.Rotations) == 0 {
+		return fmt.Errorf("%w: schedule %s has no rotations", ErrInvalidSchedule, s.ID)
+	}
+
+	s.loc = time.UTC
+	if s.Timezone != "" {
+		loc, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return fmt.Errorf("%w: invalid timezone %q", ErrInvalidSchedule, s.Timezone)
+		}
+		s.loc = loc
+	}
+
+	names := make(map[string]bool)
+	for i := range s.Rotations {
+		r := &s.Rotations[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rotation-%d", i+1)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("%w: duplicate rotation %s", ErrInvalidSchedule, r.Name)
+		}
+		names[r.Name] = true
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("%w: rotation %s: %v", ErrInvalidSchedule, r.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rotation) validate() error {
+	if len(r.Users) == 0 {
+		return fmt.Errorf("no users")
+	}
+	if r.ShiftDays == 0 {
+		r.ShiftDays = defaultShiftDays
+	}
+	if r.ShiftDays < 0 {
+		return fmt.Errorf("shift_days must be > 0")
+	}
+
+	start, err := time.Parse(time.DateOnly, r.Start)
+	if err != nil {
+		return fmt.Errorf("invalid start %q, want YYYY-MM-DD", r.Start)
+	}
+	r.start = start
+
+	r.hour, r.minute = 0, 0
+	if r.Handoff != "" {
+		h, err := time.Parse("15:04", r.Handoff)
+		if err != nil {
+			return fmt.Errorf("invalid handoff %q, want HH:MM", r.Handoff)
+		}
+		r.hour, r.minute = h.Hour(), h.Minute()
+	}
+	return nil
+}
+
+// Rotation returns the named rotation of s.
+func (s *Schedule) Rotation(name string) *Rotation {
+	for i := range s.Rotations {
+		if s.Rotations[i].Name == name {
+			return &s.Rotations[i]
+		}
+	}
+	return nil
+}
+
+// handoff returns the time the shift starting n days after Start begins.
+// Hand-offs are counted in calendar days, so they stay at the same local
+// time across DST changes.
+func (r *Rotation) handoff(n int, loc *time.Location) time.Time {
+	return time.Date(r.start.Year(), r.start.Month(), r.start.Day()+n, r.hour, r.minute, 0, 0, loc)
+}
+
+// shift returns the rotation's shift at t. ok is false before the first
+// shift.
+func (r *Rotation) shift(t time.Time, loc *time.Location) (sh Shift, ok bool) {
+	local := t.In(loc)
+
+	// Days since Start, minus one if today's hand-off is still to come.
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(today.Sub(r.start).Hours()) / 24
+	if local.Before(r.handoff(days, loc)) {
+		days--
+	}
+	if days < 0 {
+		return Shift{}, false
+	}
+
+	n := days / r.ShiftDays
+	return Shift{
+		Rotation: r.Name,
+		User:     r.Users[n%len(r.Users)],
+		Start:    r.handoff(n*r.ShiftDays, loc),
+		End:      r.handoff((n+1)*r.ShiftDays, loc),
+	}, true
+}
+
+// At returns the shifts of s at t, one per rotation that has someone on
+// call. The latest override covering a rotation at t replaces its shift.
+func (s *Schedule) At(t time.Time, overrides []*Override) []Shift {
+	var res []Shift
+	for i := range s.Rotations {
+		r := &s.Rotations[i]
+		sh, ok := r.shift(t, s.loc)
+
+		var latest *Override
+		for _, o := range overrides {
+			if o.Applies(r.Name) && o.Active(t) && (latest == nil || o.CreatedAt.After(latest.CreatedAt)) {
+				latest = o
+			}
+		}
+		if latest != nil {
+			sh = Shift{
+				Rotation: r.Name,
+				User:     latest.User,
+				Start:    latest.StartsAt,
+				End:      latest.EndsAt,
+				Override: latest.ID,
+			}
+			ok = true
+		}
+
+		if ok {
+			res = append(res, sh)
+		}
+	}
+	return res
+}
+
+// Validate checks o against the schedule it belongs to.
+func (o *Override) Validate(s *Schedule) error {
+	if o.User == "" {
+		return fmt.Errorf("%w: override needs a user", ErrInvalidOverride)
+	}
+	if o.StartsAt.IsZero() || !o.EndsAt.After(o.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidOverride)
+	}
+	if o.Rotation != "" && s.Rotation(o.Rotation) == nil {
+		return fmt.Errorf("%w: schedule %s has no rotation %s", ErrInvalidOverride, s.ID, o.Rotation)
+	}
+	return nil
+}
+
+// Applies reports whether o overrides the named rotation.
+func (o *Override) Applies(rotation string) bool {
+	return o.Rotation == "" || o.Rotation == rotation
+}
+
+// Active reports whether o is in effect at t.
+func (o *Override) Active(t time.Time) bool {
+	return !t.Before(o.StartsAt) && t.Before(o.EndsAt)
+}
@@ -0,0 +1,247 @@
+package oncall
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotationHandoffs(t *testing.T) {
+	sch := &Schedule{
+		ID: "ops",
+		Rotations: []Rotation{
+			{Name: "primary", Users: []string{"alice", "bob"}, Start: "2026-03-02", Handoff: "09:00"},
+		},
+	}
+	if err := sch.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		t          time.Time
+		user       string
+		start, end time.Time
+	}{
+		{at(2, 8, 59), "", time.Time{}, time.Time{}},
+		{at(2, 9, 0), "alice", at(2, 9, 0), at(9, 9, 0)},
+		{at(9, 8, 59), "alice", at(2, 9, 0), at(9, 9, 0)},
+		{at(9, 9, 0), "bob", at(9, 9, 0), at(16, 9, 0)},
+		{at(16, 9, 0), "alice", at(16, 9, 0), at(23, 9, 0)},
+	}
+	for i, tt := range tests {
+		shifts := sch.At(tt.t, nil)
+		if tt.user == "" {
+			if len(shifts) != 0 {
+				t.Errorf("#%d: on call before the first shift: %+v", i, shifts)
+			}
+			continue
+		}
+		if len(shifts) != 1 {
+			t.Fatalf("#%d: got %d shifts", i, len(shifts))
+		}
+		sh := shifts[0]
+		if sh.User != tt.user || !sh.Start.Equal(tt.start) || !sh.End.Equal(tt.end) {
+			t.Errorf("#%d: got %s %s-%s, want %s %s-%s", i, sh.User, sh.Start, sh.End, tt.user, tt.start, tt.end)
+		}
+	}
+}
+
+func TestRotationKeepsLocalHandoffAcrossDST(t *testing.T) {
+	// Berlin switches to summer time on 2026-03-29.
+	sch := &Schedule{
+		ID:       "eu",
+		Timezone: "Europe/Berlin",
+		Rotations: []Rotation{
+			{Users: []string{"a", "b", "c"}, Start: "2026-03-27", Handoff: "09:00", ShiftDays: 1},
+		},
+	}
+	if err := sch.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	utc := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		t    time.Time
+		user string
+	}{
+		{utc(28, 7, 59), "a"},
+		{utc(28, 8, 0), "b"},
+		{utc(29, 6, 59), "b"},
+		{utc(29, 7, 0), "c"},
+		{utc(30, 7, 0), "a"},
+	}
+	for i, tt := range tests {
+		shifts := sch.At(tt.t, nil)
+		if len(shifts) != 1 || shifts[0].User != tt.user {
+			t.Errorf("#%d: at %s got %+v, want %s", i, tt.t, shifts, tt.user)
+		}
+	}
+
+	// The shift handing off into summer time is an hour short.
+	sh := sch.At(utc(28, 12, 0), nil)[0]
+	if sh.Rotation != "rotation-1" || sh.End.Sub(sh.Start) != 23*time.Hour {
+		t.Errorf("unexpected shift %+v", sh)
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	bad := []*Schedule{
+		{Rotations: []Rotation{{Users: []string{"a"}, Start: "2026-03-02"}}},
+		{ID: "x"},
+		{ID: "x", Rotations: []Rotation{{Start: "2026-03-02"}}},
+		{ID: "x", Rotations: []Rotation{{Users: []string{"a"}, Start: "03/02/2026"}}},
+		{ID: "x", Rotations: []Rotation{{Users: []string{"a"}, Start: "2026-03-02", Handoff: "9am"}}},
+		{ID: "x", Rotations: []Rotation{{Users: []string{"a"}, Start: "2026-03-02", ShiftDays: -1}}},
+		{ID: "x", Timezone: "Nowhere/City", Rotations: []Rotation{{Users: []string{"a"}, Start: "2026-03-02"}}},
+		{ID: "x", Rotations: []Rotation{
+			{Name: "p", Users: []string{"a"}, Start: "2026-03-02"},
+			{Name: "p", Users: []string{"b"}, Start: "2026-03-02"},
+		}},
+	}
+	for i, s := range bad {
+		if err := s.Validate(); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("#%d: invalid schedule accepted: %v", i, err)
+		}
+	}
+}
+
+func TestServiceOnCallWithOverrides(t *testing.T) {
+	svc := NewService(newMemRepo())
+	ctx := context.Background()
+
+	sch := &Schedule{
+		ID: "ops",
+		Rotations: []Rotation{
+			{Name: "primary", Users: []string{"alice", "bob"}, Start: "2026-03-02", Handoff: "09:00"},
+			{Name: "secondary", Users: []string{"carol"}, Start: "2026-03-02", Handoff: "09:00"},
+		},
+	}
+	if err := svc.Save(ctx, sch); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	base := time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC)
+	all := &Override{User: "dave", StartsAt: base, EndsAt: base.Add(2 * time.Hour)}
+	if err := svc.AddOverride(ctx, "ops", all); err != nil {
+		t.Fatalf("AddOverride: %v", err)
+	}
+	// A later override wins where both apply.
+	primary := &Override{Rotation: "primary", User: "erin", StartsAt: base.Add(time.Hour), EndsAt: base.Add(3 * time.Hour)}
+	if err := svc.AddOverride(ctx, "ops", primary); err != nil {
+		t.Fatalf("AddOverride: %v", err)
+	}
+	// Creation times may be equal on a coarse clock.
+	primary.CreatedAt = all.CreatedAt.Add(time.Second)
+
+	tests := []struct {
+		t     time.Time
+		users []string
+	}{
+		{base.Add(-time.Minute), []string{"alice", "carol"}},
+		{base, []string{"dave"}},
+		{base.Add(90 * time.Minute), []string{"erin", "dave"}},
+		{base.Add(150 * time.Minute), []string{"erin", "carol"}},
+		{base.Add(3 * time.Hour), []string{"alice", "carol"}},
+	}
+	for i, tt := range tests {
+		got, err := svc.Users(ctx, "ops", tt.t)
+		if err != nil {
+			t.Fatalf("Users: %v", err)
+		}
+		if !equal(got, tt.users) {
+			t.Errorf("#%d: Users = %v, want %v", i, got, tt.users)
+		}
+	}
+
+	res, err := svc.OnCall(ctx, "ops", base)
+	if err != nil {
+		t.Fatalf("OnCall: %v", err)
+	}
+	if len(res.Shifts) != 2 || res.Shifts[0].Override != all.ID || !res.Shifts[0].End.Equal(all.EndsAt) {
+		t.Errorf("unexpected shifts %+v", res.Shifts)
+	}
+
+	if err := svc.AddOverride(ctx, "ops", &Override{Rotation: "tertiary", User: "x", StartsAt: base, EndsAt: base.Add(time.Hour)}); err == nil {
+		t.Errorf("override of unknown rotation accepted")
+	}
+	if err := svc.AddOverride(ctx, "nope", &Override{User: "x", StartsAt: base, EndsAt: base.Add(time.Hour)}); !errors.Is(err, ErrUnknownSchedule) {
+		t.Errorf("AddOverride(unknown schedule) = %v", err)
+	}
+	if _, err := svc.OnCall(ctx, "nope", base); !errors.Is(err, ErrUnknownSchedule) {
+		t.Errorf("OnCall(unknown schedule) = %v", err)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type memRepo struct {
+	schedules map[string]*Schedule
+	overrides map[string]map[string]*Override
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{
+		schedules: make(map[string]*Schedule),
+		overrides: make(map[string]map[string]*Override),
+	}
+}
+
+func (r *memRepo) Get(ctx context.Context, id string) (*Schedule, error) {
+	return r.schedules[id], nil
+}
+
+func (r *memRepo) List(ctx context.Context) ([]*Schedule, error) {
+	res := make([]*Schedule, 0, len(r.schedules))
+	for _, s := range r.schedules {
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func (r *memRepo) Save(ctx context.Context, s *Schedule) error {
+	r.schedules[s.ID] = s
+	return nil
+}
+
+func (r *memRepo) Delete(ctx context.Context, id string) error {
+	delete(r.schedules, id)
+	delete(r.overrides, id)
+	return nil
+}
+
+func (r *memRepo) Overrides(ctx context.Context, scheduleID string) ([]*Override, error) {
+	res := make([]*Override, 0, len(r.overrides[scheduleID]))
+	for _, o := range r.overrides[scheduleID] {
+		res = append(res, o)
+	}
+	return res, nil
+}
+
+func (r *memRepo) SaveOverride(ctx context.Context, o *Override) error {
+	if r.overrides[o.ScheduleID] == nil {
+		r.overrides[o.ScheduleID] = make(map[string]*Override)
+	}
+	r.overrides[o.ScheduleID][o.ID] = o
+	return nil
+}
+
+func (r *memRepo) DeleteOverride(ctx context.Context, scheduleID, id string) error {
+	delete(r.overrides[scheduleID], id)
+	return nil
+}
@@ -0,0 +1,137 @@
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	schedulesKey = "oncall:schedules"
+	overridesKey = "oncall:overrides:" // + schedule ID
+)
+
+type Repository interface {
+	Get(ctx context.Context, id string) (*Schedule, error)
+	List(ctx context.Context) ([]*Schedule, error)
+	Save(ctx context.Context, s *Schedule) error
+	Delete(ctx context.Context, id string) error
+
+	Overrides(ctx context.Context, scheduleID string) ([]*Override, error)
+	SaveOverride(ctx context.Context, o *Override) error
+	DeleteOverride(ctx context.Context, scheduleID, id string) error
+}
+
+type RedisRepository struct {
+	client *redis.Client
+}
+
+func NewRedisRepository(client *redis.Client) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+	}
+}
+
+func (r *RedisRepository) Get(ctx context.Context, id string) (*Schedule, error) {
+	v, err := r.client.HGet(ctx, schedulesKey, id).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeSchedule(v)
+}
+
+func (r *RedisRepository) List(ctx context.Context) ([]*Schedule, error) {
+	values, err := r.client.HGetAll(ctx, schedulesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Schedule, 0, len(values))
+	for id, v := range values {
+		s, err := decodeSchedule(v)
+		if err != nil {
+			log.Printf("[WARN] oncall: skip schedule %s: %v", id, err)
+			continue
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func decodeSchedule(v string) (*Schedule, error) {
+	var s Schedule
+	if err := json.Unmarshal([]byte(v), &s); err != nil {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *RedisRepository) Save(ctx context.Context, s *Schedule) error {
+	if s == nil || s.ID == "" {
+		return fmt.Errorf("oncall: invalid schedule")
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, schedulesKey, s.ID, b).Err()
+}
+
+// Delete removes a schedule and its overrides.
+func (r *RedisRepository) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return fmt.Errorf("oncall: empty schedule id")
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.HDel(ctx, schedulesKey, id)
+	pipe.Del(ctx, overridesKey+id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisRepository) Overrides(ctx context.Context, scheduleID string) ([]*Override, error) {
+	values, err := r.client.HGetAll(ctx, overridesKey+scheduleID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Override, 0, len(values))
+	for _, v := range values {
+		var o Override
+		if err := json.Unmarshal([]byte(v), &o); err != nil {
+			return nil, err
+		}
+		res = append(res, &o)
+	}
+	return res, nil
+}
+
+func (r *RedisRepository) SaveOverride(ctx context.Context, o *Override) error {
+	if o == nil || o.ID == "" || o.ScheduleID == "" {
+		return fmt.Errorf("oncall: invalid override")
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, overridesKey+o.ScheduleID, o.ID, b).Err()
+}
+
+func (r *RedisRepository) DeleteOverride(ctx context.Context, scheduleID, id string) error {
+	if scheduleID == "" || id == "" {
+		return fmt.Errorf("oncall: empty override id")
+	}
+	return r.client.HDel(ctx, overridesKey+scheduleID, id).Err()
+}
@@ -0,0 +1,50 @@
+package oncall
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Rin0913/monitor/internal/redisclient"
+)
+
+func TestRedisRepositorySkipsInvalidSchedules(t *testing.T) {
+	if os.Getenv("REDIS_ADDR") == "" && os.Getenv("REDIS_URL") == "" {
+		t.Skip("redis not configured")
+	}
+
+	client := redisclient.NewTestClientFromEnv()
+	defer client.Close()
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis not reachable: %v", err)
+	}
+	repo := NewRedisRepository(client)
+
+	good := &Schedule{ID: "repo-good", Rotations: []Rotation{{Users: []string{"alice"}, Start: "2026-03-02"}}}
+	if err := repo.Save(ctx, good); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	defer repo.Delete(ctx, good.ID)
+
+	// e.g. stored by a host that knows a timezone this one does not
+	bad := `{"id":"repo-bad","timezone":"Mars/Olympus","rotations":[{"users":["bob"],"start":"2026-03-02"}]}`
+	client.HSet(ctx, schedulesKey, "repo-bad", bad)
+	client.HSet(ctx, schedulesKey, "repo-broken", "{")
+	defer client.HDel(ctx, schedulesKey, "repo-bad", "repo-broken")
+
+	schedules, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	found := false
+	for _, s := range schedules {
+		if s.ID == "repo-bad" || s.ID == "repo-broken" {
+			t.Fatalf("invalid schedule listed: %+v", s)
+		}
+		found = found || s.ID == good.ID
+	}
+	if !found {
+		t.Fatalf("valid schedule missing: %+v", schedules)
+	}
+}
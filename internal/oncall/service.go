@@ -0,0 +1,159 @@
+package oncall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownSchedule = errors.New("oncall: unknown schedule")
+	ErrInvalidSchedule = errors.New("oncall: invalid schedule")
+	ErrInvalidOverride = errors.New("oncall: invalid override")
+)
+
+// OnCall answers who is on call for a schedule at Time.
+type OnCall struct {
+	ScheduleID string    `json:"schedule_id"`
+	Time       time.Time `json:"time"`
+	Shifts     []Shift   `json:"shifts"`
+	Users      []string  `json:"users"`
+}
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+// Save validates and stores s, replacing the schedule with the same ID.
+// Overrides of a replaced schedule are kept.
+func (s *Service) Save(ctx context.Context, sch *Schedule) error {
+	if err := sch.Validate(); err != nil {
+		return err
+	}
+
+	old, err := s.repo.Get(ctx, sch.ID)
+	if err != nil {
+		return err
+	}
+	sch.CreatedAt = time.Now()
+	if old != nil {
+		sch.CreatedAt = old.CreatedAt
+	}
+	return s.repo.Save(ctx, sch)
+}
+
+func (s *Service) Get(ctx context.Context, id string) (*Schedule, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// List returns the schedules ordered by ID.
+func (s *Service) List(ctx context.Context) ([]*Schedule, error) {
+	res, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// AddOverride validates and stores a new override of the schedule.
+func (s *Service) AddOverride(ctx context.Context, scheduleID string, o *Override) error {
+	sch, err := s.schedule(ctx, scheduleID)
+	if err != nil {
+		return err
+	}
+	if err := o.Validate(sch); err != nil {
+		return err
+	}
+	o.ID = uuid.NewString()
+	o.ScheduleID = scheduleID
+	o.CreatedAt = time.Now()
+	return s.repo.SaveOverride(ctx, o)
+}
+
+// Overrides returns the overrides of the schedule ordered by start.
+func (s *Service) Overrides(ctx context.Context, scheduleID string) ([]*Override, error) {
+	res, err := s.repo.Overrides(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].StartsAt.Before(res[j].StartsAt)
+	})
+	return res, nil
+}
+
+func (s *Service) DeleteOverride(ctx context.Context, scheduleID, id string) error {
+	return s.repo.DeleteOverride(ctx, scheduleID, id)
+}
+
+// OnCall returns who is on call for the schedule at t.
+func (s *Service) OnCall(ctx context.Context, scheduleID string, t time.Time) (*OnCall, error) {
+	sch, err := s.schedule(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := s.repo.Overrides(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &OnCall{
+		ScheduleID: scheduleID,
+		Time:       t,
+		Shifts:     sch.At(t, overrides),
+		Users:      []string{},
+	}
+	for _, sh := range res.Shifts {
+		if !contains(res.Users, sh.User) {
+			res.Users = append(res.Users, sh.User)
+		}
+	}
+	return res, nil
+}
+
+// Users returns the users on call for the schedule at t, so notifiers can
+// reach them.
+func (s *Service) Users(ctx context.Context, scheduleID string, t time.Time) ([]string, error) {
+	res, err := s.OnCall(ctx, scheduleID, t)
+	if err != nil {
+		return nil, err
+	}
+	return res.Users, nil
+}
+
+func (s *Service) schedule(ctx context.Context, id string) (*Schedule, error) {
+	sch, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sch == nil {
+		return nil, fmt.Errorf("%w %s", ErrUnknownSchedule, id)
+	}
+	return sch, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -7,7 +7,21 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// testDB is the database tests use unless REDIS_TEST_DB says otherwise.
+const testDB = 15
+
 func NewClientFromEnv() *redis.Client {
+	return newClient(envInt("REDIS_DB", 0))
+}
+
+// NewTestClientFromEnv connects to the same server as NewClientFromEnv but
+// selects REDIS_TEST_DB (15 by default), so tests running next to a monitor
+// sharing that Redis never see its keys.
+func NewTestClientFromEnv() *redis.Client {
+	return newClient(envInt("REDIS_TEST_DB", testDB))
+}
+
+func newClient(db int) *redis.Client {
 	addr := os.Getenv("REDIS_ADDR")
 	if addr == "" {
 		addr = "redis:6379"
@@ -15,17 +29,18 @@ func NewClientFromEnv() *redis.Client {
 
 	password := os.Getenv("REDIS_PASSWORD")
 
-	dbStr := os.Getenv("REDIS_DB")
-	db := 0
-	if dbStr != "" {
-		if v, err := strconv.Atoi(dbStr); err == nil {
-			db = v
-		}
-	}
-
 	return redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: password,
 		DB:       db,
 	})
 }
+
+func envInt(name string, def int) int {
+	if s := os.Getenv(name); s != "" {
+		if v, err := strconv.Atoi(s); err == nil {
+			return v
+		}
+	}
+	return def
+}
@@ -0,0 +1,167 @@
+package routing
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"github.com/Rin0913/monitor/internal/notify"
+	"go.yaml.in/yaml/v4"
+)
+
+// Config is the routing section of notifiers.yaml. Default holds the steps
+// of notifications no rule matches; without them those go to every
+// notifier.
+type Config struct {
+	Rules   []Rule `yaml:"rules"`
+	Default []Step `yaml:"default"`
+}
+
+// Engine evaluates routing rules. It implements alert.Router.
+type Engine struct {
+	rules []Rule
+	def   []Step
+}
+
+// Result explains how a notification is routed.
+type Result struct {
+	Rules   []string `json:"rules"`
+	Default bool     `json:"default"`
+	Steps   []Step   `json:"steps"`
+}
+
+func NewEngine(cfg Config) (*Engine, error) {
+	e := &Engine{
+		rules: make([]Rule, len(cfg.Rules)),
+		def:   cfg.Default,
+	}
+	copy(e.rules, cfg.Rules)
+
+	for i := range e.rules {
+		r := &e.rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if err := r.Match.compile(); err != nil {
+			return nil, fmt.Errorf("routing: %s: %w", r.Name, err)
+		}
+		if err := validateSteps(r.Steps); err != nil {
+			return nil, fmt.Errorf("routing: %s: %w", r.Name, err)
+		}
+	}
+	if err := validateSteps(e.def); err != nil {
+		return nil, fmt.Errorf("routing: default: %w", err)
+	}
+	if err := e.SetTemplates(notify.NewTemplates()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetTemplates hands the templates of the rules that have their own to t.
+func (e *Engine) SetTemplates(t *notify.Templates) error {
+	for _, r := range e.rules {
+		if len(r.Templates) == 0 {
+			continue
+		}
+		if err := t.SetRoute(r.Name, r.Templates); err != nil {
+			return fmt.Errorf("routing: %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateSteps(steps []Step) error {
+	for _, s := range steps {
+		if s.AfterMin < 0 {
+			return fmt.Errorf("after_min must be >= 0")
+		}
+		if len(s.Notify) == 0 {
+			return fmt.Errorf("step after %d min notifies nobody", s.AfterMin)
+		}
+	}
+	return nil
+}
+
+// LoadConfig builds an engine from the routing section of the file at
+// path. It returns nil if the file has no routing section.
+func LoadConfig(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Routing *Config `yaml:"routing"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Routing == nil {
+		return nil, nil
+	}
+	return NewEngine(*file.Routing)
+}
+
+// Evaluate routes n without sending anything.
+func (e *Engine) Evaluate(n *alert.Notification) *Result {
+	res := &Result{Rules: []string{}, Steps: []Step{}}
+	for i := range e.rules {
+		r := &e.rules[i]
+		if !r.Match.Matches(n) {
+			continue
+		}
+		res.Rules = append(res.Rules, r.Name)
+		for _, s := range r.Steps {
+			s.Rule = r.Name
+			res.Steps = append(res.Steps, s)
+		}
+		if !r.Continue {
+			break
+		}
+	}
+	if len(res.Rules) == 0 && len(e.def) > 0 {
+		res.Default = true
+		res.Steps = append(res.Steps, e.def...)
+	}
+
+	sort.SliceStable(res.Steps, func(i, j int) bool {
+		return res.Steps[i].AfterMin < res.Steps[j].AfterMin
+	})
+	return res
+}
+
+func (e *Engine) Route(n *alert.Notification) []alert.Escalation {
+	var res []alert.Escalation
+	for _, s := range e.Evaluate(n).Steps {
+		res = append(res, alert.Escalation{
+			After:     time.Duration(s.AfterMin) * time.Minute,
+			Notifiers: s.Notify,
+			OnCall:    s.OnCall,
+			Rule:      s.Rule,
+		})
+	}
+	return res
+}
+
+// Notifiers returns the names of all notifiers the rules refer to.
+func (e *Engine) Notifiers() []string {
+	var res []string
+	add := func(steps []Step) {
+		for _, s := range steps {
+			for _, name := range s.Notify {
+				if !contains(res, name) {
+					res = append(res, name)
+				}
+			}
+		}
+	}
+	for _, r := range e.rules {
+		add(r.Steps)
+	}
+	add(e.def)
+	sort.Strings(res)
+	return res
+}
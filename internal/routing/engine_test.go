@@ -0,0 +1,189 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+	"github.com/Rin0913/monitor/internal/notify"
+)
+
+// Monday 2026-03-02 10:00 in Taipei.
+var officeHours = time.Date(2026, 3, 2, 2, 0, 0, 0, time.UTC)
+
+func notification(d *device.Device, typ, status string, at time.Time) *alert.Notification {
+	return &alert.Notification{
+		Type:   typ,
+		Device: d,
+		Health: &health.HealthStatus{DeviceID: d.ID, Status: status},
+		Time:   at,
+	}
+}
+
+const testConfig = `
+notifiers:
+  team_a: {type: webhook, url: "http://a"}
+routing:
+  rules:
+    - name: db-office-hours
+      match:
+        labels: {team: db}
+        active_window: {start: "09:00", end: "18:00", days: [MON-FRI]}
+        timezone: Asia/Taipei
+      steps:
+        - notify: [db_chat]
+        - after_min: 15
+          notify: [db_mail]
+    - name: db
+      match:
+        labels: {team: db}
+      steps:
+        - notify: [oncall]
+          oncall: [db-primary]
+      templates:
+        PROBLEM:
+          subject: "db {{.Device.ID}}"
+    - name: ping-down
+      match:
+        check_methods: [cmd_ping]
+        statuses: [DOWN]
+      continue: true
+      steps:
+        - after_min: 30
+          notify: [oncall]
+    - name: network
+      match:
+        labels: {team: net}
+        types: [PROBLEM]
+      steps:
+        - notify: [net_chat]
+  default:
+    - notify: [ops]
+`
+
+func loadTestEngine(t *testing.T) *Engine {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "notifiers.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return e
+}
+
+func TestEvaluate(t *testing.T) {
+	e := loadTestEngine(t)
+
+	db := &device.Device{ID: "db", CheckMethod: "tcp_check", Labels: map[string]string{"team": "db"}}
+	router := &device.Device{ID: "router", CheckMethod: "cmd_ping", Labels: map[string]string{"team": "net"}}
+	web := &device.Device{ID: "web", CheckMethod: "tcp_check"}
+
+	tests := []struct {
+		name    string
+		n       *alert.Notification
+		rules   []string
+		def     bool
+		notify  [][]string
+		afterMn []int
+	}{
+		{"first match wins", notification(db, alert.TypeProblem, "DOWN", officeHours),
+			[]string{"db-office-hours"}, false, [][]string{{"db_chat"}, {"db_mail"}}, []int{0, 15}},
+		{"outside the time window", notification(db, alert.TypeProblem, "DOWN", officeHours.Add(10*time.Hour)),
+			[]string{"db"}, false, [][]string{{"oncall"}}, []int{0}},
+		{"continue collects later rules", notification(router, alert.TypeProblem, "DOWN", officeHours),
+			[]string{"ping-down", "network"}, false, [][]string{{"net_chat"}, {"oncall"}}, []int{0, 30}},
+		{"status and type matchers", notification(router, alert.TypeRecovery, "UP", officeHours),
+			[]string{}, true, [][]string{{"ops"}}, []int{0}},
+		{"default", notification(web, alert.TypeProblem, "DOWN", officeHours),
+			[]string{}, true, [][]string{{"ops"}}, []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := e.Evaluate(tt.n)
+			if !reflect.DeepEqual(res.Rules, tt.rules) || res.Default != tt.def {
+				t.Fatalf("rules = %v default = %v, want %v %v", res.Rules, res.Default, tt.rules, tt.def)
+			}
+			var notify [][]string
+			var after []int
+			for _, s := range res.Steps {
+				notify = append(notify, s.Notify)
+				after = append(after, s.AfterMin)
+			}
+			if !reflect.DeepEqual(notify, tt.notify) || !reflect.DeepEqual(after, tt.afterMn) {
+				t.Fatalf("steps = %+v", res.Steps)
+			}
+		})
+	}
+
+	route := e.Route(notification(db, alert.TypeProblem, "DOWN", officeHours))
+	if len(route) != 2 || route[1].After != 15*time.Minute || route[1].Notifiers[0] != "db_mail" {
+		t.Fatalf("unexpected route: %+v", route)
+	}
+
+	route = e.Route(notification(db, alert.TypeProblem, "DOWN", officeHours.Add(10*time.Hour)))
+	if len(route) != 1 || !reflect.DeepEqual(route[0].OnCall, []string{"db-primary"}) || route[0].Rule != "db" {
+		t.Fatalf("unexpected on-call route: %+v", route)
+	}
+
+	if got, want := e.Notifiers(), []string{"db_chat", "db_mail", "net_chat", "oncall", "ops"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Notifiers = %v, want %v", got, want)
+	}
+}
+
+func TestNewEngineRejectsInvalidRules(t *testing.T) {
+	bad := []Config{
+		{Rules: []Rule{{Match: Match{Timezone: "Nowhere/City"}, Steps: []Step{{Notify: []string{"a"}}}}}},
+		{Rules: []Rule{{Match: Match{ActiveWindow: &device.TimeWindow{Start: "9", End: "18:00"}}, Steps: []Step{{Notify: []string{"a"}}}}}},
+		{Rules: []Rule{{Steps: []Step{{AfterMin: -1, Notify: []string{"a"}}}}}},
+		{Default: []Step{{AfterMin: 5}}},
+	}
+	for i, cfg := range bad {
+		if _, err := NewEngine(cfg); err == nil {
+			t.Errorf("#%d: invalid config accepted", i)
+		}
+	}
+}
+
+func TestRuleTemplates(t *testing.T) {
+	e := loadTestEngine(t)
+	tmpl := notify.NewTemplates()
+	if err := e.SetTemplates(tmpl); err != nil {
+		t.Fatalf("SetTemplates: %v", err)
+	}
+
+	n := notification(&device.Device{ID: "pg"}, alert.TypeProblem, "DOWN", officeHours)
+	n.Route = "db"
+	if msg, err := tmpl.Render(n, "ops"); err != nil || msg.Subject != "db pg" {
+		t.Fatalf("route template not used: %+v, %v", msg, err)
+	}
+
+	// Unnamed rules are named by their position.
+	_, err := NewEngine(Config{Rules: []Rule{{
+		Steps:     []Step{{Notify: []string{"ops"}}},
+		Templates: map[string]notify.TemplateConfig{alert.TypeProblem: {Subject: "{{.Nope"}},
+	}}})
+	if err == nil || !strings.Contains(err.Error(), "rule-1") {
+		t.Fatalf("invalid template accepted: %v", err)
+	}
+}
+
+func TestLoadConfigWithoutRouting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifiers.yaml")
+	if err := os.WriteFile(path, []byte("notifiers: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := LoadConfig(path); err != nil || e != nil {
+		t.Fatalf("LoadConfig = %v, %v", e, err)
+	}
+}
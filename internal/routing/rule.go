@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/alert"
+	"github.com/Rin0913/monitor/internal/cron"
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/notify"
+)
+
+// Rule routes the notifications it matches through its escalation Steps.
+// Rules are evaluated in order and the first match wins, unless it sets
+// Continue to let later rules add their steps too. Templates override the
+// notify templates of the notifications the rule routes, by event.
+type Rule struct {
+	Name      string                           `yaml:"name" json:"name"`
+	Match     Match                            `yaml:"match" json:"match"`
+	Steps     []Step                           `yaml:"steps" json:"steps"`
+	Continue  bool                             `yaml:"continue" json:"continue,omitempty"`
+	Templates map[string]notify.TemplateConfig `yaml:"templates" json:"templates,omitempty"`
+}
+
+// Match selects notifications. Every matcher set must match; an empty
+// Match matches everything. ActiveWindow restricts the rule to a time of
+// day, evaluated in Timezone (UTC if empty).
+type Match struct {
+	DeviceIDs    []string           `yaml:"device_ids" json:"device_ids,omitempty"`
+	Labels       map[string]string  `yaml:"labels" json:"labels,omitempty"`
+	CheckMethods []string           `yaml:"check_methods" json:"check_methods,omitempty"`
+	Statuses     []string           `yaml:"statuses" json:"statuses,omitempty"`
+	Types        []string           `yaml:"types" json:"types,omitempty"`
+	ActiveWindow *device.TimeWindow `yaml:"active_window" json:"active_window,omitempty"`
+	Timezone     string             `yaml:"timezone" json:"timezone,omitempty"`
+
+	window *cron.Window
+	loc    *time.Location
+}
+
+// Step notifies Notify once a problem has been left unacknowledged for
+// AfterMin minutes. With OnCall, the notifiers also address whoever is on
+// call for those schedules at the time. Rule is filled in by Evaluate.
+type Step struct {
+	AfterMin int      `yaml:"after_min" json:"after_min"`
+	Notify   []string `yaml:"notify" json:"notify"`
+	OnCall   []string `yaml:"oncall" json:"oncall,omitempty"`
+	Rule     string   `yaml:"-" json:"rule,omitempty"`
+}
+
+func (m *Match) compile() error {
+	m.loc = time.UTC
+	if m.Timezone != "" {
+		loc, err := time.LoadLocation(m.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q", m.Timezone)
+		}
+		m.loc = loc
+	}
+	if w := m.ActiveWindow; w != nil {
+		window, err := cron.ParseWindow(w.Start, w.End, w.Days)
+		if err != nil {
+			return err
+		}
+		m.window = window
+	}
+	return nil
+}
+
+// Matches reports whether n matches at n.Time.
+func (m *Match) Matches(n *alert.Notification) bool {
+	d := n.Device
+	if len(m.DeviceIDs) > 0 && !contains(m.DeviceIDs, d.ID) {
+		return false
+	}
+	for k, v := range m.Labels {
+		if d.Labels[k] != v {
+			return false
+		}
+	}
+	if len(m.CheckMethods) > 0 && !contains(m.CheckMethods, d.CheckMethod) {
+		return false
+	}
+	if len(m.Statuses) > 0 && (n.Health == nil || !contains(m.Statuses, n.Health.Status)) {
+		return false
+	}
+	if len(m.Types) > 0 && !contains(m.Types, n.Type) {
+		return false
+	}
+	if m.window != nil && !m.window.Contains(n.Time.In(m.loc)) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+)
+
+// relaxAfter is the number of consecutive UP results after which the
+// interval of a device with MaxIntervalSec starts to grow.
+const relaxAfter = 3
+
+// backoff holds the adaptive interval settings of a device.
+type backoff struct {
+	retry    time.Duration
+	maxRetry time.Duration
+	max      time.Duration
+}
+
+func newBackoff(d *device.Device) backoff {
+	return backoff{
+		retry:    time.Duration(d.RetryIntervalSec) * time.Second,
+		maxRetry: time.Duration(d.MaxRetryIntervalSec) * time.Second,
+		max:      time.Duration(d.MaxIntervalSec) * time.Second,
+	}
+}
+
+func (b backoff) enabled() bool {
+	return b.retry > 0 || b.max > 0
+}
+
+// effectiveInterval is the interval to the next run given the latest
+// results: the retry interval while failing, doubling on each further
+// failure up to maxRetry, and the regular interval while UP, doubling after
+// relaxAfter consecutive UP results up to max.
+func (j *CheckJob) effectiveInterval() time.Duration {
+	interval := jobInterval(j.IntervalSec)
+	b := j.backoff
+
+	if j.failures > 0 && b.retry > 0 {
+		return grow(b.retry, j.failures-1, b.maxRetry)
+	}
+	if j.successes > relaxAfter && b.max > interval {
+		return grow(interval, j.successes-relaxAfter, b.max)
+	}
+	return interval
+}
+
+// grow doubles d n times without exceeding limit. Without a limit d is
+// returned unchanged.
+func grow(d time.Duration, n int, limit time.Duration) time.Duration {
+	if limit <= d {
+		return d
+	}
+	for ; n > 0; n-- {
+		d *= 2
+		if d >= limit {
+			return limit
+		}
+	}
+	return d
+}
+
+// Report feeds the result of a check back into the scheduler, from internal
+// workers and remote worker reports alike. Results of RunNow checks go to
+// their callers, and devices with adaptive intervals are rescheduled from
+// the check time using their new effective interval.
+func (s *Scheduler) Report(h *health.HealthStatus) {
+	if h == nil {
+		return
+	}
+
+	ctx := context.Background()
+
+	s.mu.Lock()
+	waiting := s.releaseLocked(h.DeviceID)
+	s.mu.Unlock()
+	if waiting {
+		s.notify()
+	}
+
+	// Results of on-demand checks must not shift the regular cadence. Their
+	// RunNow caller may be waiting on another replica.
+	if h.RequestID != "" {
+		if err := s.queue.publish(ctx, h); err != nil {
+			log.Printf("[WARN] publish result of device %s: %v", h.DeviceID, err)
+		}
+		return
+	}
+
+	rescheduled := false
+	err := s.queue.update(ctx, h.DeviceID, func(job *CheckJob) bool {
+		if h.Status == "UP" {
+			job.successes++
+			job.failures = 0
+		} else {
+			job.failures++
+			job.successes = 0
+		}
+
+		if !job.backoff.enabled() || (job.calendar != nil && job.calendar.cron != nil) {
+			return false
+		}
+
+		checkedAt := h.LastCheck
+		if checkedAt.IsZero() {
+			checkedAt = s.clock.Now()
+		}
+
+		next := checkedAt.Add(job.effectiveInterval())
+		if c := job.calendar; c != nil {
+			next = c.window.NextStart(next.In(c.loc))
+		}
+		job.slot = next
+		job.nextRun = next
+		rescheduled = true
+		return true
+	})
+	if err != nil {
+		log.Printf("[WARN] update schedule of device %s: %v", h.DeviceID, err)
+	}
+	if rescheduled {
+		s.notify()
+	}
+}
+
+// deliver hands a result to the local RunNow caller waiting for it.
+func (s *Scheduler) deliver(h *health.HealthStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.waiters[h.RequestID]; ok && h.RequestID != "" {
+		ch <- h
+		delete(s.waiters, h.RequestID)
+	}
+}
+
+// JobStatus is the scheduling state of a device.
+type JobStatus struct {
+	NextRun              time.Time `json:"next_run"`
+	EffectiveIntervalSec int       `json:"effective_interval_sec"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	// LagMs is how late the last regular run was dispatched.
+	LagMs int64 `json:"lag_ms"`
+}
+
+// Status returns the scheduling state of a device, or nil if the device is
+// not scheduled.
+func (s *Scheduler) Status(deviceID string) *JobStatus {
+	job, err := s.queue.get(context.Background(), deviceID)
+	if err != nil {
+		log.Printf("[WARN] schedule of device %s: %v", deviceID, err)
+		return nil
+	}
+	if job == nil {
+		return nil
+	}
+
+	return &JobStatus{
+		NextRun:              job.nextRun,
+		EffectiveIntervalSec: int(job.effectiveInterval() / time.Second),
+		ConsecutiveFailures:  job.failures,
+		LagMs:                job.lag.Milliseconds(),
+	}
+}
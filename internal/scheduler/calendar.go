@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/cron"
+	"github.com/Rin0913/monitor/internal/device"
+)
+
+// calendar is the compiled cron or active-window schedule of a device.
+type calendar struct {
+	cron   *cron.Schedule
+	window *cron.Window
+	loc    *time.Location
+}
+
+func newCalendar(d *device.Device) *calendar {
+	if d.Cron == "" && d.ActiveWindow == nil {
+		return nil
+	}
+	if err := device.ValidateSchedule(d); err != nil {
+		log.Printf("[WARN] device %s: ignoring schedule: %v", d.ID, err)
+		return nil
+	}
+
+	c := &calendar{loc: time.UTC}
+	if d.Timezone != "" {
+		c.loc, _ = time.LoadLocation(d.Timezone)
+	}
+	if d.Cron != "" {
+		c.cron, _ = cron.Parse(d.Cron)
+	}
+	if w := d.ActiveWindow; w != nil {
+		c.window, _ = cron.ParseWindow(w.Start, w.End, w.Days)
+	}
+	return c
+}
+
+// first returns the first run not before t.
+func (c *calendar) first(t time.Time) time.Time {
+	if c.cron != nil {
+		return c.cron.Next(t.In(c.loc).Add(-time.Nanosecond))
+	}
+	return c.window.NextStart(t.In(c.loc))
+}
+
+// HasCalendar reports whether the job runs on a cron or active-window
+// schedule rather than a plain interval.
+func (j *CheckJob) HasCalendar() bool {
+	return j.calendar != nil
+}
+
+// ResultTTL is how long the result of the job stays stored; see ResultTTL.
+func (j *CheckJob) ResultTTL() time.Duration {
+	return resultTTL(j.IntervalSec, j.HasCalendar())
+}
+
+// ResultTTL is how long the result of a check of d stays stored: three
+// intervals, or until it is replaced for calendar-scheduled devices, however
+// far away their next run is.
+func ResultTTL(d *device.Device) time.Duration {
+	return resultTTL(d.IntervalSec, newCalendar(d) != nil)
+}
+
+func resultTTL(intervalSec int, calendar bool) time.Duration {
+	if calendar {
+		return 0
+	}
+	return time.Duration(intervalSec*3) * time.Second
+}
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	defaultLagThreshold = 10 * time.Second
+	lagWarnEvery        = 30 * time.Second
+	// lagSmoothing is the weight of the latest dispatch in the average lag.
+	lagSmoothing = 0.1
+)
+
+// LagStats describes how late jobs are handed out compared to their
+// scheduled run.
+type LagStats struct {
+	Dispatched int64 `json:"dispatched"`
+	Late       int64 `json:"late"`
+	LastLagMs  int64 `json:"last_lag_ms"`
+	AvgLagMs   int64 `json:"avg_lag_ms"`
+	MaxLagMs   int64 `json:"max_lag_ms"`
+	// Overdue counts the jobs found overdue by more than their interval
+	// at the last CheckOverload.
+	Overdue    int  `json:"overdue"`
+	Overloaded bool `json:"overloaded"`
+}
+
+// lagTracker is guarded by Scheduler.mu.
+type lagTracker struct {
+	threshold time.Duration
+	onChange  func(overloaded bool, st LagStats)
+
+	stats    LagStats
+	avg      float64
+	warnedAt time.Time
+	late     int64
+}
+
+// WithLagThreshold sets how late a job may be handed out before it counts
+// as late. The default is 10 seconds.
+func WithLagThreshold(d time.Duration) Option {
+	return func(s *Scheduler) {
+		if d > 0 {
+			s.lag.threshold = d
+		}
+	}
+}
+
+// WithOverloadHook calls fn whenever CheckOverload finds the scheduler
+// becoming overloaded or recovering.
+func WithOverloadHook(fn func(overloaded bool, st LagStats)) Option {
+	return func(s *Scheduler) {
+		s.lag.onChange = fn
+	}
+}
+
+// recordLagLocked accounts for job being handed out at now. The caller must
+// hold s.mu.
+func (s *Scheduler) recordLagLocked(job *CheckJob, now time.Time) {
+	if job.oneShot {
+		return
+	}
+
+	t := &s.lag
+	lag := now.Sub(job.nextRun)
+	if lag < 0 {
+		lag = 0
+	}
+	ms := lag.Milliseconds()
+
+	t.stats.Dispatched++
+	t.stats.LastLagMs = ms
+	if ms > t.stats.MaxLagMs {
+		t.stats.MaxLagMs = ms
+	}
+	if t.stats.Dispatched == 1 {
+		t.avg = float64(ms)
+	} else {
+		t.avg += lagSmoothing * (float64(ms) - t.avg)
+	}
+	t.stats.AvgLagMs = int64(t.avg)
+
+	if lag <= t.threshold {
+		return
+	}
+	t.stats.Late++
+	t.late++
+	if now.Sub(t.warnedAt) >= lagWarnEvery {
+		log.Printf("[WARN] scheduler: device %s handed out %v late (%d late jobs since last warning)",
+			job.DeviceID, lag.Truncate(time.Millisecond), t.late)
+		t.warnedAt = now
+		t.late = 0
+	}
+}
+
+// Lag returns the dispatch lag statistics of this scheduler.
+func (s *Scheduler) Lag() LagStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lag.stats
+}
+
+// CheckOverload looks for jobs overdue by more than their interval and
+// decides whether the workers keep up, that is whether no job is overdue
+// and the average lag stays under the threshold. It logs and reports
+// changes to the overload hook.
+func (s *Scheduler) CheckOverload(ctx context.Context) (LagStats, error) {
+	overdue, err := s.queue.overdue(ctx, s.clock.Now())
+	if err != nil {
+		return s.Lag(), err
+	}
+
+	s.mu.Lock()
+	t := &s.lag
+	t.stats.Overdue = overdue
+	overloaded := overdue > 0 || time.Duration(t.stats.AvgLagMs)*time.Millisecond > t.threshold
+	changed := overloaded != t.stats.Overloaded
+	t.stats.Overloaded = overloaded
+	st, hook := t.stats, t.onChange
+	s.mu.Unlock()
+
+	if !changed {
+		return st, nil
+	}
+	if overloaded {
+		log.Printf("[WARN] scheduler: overloaded, %d jobs overdue by more than their interval, average lag %dms",
+			st.Overdue, st.AvgLagMs)
+	} else {
+		log.Printf("[INFO] scheduler: workers keep up again, average lag %dms", st.AvgLagMs)
+	}
+	if hook != nil {
+		hook(overloaded, st)
+	}
+	return st, nil
+}
+
+// WatchOverload runs CheckOverload every interval until ctx is done.
+func (s *Scheduler) WatchOverload(ctx context.Context, every time.Duration) {
+	ticker := s.clock.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		if _, err := s.CheckOverload(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[WARN] scheduler: check overload: %v", err)
+		}
+	}
+}
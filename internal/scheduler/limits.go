@@ -0,0 +1,236 @@
+package scheduler
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// limiter caps the checks in flight at once per target host and per check
+// method. A job handed out counts as in flight until its result is reported,
+// or for one interval if it never is. Jobs over a limit wait in the scheduler
+// instead of being dropped. The limiter is guarded by Scheduler.mu.
+//
+// Waiting jobs are held in memory even when the queue is shared in Redis, so
+// a replica that stops loses them: a regular run is skipped, as the queue
+// already holds the next one, and a RunNow check never reports.
+type limiter struct {
+	perHost   int
+	perMethod map[string]int
+
+	hosts   map[string]int
+	methods map[string]int
+	flights map[string][]flight
+	waiting []*CheckJob
+
+	deferredByHost   map[string]int64
+	deferredByMethod map[string]int64
+}
+
+type flight struct {
+	host   string
+	method string
+	until  time.Time
+}
+
+func (s *Scheduler) limits() *limiter {
+	if s.limiter == nil {
+		s.limiter = &limiter{
+			perMethod:        make(map[string]int),
+			hosts:            make(map[string]int),
+			methods:          make(map[string]int),
+			flights:          make(map[string][]flight),
+			deferredByHost:   make(map[string]int64),
+			deferredByMethod: make(map[string]int64),
+		}
+	}
+	return s.limiter
+}
+
+// WithHostLimit allows at most n checks of the same host at once.
+func WithHostLimit(n int) Option {
+	return func(s *Scheduler) {
+		if n > 0 {
+			s.limits().perHost = n
+		}
+	}
+}
+
+// WithMethodLimit allows at most n checks with method at once.
+func WithMethodLimit(method string, n int) Option {
+	return func(s *Scheduler) {
+		if n > 0 {
+			s.limits().perMethod[method] = n
+		}
+	}
+}
+
+// targetHost extracts the host of a device address such as "10.0.0.1:80",
+// "https://example.com/health" or "example.com".
+func targetHost(address string) string {
+	if strings.Contains(address, "://") {
+		if u, err := url.Parse(address); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// admitLocked starts job if the limits allow it and queues it otherwise.
+// The caller must hold s.mu.
+func (s *Scheduler) admitLocked(job *CheckJob, now time.Time) bool {
+	l := s.limiter
+	if l == nil {
+		return true
+	}
+
+	l.expire(now)
+	if l.allows(job) {
+		l.start(job, now)
+		return true
+	}
+
+	host := targetHost(job.Address)
+	if l.perHost > 0 && l.hosts[host] >= l.perHost {
+		l.deferredByHost[host]++
+	}
+	if max, ok := l.perMethod[job.Method]; ok && l.methods[job.Method] >= max {
+		l.deferredByMethod[job.Method]++
+	}
+
+	// A device waits at most once for its regular run; a later run of it
+	// that is also over the limit folds into the waiting one. One-off runs
+	// each have a caller waiting for their own result.
+	for _, w := range l.waiting {
+		if w.DeviceID == job.DeviceID && !w.oneShot && !job.oneShot {
+			return false
+		}
+	}
+	l.waiting = append(l.waiting, job)
+	return false
+}
+
+// nextWaitingLocked returns the first waiting job the limits now allow.
+// The caller must hold s.mu.
+func (s *Scheduler) nextWaitingLocked(now time.Time) *CheckJob {
+	l := s.limiter
+	if l == nil || len(l.waiting) == 0 {
+		return nil
+	}
+
+	l.expire(now)
+	for i, job := range l.waiting {
+		if l.allows(job) {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			l.start(job, now)
+			return job
+		}
+	}
+	return nil
+}
+
+// releaseLocked ends the oldest check of deviceID in flight and reports
+// whether jobs are waiting for capacity. The caller must hold s.mu.
+func (s *Scheduler) releaseLocked(deviceID string) bool {
+	l := s.limiter
+	if l == nil {
+		return false
+	}
+
+	fs := l.flights[deviceID]
+	if len(fs) == 0 {
+		return false
+	}
+	l.finish(fs[0])
+	if len(fs) == 1 {
+		delete(l.flights, deviceID)
+	} else {
+		l.flights[deviceID] = fs[1:]
+	}
+	return len(l.waiting) > 0
+}
+
+func (l *limiter) allows(job *CheckJob) bool {
+	if l.perHost > 0 && l.hosts[targetHost(job.Address)] >= l.perHost {
+		return false
+	}
+	if max, ok := l.perMethod[job.Method]; ok && l.methods[job.Method] >= max {
+		return false
+	}
+	return true
+}
+
+func (l *limiter) start(job *CheckJob, now time.Time) {
+	f := flight{
+		host:   targetHost(job.Address),
+		method: job.Method,
+		until:  now.Add(jobInterval(job.IntervalSec)),
+	}
+	l.hosts[f.host]++
+	l.methods[f.method]++
+	l.flights[job.DeviceID] = append(l.flights[job.DeviceID], f)
+}
+
+func (l *limiter) finish(f flight) {
+	if l.hosts[f.host]--; l.hosts[f.host] <= 0 {
+		delete(l.hosts, f.host)
+	}
+	if l.methods[f.method]--; l.methods[f.method] <= 0 {
+		delete(l.methods, f.method)
+	}
+}
+
+// expire ends checks whose result never came back.
+func (l *limiter) expire(now time.Time) {
+	for id, fs := range l.flights {
+		kept := fs[:0]
+		for _, f := range fs {
+			if now.Before(f.until) {
+				kept = append(kept, f)
+			} else {
+				l.finish(f)
+			}
+		}
+		if len(kept) == 0 {
+			delete(l.flights, id)
+		} else {
+			l.flights[id] = kept
+		}
+	}
+}
+
+// DeferredStats counts the jobs delayed by the concurrency limits.
+type DeferredStats struct {
+	Waiting  int              `json:"waiting"`
+	ByHost   map[string]int64 `json:"by_host"`
+	ByMethod map[string]int64 `json:"by_method"`
+}
+
+// Deferred returns how often jobs were delayed by the concurrency limits
+// and how many wait now, or nil if no limit is configured.
+func (s *Scheduler) Deferred() *DeferredStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.limiter
+	if l == nil {
+		return nil
+	}
+
+	st := &DeferredStats{
+		Waiting:  len(l.waiting),
+		ByHost:   make(map[string]int64, len(l.deferredByHost)),
+		ByMethod: make(map[string]int64, len(l.deferredByMethod)),
+	}
+	for k, v := range l.deferredByHost {
+		st.ByHost[k] = v
+	}
+	for k, v := range l.deferredByMethod {
+		st.ByMethod[k] = v
+	}
+	return st
+}
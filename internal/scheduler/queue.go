@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/health"
+)
+
+// queue stores the scheduled jobs. The in-memory queue serves a single
+// server; the Redis queue is shared by several server replicas.
+type queue interface {
+	// push schedules job at job.nextRun. Unless replace is set, a job that
+	// is already scheduled for the device is kept.
+	push(ctx context.Context, job *CheckJob, replace bool) error
+	// pushOnce queues a one-off run of job ahead of the scheduled jobs.
+	pushOnce(ctx context.Context, job *CheckJob) error
+	// claim takes the first job due at now. A regular job is handed to
+	// reschedule, which moves a copy of it to its next run and returns
+	// false if it should not run again. When nothing is due, claim returns
+	// the time the first job is due, or the zero time if there is none.
+	claim(ctx context.Context, now time.Time, reschedule func(*CheckJob) bool) (*CheckJob, time.Time, error)
+	// update applies fn to the job scheduled for deviceID. fn returns true
+	// if it changed job.nextRun.
+	update(ctx context.Context, deviceID string, fn func(*CheckJob) bool) error
+	// overdue counts the regular jobs overdue at now by more than their
+	// interval.
+	overdue(ctx context.Context, now time.Time) (int, error)
+	// get returns a copy of the job scheduled for deviceID, or nil.
+	get(ctx context.Context, deviceID string) (*CheckJob, error)
+	// publish hands a check result to the subscribers of every replica.
+	publish(ctx context.Context, h *health.HealthStatus) error
+	subscribe(fn func(*health.HealthStatus))
+	close() error
+}
+
+type memoryQueue struct {
+	mu       sync.Mutex
+	jobs     jobHeap
+	byDevice map[string]*CheckJob
+	onResult func(*health.HealthStatus)
+}
+
+func newMemoryQueue() *memoryQueue {
+	q := &memoryQueue{
+		byDevice: make(map[string]*CheckJob),
+	}
+	heap.Init(&q.jobs)
+	return q
+}
+
+func (q *memoryQueue) push(ctx context.Context, job *CheckJob, replace bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if old, ok := q.byDevice[job.DeviceID]; ok {
+		if !replace {
+			return nil
+		}
+		if old.index >= 0 {
+			heap.Remove(&q.jobs, old.index)
+		}
+	}
+
+	heap.Push(&q.jobs, job)
+	q.byDevice[job.DeviceID] = job
+	return nil
+}
+
+func (q *memoryQueue) pushOnce(ctx context.Context, job *CheckJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job.oneShot = true
+	heap.Push(&q.jobs, job)
+	return nil
+}
+
+func (q *memoryQueue) claim(ctx context.Context, now time.Time, reschedule func(*CheckJob) bool) (*CheckJob, time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.jobs) == 0 {
+		return nil, time.Time{}, nil
+	}
+	if top := q.jobs[0]; top.nextRun.After(now) {
+		return nil, top.nextRun, nil
+	}
+
+	job := heap.Pop(&q.jobs).(*CheckJob)
+
+	if job.oneShot {
+		return job, time.Time{}, nil
+	}
+
+	nextJob := *job
+	if reschedule(&nextJob) {
+		heap.Push(&q.jobs, &nextJob)
+		q.byDevice[job.DeviceID] = &nextJob
+	} else {
+		delete(q.byDevice, job.DeviceID)
+	}
+
+	return job, time.Time{}, nil
+}
+
+func (q *memoryQueue) update(ctx context.Context, deviceID string, fn func(*CheckJob) bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.byDevice[deviceID]
+	if !ok || job.index < 0 {
+		return nil
+	}
+	if fn(job) {
+		heap.Fix(&q.jobs, job.index)
+	}
+	return nil
+}
+
+func (q *memoryQueue) overdue(ctx context.Context, now time.Time) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, job := range q.jobs {
+		if !job.oneShot && now.Sub(job.nextRun) > jobInterval(job.IntervalSec) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *memoryQueue) get(ctx context.Context, deviceID string) (*CheckJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.byDevice[deviceID]
+	if !ok {
+		return nil, nil
+	}
+	cp := *job
+	return &cp, nil
+}
+
+func (q *memoryQueue) publish(ctx context.Context, h *health.HealthStatus) error {
+	q.mu.Lock()
+	fn := q.onResult
+	q.mu.Unlock()
+
+	if fn != nil {
+		fn(h)
+	}
+	return nil
+}
+
+func (q *memoryQueue) subscribe(fn func(*health.HealthStatus)) {
+	q.mu.Lock()
+	q.onResult = fn
+	q.mu.Unlock()
+}
+
+func (q *memoryQueue) close() error {
+	return nil
+}
@@ -0,0 +1,342 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	queueKey          = "scheduler:queue"
+	onceKey           = "scheduler:once"
+	jobKeyPrefix      = "scheduler:job:"
+	resultsChannel    = "scheduler:results"
+	claimLease        = 30 * time.Second
+	redisPollInterval = time.Second
+)
+
+// The queue is a sorted set of device IDs scored by the next run in unix
+// milliseconds, next to a hash per device holding the job state. A claimed
+// job is leased by moving its score claimLease into the future until the
+// claiming replica stores its next run, so the job of a replica that dies in
+// between is claimed again by another one.
+
+var pushScript = redis.NewScript(`
+if ARGV[2] == '0' and redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'device', ARGV[4], 'slot', ARGV[5], 'next', ARGV[6], 'failures', 0, 'successes', 0)
+redis.call('HINCRBY', KEYS[2], 'ver', 1)
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+var claimScript = redis.NewScript(`
+local once = redis.call('RPOP', KEYS[2])
+if once then
+	return {'once', once}
+end
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1)
+if #due == 0 then
+	local top = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	if #top == 0 then
+		return {}
+	end
+	return {'wait', top[2]}
+end
+redis.call('ZADD', KEYS[1], ARGV[2], due[1])
+local job = redis.call('HMGET', ARGV[3] .. due[1], 'ver', 'device', 'slot', 'next', 'failures', 'successes', 'lag')
+return {'job', due[1], unpack(job)}
+`)
+
+var finishScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], 'ver') ~= ARGV[2] then
+	return 0
+end
+if ARGV[3] == '' then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+	redis.call('DEL', KEYS[2])
+	return 1
+end
+redis.call('HSET', KEYS[2], 'slot', ARGV[4], 'next', ARGV[5], 'lag', ARGV[6])
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+var jobFields = []string{"ver", "device", "slot", "next", "failures", "successes", "lag"}
+
+type redisQueue struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+}
+
+func newRedisQueue(client *redis.Client) *redisQueue {
+	return &redisQueue{
+		client: client,
+	}
+}
+
+func (q *redisQueue) jobKey(id string) string {
+	return jobKeyPrefix + id
+}
+
+func (q *redisQueue) push(ctx context.Context, job *CheckJob, replace bool) error {
+	dev, err := encodeDevice(job)
+	if err != nil {
+		return err
+	}
+
+	flag := "0"
+	if replace {
+		flag = "1"
+	}
+
+	return pushScript.Run(ctx, q.client, []string{queueKey, q.jobKey(job.DeviceID)},
+		job.DeviceID, flag, job.nextRun.UnixMilli(), dev,
+		job.slot.UnixNano(), job.nextRun.UnixNano()).Err()
+}
+
+func (q *redisQueue) pushOnce(ctx context.Context, job *CheckJob) error {
+	dev, err := encodeDevice(job)
+	if err != nil {
+		return err
+	}
+	return q.client.LPush(ctx, onceKey, job.RequestID+"\n"+dev).Err()
+}
+
+func (q *redisQueue) claim(ctx context.Context, now time.Time, reschedule func(*CheckJob) bool) (*CheckJob, time.Time, error) {
+	for {
+		res, err := claimScript.Run(ctx, q.client, []string{queueKey, onceKey},
+			now.UnixMilli(), now.Add(claimLease).UnixMilli(), jobKeyPrefix).Slice()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if len(res) == 0 {
+			return nil, time.Time{}, nil
+		}
+
+		switch res[0] {
+		case "wait":
+			ms, err := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			return nil, time.UnixMilli(int64(ms)), nil
+
+		case "once":
+			requestID, dev, _ := strings.Cut(fmt.Sprint(res[1]), "\n")
+			var d device.Device
+			if err := json.Unmarshal([]byte(dev), &d); err != nil {
+				return nil, time.Time{}, err
+			}
+			job := newJob(&d)
+			job.RequestID = requestID
+			job.oneShot = true
+			job.nextRun = now
+			job.slot = now
+			return job, time.Time{}, nil
+		}
+
+		id := fmt.Sprint(res[1])
+		ver, job, err := decodeJob(res[2:])
+		if err != nil {
+			// The job state is gone or broken; drop the entry.
+			log.Printf("[WARN] scheduler: drop job of device %s: %v", id, err)
+			if err := q.client.ZRem(ctx, queueKey, id).Err(); err != nil {
+				return nil, time.Time{}, err
+			}
+			continue
+		}
+
+		next := *job
+		args := []interface{}{id, ver, "", "", ""}
+		if reschedule(&next) {
+			args = []interface{}{id, ver, next.nextRun.UnixMilli(), next.slot.UnixNano(), next.nextRun.UnixNano(), int64(next.lag)}
+		}
+		if err := finishScript.Run(ctx, q.client, []string{queueKey, q.jobKey(id)}, args...).Err(); err != nil {
+			return nil, time.Time{}, err
+		}
+
+		return job, time.Time{}, nil
+	}
+}
+
+func (q *redisQueue) update(ctx context.Context, deviceID string, fn func(*CheckJob) bool) error {
+	key := q.jobKey(deviceID)
+
+	for attempt := 0; attempt < 5; attempt++ {
+		err := q.client.Watch(ctx, func(tx *redis.Tx) error {
+			vals, err := tx.HMGet(ctx, key, jobFields...).Result()
+			if err != nil {
+				return err
+			}
+			if vals[1] == nil {
+				return nil
+			}
+
+			_, job, err := decodeJob(vals)
+			if err != nil {
+				return err
+			}
+			changed := fn(job)
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, key,
+					"failures", job.failures,
+					"successes", job.successes,
+					"lag", int64(job.lag))
+				if changed {
+					pipe.HSet(ctx, key, "slot", job.slot.UnixNano(), "next", job.nextRun.UnixNano())
+					pipe.ZAddXX(ctx, queueKey, redis.Z{Score: float64(job.nextRun.UnixMilli()), Member: deviceID})
+				}
+				return nil
+			})
+			return err
+		}, key)
+
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("scheduler: update of device %s kept conflicting", deviceID)
+}
+
+// overdueScanLimit bounds the due jobs inspected by overdue.
+const overdueScanLimit = 1000
+
+func (q *redisQueue) overdue(ctx context.Context, now time.Time) (int, error) {
+	due, err := q.client.ZRangeByScoreWithScores(ctx, queueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: overdueScanLimit,
+	}).Result()
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	pipe := q.client.Pipeline()
+	devs := make([]*redis.StringCmd, len(due))
+	for i, z := range due {
+		devs[i] = pipe.HGet(ctx, q.jobKey(fmt.Sprint(z.Member)), "device")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	n := 0
+	for i, z := range due {
+		var d device.Device
+		if err := json.Unmarshal([]byte(devs[i].Val()), &d); err != nil {
+			continue
+		}
+		if now.Sub(time.UnixMilli(int64(z.Score))) > jobInterval(d.IntervalSec) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *redisQueue) get(ctx context.Context, deviceID string) (*CheckJob, error) {
+	vals, err := q.client.HMGet(ctx, q.jobKey(deviceID), jobFields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	if vals[1] == nil {
+		return nil, nil
+	}
+
+	_, job, err := decodeJob(vals)
+	return job, err
+}
+
+func (q *redisQueue) publish(ctx context.Context, h *health.HealthStatus) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return q.client.Publish(ctx, resultsChannel, b).Err()
+}
+
+func (q *redisQueue) subscribe(fn func(*health.HealthStatus)) {
+	q.pubsub = q.client.Subscribe(context.Background(), resultsChannel)
+
+	go func() {
+		for msg := range q.pubsub.Channel() {
+			var h health.HealthStatus
+			if err := json.Unmarshal([]byte(msg.Payload), &h); err != nil {
+				log.Printf("[WARN] scheduler: bad result message: %v", err)
+				continue
+			}
+			fn(&h)
+		}
+	}()
+}
+
+func (q *redisQueue) close() error {
+	if q.pubsub == nil {
+		return nil
+	}
+	return q.pubsub.Close()
+}
+
+func encodeDevice(job *CheckJob) (string, error) {
+	d := job.device
+	if d == nil {
+		d = &device.Device{
+			ID:          job.DeviceID,
+			Address:     job.Address,
+			CheckMethod: job.Method,
+			IntervalSec: job.IntervalSec,
+			TimeoutSec:  job.TimeoutS,
+		}
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// decodeJob rebuilds a job from the values of jobFields, returning its
+// version alongside.
+func decodeJob(vals []interface{}) (string, *CheckJob, error) {
+	if len(vals) < len(jobFields) || vals[1] == nil {
+		return "", nil, errors.New("missing job state")
+	}
+
+	str := func(i int) string {
+		if vals[i] == nil {
+			return ""
+		}
+		return fmt.Sprint(vals[i])
+	}
+	num := func(i int) int64 {
+		n, _ := strconv.ParseInt(str(i), 10, 64)
+		return n
+	}
+
+	var d device.Device
+	if err := json.Unmarshal([]byte(str(1)), &d); err != nil {
+		return "", nil, err
+	}
+
+	job := newJob(&d)
+	job.slot = time.Unix(0, num(2))
+	job.nextRun = time.Unix(0, num(3))
+	job.failures = int(num(4))
+	job.successes = int(num(5))
+	job.lag = time.Duration(num(6))
+
+	return str(0), job, nil
+}
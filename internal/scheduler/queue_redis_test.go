@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/device"
+	"github.com/Rin0913/monitor/internal/health"
+	"github.com/Rin0913/monitor/internal/redisclient"
+)
+
+// newRedisReplicas returns n schedulers sharing a queue on the test database
+// and removes the queue entries of the given devices before and after the test.
+func newRedisReplicas(t *testing.T, n int, deviceIDs ...string) []*Scheduler {
+	t.Helper()
+
+	if os.Getenv("REDIS_ADDR") == "" && os.Getenv("REDIS_URL") == "" {
+		t.Skip("redis not configured")
+	}
+
+	client := redisclient.NewTestClientFromEnv()
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis not reachable: %v", err)
+	}
+
+	owned := make(map[string]bool, len(deviceIDs))
+	for _, id := range deviceIDs {
+		owned[id] = true
+	}
+	cleanup := func() {
+		for _, id := range deviceIDs {
+			client.ZRem(ctx, queueKey, id)
+			client.Del(ctx, jobKeyPrefix+id)
+		}
+		entries, _ := client.LRange(ctx, onceKey, 0, -1).Result()
+		for _, e := range entries {
+			_, dev, _ := strings.Cut(e, "\n")
+			var d device.Device
+			if json.Unmarshal([]byte(dev), &d) == nil && owned[d.ID] {
+				client.LRem(ctx, onceKey, 0, e)
+			}
+		}
+	}
+	cleanup()
+
+	replicas := make([]*Scheduler, n)
+	for i := range replicas {
+		replicas[i] = New(&fakeDeviceRepo{}, &fakeHealthRepo{}, WithRedis(client))
+	}
+
+	t.Cleanup(func() {
+		for _, s := range replicas {
+			_ = s.Close()
+		}
+		cleanup()
+		_ = client.Close()
+	})
+	return replicas
+}
+
+func TestRedisQueueClaimsOnce(t *testing.T) {
+	replicas := newRedisReplicas(t, 2, "shared")
+	a, b := replicas[0], replicas[1]
+	ctx := context.Background()
+
+	d := &device.Device{ID: "shared", Address: "10.0.0.1:22", CheckMethod: "tcp_check", IntervalSec: 60}
+	a.Add(d)
+
+	// a second replica bootstrapping must not reset the schedule
+	b.deviceRepo = &fakeDeviceRepo{devs: []*device.Device{d}}
+	if err := b.Bootstrap(ctx); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+
+	job, err := b.TryNextJob(ctx)
+	if err != nil || job == nil {
+		t.Fatalf("expected the due job, got %v, %v", job, err)
+	}
+	if job.DeviceID != "shared" || job.Address != "10.0.0.1:22" || job.Method != "tcp_check" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	if again, err := a.TryNextJob(ctx); err != nil || again != nil {
+		t.Fatalf("job claimed twice: %v, %v", again, err)
+	}
+
+	st := a.Status("shared")
+	if st == nil {
+		t.Fatalf("device not scheduled")
+	}
+	if d := st.NextRun.Sub(job.nextRun); d < 59*time.Second || d > 61*time.Second {
+		t.Fatalf("next run %v is not one interval after %v", st.NextRun, job.nextRun)
+	}
+
+	if n, err := a.queue.overdue(ctx, st.NextRun.Add(90*time.Second)); err != nil || n != 1 {
+		t.Fatalf("overdue = %d, %v; want 1", n, err)
+	}
+}
+
+func TestRedisQueueLeasesClaimedJobs(t *testing.T) {
+	replicas := newRedisReplicas(t, 2, "leased")
+	a, b := replicas[0], replicas[1]
+	ctx := context.Background()
+
+	a.Add(&device.Device{ID: "leased", IntervalSec: 60})
+
+	// a replica that dies right after claiming never stores the next run
+	q := a.queue.(*redisQueue)
+	now := time.Now()
+	if err := claimScript.Run(ctx, q.client, []string{queueKey, onceKey},
+		now.UnixMilli(), now.Add(claimLease).UnixMilli(), jobKeyPrefix).Err(); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+
+	if job, err := b.TryNextJob(ctx); err != nil || job != nil {
+		t.Fatalf("leased job claimed: %v, %v", job, err)
+	}
+
+	later := now.Add(claimLease + time.Second)
+	job, _, err := b.queue.claim(ctx, later, b.rescheduler(later))
+	if err != nil || job == nil || job.DeviceID != "leased" {
+		t.Fatalf("expired lease not claimed: %v, %v", job, err)
+	}
+}
+
+func TestRedisQueueRunNowAcrossReplicas(t *testing.T) {
+	replicas := newRedisReplicas(t, 2, "web")
+	a, b := replicas[0], replicas[1]
+	ctx := context.Background()
+
+	d := &device.Device{ID: "web", Address: "10.0.0.2:80", CheckMethod: "tcp_check", IntervalSec: 3600}
+	if err := a.addWithNextRun(ctx, d, time.Now().Add(30*time.Minute), true); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	before := a.Status("web").NextRun
+
+	// wait for the subscription so the published result is not missed
+	time.Sleep(100 * time.Millisecond)
+
+	requestID, result := a.RunNow(ctx, d)
+
+	job, err := b.TryNextJob(ctx)
+	if err != nil || job == nil || job.DeviceID != "web" {
+		t.Fatalf("expected the on-demand job, got %v, %v", job, err)
+	}
+
+	if job.RequestID == "" || job.RequestID != requestID {
+		t.Fatalf("on-demand job lost its request ID: %+v", job)
+	}
+	b.Report(&health.HealthStatus{DeviceID: "web", Status: "DOWN", LastCheck: time.Now(), RequestID: job.RequestID})
+
+	select {
+	case got := <-result:
+		if got.DeviceID != "web" || got.Status != "DOWN" {
+			t.Fatalf("unexpected result: %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("RunNow result not delivered")
+	}
+
+	st := a.Status("web")
+	if !st.NextRun.Equal(before) || st.ConsecutiveFailures != 0 {
+		t.Fatalf("regular cadence disturbed: %+v (next run before %v)", st, before)
+	}
+}
@@ -1,15 +1,19 @@
 package scheduler
 
 import (
-	"container/heap"
 	"context"
 	"errors"
+	"hash/fnv"
 	"log"
+	"math/rand"
 	"sync"
 	"time"
 
+	"github.com/Rin0913/monitor/internal/clock"
 	"github.com/Rin0913/monitor/internal/device"
 	"github.com/Rin0913/monitor/internal/health"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
 var ErrClosed = errors.New("scheduler closed")
@@ -20,36 +24,137 @@ type CheckJob struct {
 	Method      string
 	IntervalSec int
 	TimeoutS    int
-	nextRun     time.Time
-	index       int
+	// RequestID ties the result of a one-off check to the RunNow call that
+	// queued it. It is empty for regular runs.
+	RequestID string
+	nextRun   time.Time
+	slot      time.Time
+	device    *device.Device
+	calendar  *calendar
+	backoff   backoff
+	lag       time.Duration
+	oneShot   bool
+	failures  int
+	successes int
+	index     int
 }
 
 type Scheduler struct {
 	mu         sync.Mutex
-	cond       *sync.Cond
-	jobs       jobHeap
+	queue      queue
+	wake       chan struct{}
+	waiters    map[string]chan *health.HealthStatus
 	closed     bool
 	deviceRepo device.Repository
 	healthRepo health.Repository
+
+	// poll bounds the wait for new jobs when other replicas may add them.
+	poll   time.Duration
+	shared bool
+
+	limiter *limiter
+	lag     lagTracker
+
+	clock clock.Clock
+
+	spread bool
+	jitter float64
+	rand   *rand.Rand
+}
+
+type Option func(*Scheduler)
+
+// WithJitter delays every run by a random amount of up to fraction of the
+// device interval. The delay does not accumulate from run to run.
+func WithJitter(fraction float64) Option {
+	return func(s *Scheduler) {
+		if fraction < 0 {
+			fraction = 0
+		}
+		if fraction > 0.5 {
+			fraction = 0.5
+		}
+		s.jitter = fraction
+	}
+}
+
+// WithoutSpread disables per-device phase offsets, so overdue devices run
+// immediately after Bootstrap.
+func WithoutSpread() Option {
+	return func(s *Scheduler) {
+		s.spread = false
+	}
+}
+
+// WithClock makes the scheduler tell time by c instead of the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
 }
 
-func New(deviceRepo device.Repository, healthRepo health.Repository) *Scheduler {
+// WithRedis keeps the job queue in Redis instead of process memory, so
+// several server replicas can share it. Each due job is claimed by exactly
+// one replica, and jobs claimed by a replica that dies are picked up by the
+// others.
+func WithRedis(client *redis.Client) Option {
+	return func(s *Scheduler) {
+		s.queue = newRedisQueue(client)
+		s.poll = redisPollInterval
+		s.shared = true
+	}
+}
+
+func New(deviceRepo device.Repository, healthRepo health.Repository, opts ...Option) *Scheduler {
 	s := &Scheduler{
 		deviceRepo: deviceRepo,
 		healthRepo: healthRepo,
+		spread:     true,
+		lag:        lagTracker{threshold: defaultLagThreshold},
+		clock:      clock.Real,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		wake:       make(chan struct{}),
+		waiters:    make(map[string]chan *health.HealthStatus),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
-	s.cond = sync.NewCond(&s.mu)
-	heap.Init(&s.jobs)
+	if s.queue == nil {
+		s.queue = newMemoryQueue()
+	}
+	s.queue.subscribe(s.deliver)
 	return s
 }
 
+// Shared reports whether the job queue is shared with other replicas, in
+// which case one Bootstrap covers all of them.
+func (s *Scheduler) Shared() bool {
+	return s.shared
+}
+
+// Close stops the scheduler. Pending NextJob calls return ErrClosed.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.notify()
+	return s.queue.close()
+}
+
+// Bootstrap schedules all known devices. Devices already in a shared queue
+// keep their schedule, so replicas may bootstrap concurrently.
 func (s *Scheduler) Bootstrap(ctx context.Context) error {
 	devices, err := s.deviceRepo.List(ctx)
 	if err != nil {
 		return err
 	}
 
-	now := time.Now()
+	now := s.clock.Now()
 
 	for _, d := range devices {
 		h, err := s.healthRepo.Get(ctx, d.ID)
@@ -58,155 +163,315 @@ func (s *Scheduler) Bootstrap(ctx context.Context) error {
 			log.Printf("[WARN] %v", err)
 		}
 
-		interval := time.Duration(d.IntervalSec) * time.Second
-		if interval <= 0 {
-			interval = 60 * time.Second
-		}
+		interval := jobInterval(d.IntervalSec)
 
 		var nextRun time.Time
 
 		if h == nil || h.LastCheck.IsZero() {
-			nextRun = now
+			nextRun = s.phaseSlot(d.ID, interval, now)
 		} else {
 			scheduled := h.LastCheck.Add(interval)
 			if scheduled.Before(now) {
-				nextRun = now
+				nextRun = s.phaseSlot(d.ID, interval, now)
 			} else {
 				nextRun = scheduled
 			}
 		}
 
-		s.addWithNextRun(d, nextRun)
+		if err := s.addWithNextRun(ctx, d, nextRun, false); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// Add schedules d to run now, replacing its current schedule.
 func (s *Scheduler) Add(d *device.Device) {
-	s.addWithNextRun(d, time.Now())
+	if err := s.addWithNextRun(context.Background(), d, s.clock.Now(), true); err != nil {
+		log.Printf("[ERROR] schedule device %s: %v", d.ID, err)
+	}
 }
 
-func (s *Scheduler) addWithNextRun(d *device.Device, t time.Time) {
-	job := &CheckJob{
+// RunNow queues a one-off check of d ahead of its regular cadence, which is
+// left untouched. It returns the request ID the result of that check will
+// carry, and a channel receiving the result unless ctx ends first.
+func (s *Scheduler) RunNow(ctx context.Context, d *device.Device) (string, <-chan *health.HealthStatus) {
+	ch := make(chan *health.HealthStatus, 1)
+
+	job := newJob(d)
+	job.RequestID = uuid.NewString()
+	job.nextRun = s.clock.Now()
+	job.slot = job.nextRun
+
+	s.mu.Lock()
+	s.waiters[job.RequestID] = ch
+	s.mu.Unlock()
+
+	// A check that never reports must not leave its waiter behind.
+	context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		delete(s.waiters, job.RequestID)
+		s.mu.Unlock()
+	})
+
+	if err := s.queue.pushOnce(context.Background(), job); err != nil {
+		log.Printf("[ERROR] queue check of device %s: %v", d.ID, err)
+	}
+	s.notify()
+	return job.RequestID, ch
+}
+
+func newJob(d *device.Device) *CheckJob {
+	return &CheckJob{
 		DeviceID:    d.ID,
 		Address:     d.Address,
 		Method:      d.CheckMethod,
 		IntervalSec: d.IntervalSec,
-		TimeoutS:    d.IntervalSec,
-		nextRun:     t,
+		TimeoutS:    d.TimeoutSec,
+		device:      d,
+		calendar:    newCalendar(d),
+		backoff:     newBackoff(d),
+	}
+}
+
+func (s *Scheduler) addWithNextRun(ctx context.Context, d *device.Device, t time.Time, replace bool) error {
+	job := newJob(d)
+	if job.calendar != nil {
+		t = job.calendar.first(t)
+		if t.IsZero() {
+			log.Printf("[WARN] device %s: schedule never fires", d.ID)
+			return nil
+		}
 	}
-	s.add(job)
+	job.nextRun = t
+	job.slot = t
+	return s.add(ctx, job, replace)
 }
 
-func (s *Scheduler) add(job *CheckJob) {
+func (s *Scheduler) add(ctx context.Context, job *CheckJob, replace bool) error {
+	if job.slot.IsZero() {
+		job.slot = job.nextRun
+	}
+	if err := s.queue.push(ctx, job, replace); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// notify wakes up NextJob callers waiting for the queue to change.
+func (s *Scheduler) notify() {
 	s.mu.Lock()
-	heap.Push(&s.jobs, job)
+	close(s.wake)
+	s.wake = make(chan struct{})
 	s.mu.Unlock()
-	s.cond.Signal()
 }
 
 func (s *Scheduler) NextJob(ctx context.Context) (*CheckJob, error) {
 	for {
 		s.mu.Lock()
+		closed, wake := s.closed, s.wake
+		s.mu.Unlock()
 
 		if ctx.Err() != nil {
-			s.mu.Unlock()
 			return nil, ctx.Err()
 		}
-		if s.closed {
-			s.mu.Unlock()
+		if closed {
 			return nil, ErrClosed
 		}
 
-		for len(s.jobs) == 0 {
-			waitCh := make(chan struct{})
-
-			go func() {
-				s.mu.Lock()
-				defer s.mu.Unlock()
-				s.cond.Wait()
-				close(waitCh)
-			}()
-
-			s.mu.Unlock()
-
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-waitCh:
-				s.mu.Lock()
-			}
+		now := s.clock.Now()
+		job, due, err := s.take(ctx, now)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
+			return job, nil
 		}
 
-		top := s.jobs[0]
-		now := time.Now()
-		if top.nextRun.After(now) {
-			wait := top.nextRun.Sub(now)
-			s.mu.Unlock()
-
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-time.After(wait):
-			}
-			continue
+		wait := s.poll
+		if !due.IsZero() && (wait == 0 || due.Sub(now) < wait) {
+			wait = due.Sub(now)
 		}
 
-		job := heap.Pop(&s.jobs).(*CheckJob)
+		var timer clock.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = s.clock.NewTimer(wait)
+			timeout = timer.C()
+		}
 
-		interval := time.Duration(job.IntervalSec) * time.Second
-		if interval <= 0 {
-			interval = 60 * time.Second
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-timeout:
 		}
-		next := job.nextRun.Add(interval)
-		if next.Before(now) {
-			next = now.Add(interval)
+		if timer != nil {
+			timer.Stop()
 		}
+	}
+}
 
-		nextJob := *job
-		nextJob.nextRun = next
-		heap.Push(&s.jobs, &nextJob)
+func (s *Scheduler) TryNextJob(ctx context.Context) (*CheckJob, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 
-		s.mu.Unlock()
-		return job, nil
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
 	}
+
+	job, _, err := s.take(ctx, s.clock.Now())
+	return job, err
 }
 
-func (s *Scheduler) TryNextJob(ctx context.Context) (*CheckJob, error) {
+// take hands out a waiting job the concurrency limits now allow, or else
+// the first due job within the limits. When there is none, it returns the
+// time to look again, or the zero time to wait for a change of the queue.
+func (s *Scheduler) take(ctx context.Context, now time.Time) (*CheckJob, time.Time, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	job := s.nextWaitingLocked(now)
+	if job != nil {
+		s.recordLagLocked(job, now)
+	}
+	s.mu.Unlock()
+	if job != nil {
+		if !job.oneShot {
+			s.recordDeferral(ctx, job, now)
+		}
+		return job, time.Time{}, nil
+	}
 
-	if ctx != nil && ctx.Err() != nil {
-		return nil, ctx.Err()
+	for {
+		job, due, err := s.queue.claim(ctx, now, s.rescheduler(now))
+		if err != nil || job == nil {
+			s.mu.Lock()
+			// Checks whose result never comes back free their slot
+			// after a while.
+			if l := s.limiter; l != nil && len(l.waiting) > 0 {
+				if retry := now.Add(time.Second); due.IsZero() || due.After(retry) {
+					due = retry
+				}
+			}
+			s.mu.Unlock()
+			return nil, due, err
+		}
+
+		s.mu.Lock()
+		admitted := s.admitLocked(job, now)
+		if admitted {
+			s.recordLagLocked(job, now)
+		}
+		s.mu.Unlock()
+		if admitted {
+			return job, time.Time{}, nil
+		}
 	}
-	if s.closed {
-		return nil, ErrClosed
+}
+
+// recordDeferral stores the lag of a job the limits held back, which the
+// claim recorded before the job had to wait.
+func (s *Scheduler) recordDeferral(ctx context.Context, job *CheckJob, now time.Time) {
+	lag := now.Sub(job.nextRun)
+	err := s.queue.update(ctx, job.DeviceID, func(next *CheckJob) bool {
+		if lag > next.lag {
+			next.lag = lag
+		}
+		return false
+	})
+	if err != nil {
+		log.Printf("[WARN] update lag of device %s: %v", job.DeviceID, err)
 	}
+}
+
+// rescheduler moves a dispatched job to its next run.
+func (s *Scheduler) rescheduler(now time.Time) func(*CheckJob) bool {
+	return func(job *CheckJob) bool {
+		next := s.nextSlot(job, now)
+		if next.IsZero() {
+			log.Printf("[WARN] device %s: schedule never fires again", job.DeviceID)
+			return false
+		}
 
-	if len(s.jobs) == 0 {
-		return nil, nil
+		job.lag = now.Sub(job.nextRun)
+		if job.lag < 0 {
+			job.lag = 0
+		}
+		job.slot = next
+		job.nextRun = next.Add(s.jitterFor(job, next))
+		return true
 	}
+}
 
-	top := s.jobs[0]
-	now := time.Now()
-	if top.nextRun.After(now) {
-		return nil, nil
+// nextSlot computes the run after job, skipping runs missed before now.
+func (s *Scheduler) nextSlot(job *CheckJob, now time.Time) time.Time {
+	c := job.calendar
+	if c != nil && c.cron != nil {
+		from := job.slot
+		if from.Before(now) {
+			from = now
+		}
+		return c.cron.Next(from.In(c.loc))
 	}
 
-	job := heap.Pop(&s.jobs).(*CheckJob)
+	interval := job.effectiveInterval()
+	next := job.slot.Add(interval)
+	if next.Before(now) {
+		next = s.phaseSlot(job.DeviceID, interval, now)
+	}
+	if c != nil {
+		next = c.window.NextStart(next.In(c.loc))
+	}
+	return next
+}
 
-	interval := time.Duration(job.IntervalSec) * time.Second
+func jobInterval(sec int) time.Duration {
+	interval := time.Duration(sec) * time.Second
 	if interval <= 0 {
 		interval = 60 * time.Second
 	}
-	next := job.nextRun.Add(interval)
-	if next.Before(now) {
-		next = now.Add(interval)
+	return interval
+}
+
+// phaseSlot returns the first time not before now at which the device's
+// phase comes round. The phase is a deterministic offset within the interval
+// derived from the device ID, so devices sharing an interval are spread over
+// it instead of all firing at once.
+func (s *Scheduler) phaseSlot(deviceID string, interval time.Duration, now time.Time) time.Time {
+	if !s.spread {
+		return now
 	}
 
-	nextJob := *job
-	nextJob.nextRun = next
-	heap.Push(&s.jobs, &nextJob)
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(deviceID))
+	phase := time.Duration(h.Sum64() % uint64(interval))
 
-	return job, nil
+	offset := (phase - time.Duration(now.UnixNano()%int64(interval)) + interval) % interval
+	return now.Add(offset)
+}
+
+// jitterFor returns the random delay of the run of job at slot. Cron jobs
+// run at their exact times, and the run of a device with an active window
+// is not delayed past the end of the window.
+func (s *Scheduler) jitterFor(job *CheckJob, slot time.Time) time.Duration {
+	c := job.calendar
+	if s.jitter <= 0 || s.rand == nil || (c != nil && c.cron != nil) {
+		return 0
+	}
+
+	s.mu.Lock()
+	d := time.Duration(s.rand.Int63n(int64(float64(jobInterval(job.IntervalSec))*s.jitter) + 1))
+	s.mu.Unlock()
+
+	if c != nil && !c.window.Contains(slot.Add(d).In(c.loc)) {
+		return 0
+	}
+	return d
 }
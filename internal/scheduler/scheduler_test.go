@@ -1,20 +1,20 @@
 package scheduler
 
 import (
-	"container/heap"
 	"context"
-	"sync"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/Rin0913/monitor/internal/clock"
 	"github.com/Rin0913/monitor/internal/device"
 	"github.com/Rin0913/monitor/internal/health"
 )
 
 func TestNextJobReschedule(t *testing.T) {
-	s := New(nil, nil)
+	s, clk := newTestScheduler()
 
-	now := time.Now()
+	now := clk.Now()
 	job := &CheckJob{
 		DeviceID:    "dev1",
 		Address:     "1.2.3.4:80",
@@ -23,10 +23,11 @@ func TestNextJobReschedule(t *testing.T) {
 		TimeoutS:    1,
 		nextRun:     now,
 	}
-	s.add(job)
+	if err := s.add(context.Background(), job, true); err != nil {
+		t.Fatalf("add: %v", err)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	ctx := context.Background()
 
 	j1, err := s.NextJob(ctx)
 	if err != nil {
@@ -36,20 +37,36 @@ func TestNextJobReschedule(t *testing.T) {
 		t.Fatalf("unexpected deviceID: %s", j1.DeviceID)
 	}
 
-	j2, err := s.NextJob(ctx)
-	if err != nil {
-		t.Fatalf("NextJob second: %v", err)
+	next := make(chan *CheckJob)
+	go func() {
+		j, err := s.NextJob(ctx)
+		if err != nil {
+			t.Errorf("NextJob second: %v", err)
+		}
+		next <- j
+	}()
+
+	// NextJob waits for the next run
+	clk.BlockUntil(1)
+	select {
+	case j := <-next:
+		t.Fatalf("job handed out before it is due: %+v", j)
+	default:
 	}
-	if j2.DeviceID != "dev1" {
-		t.Fatalf("unexpected deviceID second: %s", j2.DeviceID)
+	clk.Advance(time.Second)
+
+	j2 := <-next
+	if j2 == nil || j2.DeviceID != "dev1" {
+		t.Fatalf("unexpected second job: %+v", j2)
 	}
-	if !j2.nextRun.After(j1.nextRun) {
-		t.Fatalf("nextRun not advanced: first=%v second=%v", j1.nextRun, j2.nextRun)
+	if want := now.Add(time.Second); !j2.nextRun.Equal(want) {
+		t.Fatalf("nextRun not advanced by the interval: first=%v second=%v", j1.nextRun, j2.nextRun)
 	}
 }
 
 func TestBootstrapUsesHealthForNextRun(t *testing.T) {
-	now := time.Now()
+	clk := clock.NewFake(testNow)
+	now := clk.Now()
 
 	d1 := &device.Device{
 		ID:          "no-health",
@@ -74,12 +91,7 @@ func TestBootstrapUsesHealthForNextRun(t *testing.T) {
 		},
 	}
 
-	s := &Scheduler{
-		deviceRepo: devRepo,
-		healthRepo: healthRepo,
-	}
-	s.cond = sync.NewCond(&s.mu)
-	heap.Init(&s.jobs)
+	s := New(devRepo, healthRepo, WithoutSpread(), WithClock(clk))
 
 	ctx := context.Background()
 	if err := s.Bootstrap(ctx); err != nil {
@@ -101,10 +113,39 @@ func TestBootstrapUsesHealthForNextRun(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error occurs in unblocking TryNextJob: %v", err)
 	}
+
+	// the fresh device runs one interval after its last check
+	clk.Advance(30 * time.Second)
+	j3, err := s.TryNextJob(ctx)
+	if err != nil || j3 == nil || j3.DeviceID != "fresh" {
+		t.Fatalf("expected the fresh device at its next run, got %v, %v", j3, err)
+	}
+	if want := now.Add(30 * time.Second); !j3.nextRun.Equal(want) {
+		t.Fatalf("fresh device scheduled at %v, want %v", j3.nextRun, want)
+	}
 }
 
 // Some trivial definitions
 
+// testNow is a Monday morning.
+var testNow = time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+
+func newTestScheduler(opts ...Option) (*Scheduler, *clock.Fake) {
+	clk := clock.NewFake(testNow)
+	return New(nil, nil, append(opts, WithClock(clk))...), clk
+}
+
+// jobs returns the heap of the in-memory queue.
+func (s *Scheduler) jobs() jobHeap {
+	return s.queue.(*memoryQueue).jobs
+}
+
+// dispatch claims the first job as if it were now.
+func (s *Scheduler) dispatch(now time.Time) *CheckJob {
+	job, _, _ := s.queue.claim(context.Background(), now, s.rescheduler(now))
+	return job
+}
+
 type fakeDeviceRepo struct {
 	devs []*device.Device
 }
@@ -146,3 +187,387 @@ func (r *fakeHealthRepo) Save(ctx context.Context, h *health.HealthStatus, ttl t
 	r.m[h.DeviceID] = h
 	return nil
 }
+
+func TestPhaseSlotSpreadsDevices(t *testing.T) {
+	s, clk := newTestScheduler()
+
+	now := clk.Now()
+	interval := 60 * time.Second
+	seen := make(map[time.Time]bool)
+
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("dev-%d", i)
+		slot := s.phaseSlot(id, interval, now)
+		if slot.Before(now) || !slot.Before(now.Add(interval)) {
+			t.Fatalf("slot for %s out of range: %v", id, slot.Sub(now))
+		}
+		if again := s.phaseSlot(id, interval, now.Add(interval)); !again.Equal(slot.Add(interval)) {
+			t.Fatalf("phase of %s is not stable: %v vs %v", id, slot, again)
+		}
+		seen[slot] = true
+	}
+
+	if len(seen) < 90 {
+		t.Fatalf("devices are not spread: only %d distinct slots", len(seen))
+	}
+}
+
+func TestBootstrapSpreadsOverdueDevices(t *testing.T) {
+	devs := make([]*device.Device, 0, 20)
+	for i := 0; i < 20; i++ {
+		devs = append(devs, &device.Device{ID: fmt.Sprintf("dev-%d", i), IntervalSec: 3600})
+	}
+
+	s := New(&fakeDeviceRepo{devs: devs}, &fakeHealthRepo{}, WithClock(clock.NewFake(testNow)))
+	if err := s.Bootstrap(context.Background()); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+
+	due := 0
+	for {
+		job, err := s.TryNextJob(context.Background())
+		if err != nil {
+			t.Fatalf("TryNextJob: %v", err)
+		}
+		if job == nil {
+			break
+		}
+		due++
+	}
+	if due > 1 {
+		t.Fatalf("expected overdue devices to be spread over the interval, %d due at once", due)
+	}
+}
+
+func TestJitterDoesNotAccumulate(t *testing.T) {
+	s, clk := newTestScheduler(WithJitter(0.5))
+
+	start := clk.Now().Add(-time.Hour)
+	_ = s.add(context.Background(), &CheckJob{DeviceID: "dev1", IntervalSec: 10, nextRun: start}, true)
+
+	for i := 1; i <= 5; i++ {
+		s.dispatch(start)
+		next := s.jobs()[0]
+		if want := start.Add(time.Duration(i) * 10 * time.Second); !next.slot.Equal(want) {
+			t.Fatalf("run %d: slot = %v, want %v", i, next.slot, want)
+		}
+		if d := next.nextRun.Sub(next.slot); d < 0 || d > 5*time.Second {
+			t.Fatalf("run %d: jitter %v out of range", i, d)
+		}
+		// pretend the jittered run is due
+		next.nextRun = start
+	}
+}
+
+func TestJitterKeepsCalendarTimes(t *testing.T) {
+	s, _ := newTestScheduler(WithJitter(0.5))
+	s.Add(&device.Device{ID: "batch", IntervalSec: 600, Cron: "*/5 * * * *"})
+
+	job := s.jobs()[0]
+	s.dispatch(job.nextRun)
+	if job = s.jobs()[0]; !job.nextRun.Equal(job.slot) {
+		t.Fatalf("cron run jittered: next run %v, slot %v", job.nextRun, job.slot)
+	}
+
+	start := testNow.Add(2 * time.Hour)
+	end := start.Add(time.Hour)
+	s, _ = newTestScheduler(WithJitter(0.5), WithoutSpread())
+	s.Add(&device.Device{
+		ID:          "office",
+		IntervalSec: 600,
+		ActiveWindow: &device.TimeWindow{
+			Start: start.Format("15:04"),
+			End:   end.Format("15:04"),
+		},
+	})
+
+	// the last slot of the window leaves less room than the jitter
+	s.jobs()[0].slot = end.Add(-20 * time.Minute)
+	s.dispatch(end.Add(-20 * time.Minute))
+	job = s.jobs()[0]
+	if !job.slot.Equal(end.Add(-10*time.Minute)) || !job.nextRun.Before(end) {
+		t.Fatalf("run jittered out of the window: next run %v, slot %v", job.nextRun, job.slot)
+	}
+}
+
+func TestCronScheduleComputesNextRun(t *testing.T) {
+	s, clk := newTestScheduler()
+	clk.Advance(2*time.Minute + 30*time.Second)
+	s.Add(&device.Device{ID: "batch", IntervalSec: 60, Cron: "*/5 * * * *"})
+
+	job := s.jobs()[0]
+	if want := testNow.Add(5 * time.Minute); !job.nextRun.Equal(want) {
+		t.Fatalf("first run = %v, want %v", job.nextRun, want)
+	}
+
+	// a dispatch that is 12 minutes late skips the missed runs
+	late := job.nextRun.Add(12 * time.Minute)
+	s.dispatch(late)
+	next := s.jobs()[0].nextRun
+
+	if want := job.nextRun.Add(15 * time.Minute); !next.Equal(want) {
+		t.Fatalf("next run = %v, want %v", next, want)
+	}
+}
+
+func TestResultTTL(t *testing.T) {
+	plain := &device.Device{ID: "web", IntervalSec: 60}
+	batch := &device.Device{ID: "batch", IntervalSec: 60, Cron: "0 3 * * *"}
+
+	if ttl := ResultTTL(plain); ttl != 3*time.Minute {
+		t.Fatalf("plain device: ttl %v", ttl)
+	}
+	if ttl := ResultTTL(batch); ttl != 0 {
+		t.Fatalf("cron device: ttl %v, want results kept", ttl)
+	}
+	if ttl := newJob(batch).ResultTTL(); ttl != 0 {
+		t.Fatalf("cron job: ttl %v, want results kept", ttl)
+	}
+}
+
+func TestActiveWindowDefersOutsideWindow(t *testing.T) {
+	start := testNow.Add(2 * time.Hour)
+	end := start.Add(time.Hour)
+
+	s, _ := newTestScheduler(WithoutSpread())
+	s.Add(&device.Device{
+		ID:          "office",
+		IntervalSec: 60,
+		ActiveWindow: &device.TimeWindow{
+			Start: start.Format("15:04"),
+			End:   end.Format("15:04"),
+		},
+	})
+
+	if got := s.jobs()[0].nextRun; !got.Equal(start) {
+		t.Fatalf("first run = %v, want window start %v", got, start)
+	}
+
+	// the last run inside the window moves the next one to tomorrow
+	s.jobs()[0].slot = end.Add(-30 * time.Second)
+	s.dispatch(end.Add(-30 * time.Second))
+	next := s.jobs()[0].nextRun
+
+	if want := start.AddDate(0, 0, 1); !next.Equal(want) {
+		t.Fatalf("next run = %v, want %v", next, want)
+	}
+}
+
+func TestReportAdaptsInterval(t *testing.T) {
+	s, clk := newTestScheduler()
+	s.Add(&device.Device{
+		ID:                  "flaky",
+		IntervalSec:         60,
+		RetryIntervalSec:    5,
+		MaxRetryIntervalSec: 20,
+		MaxIntervalSec:      240,
+	})
+
+	checkedAt := clk.Now()
+	report := func(status string) time.Duration {
+		s.Report(&health.HealthStatus{DeviceID: "flaky", Status: status, LastCheck: checkedAt})
+		st := s.Status("flaky")
+		if st == nil {
+			t.Fatalf("device not scheduled")
+		}
+		if got := st.NextRun.Sub(checkedAt); got != time.Duration(st.EffectiveIntervalSec)*time.Second {
+			t.Fatalf("next run %v does not match effective interval %ds", got, st.EffectiveIntervalSec)
+		}
+		return time.Duration(st.EffectiveIntervalSec) * time.Second
+	}
+
+	want := []struct {
+		status   string
+		interval time.Duration
+	}{
+		{"DOWN", 5 * time.Second},
+		{"DOWN", 10 * time.Second},
+		{"DOWN", 20 * time.Second},
+		{"DOWN", 20 * time.Second},
+		{"UP", 60 * time.Second},
+		{"UP", 60 * time.Second},
+		{"UP", 60 * time.Second},
+		{"UP", 120 * time.Second},
+		{"UP", 240 * time.Second},
+		{"UP", 240 * time.Second},
+		{"DOWN", 5 * time.Second},
+	}
+	for i, w := range want {
+		if got := report(w.status); got != w.interval {
+			t.Fatalf("report %d (%s): interval = %v, want %v", i, w.status, got, w.interval)
+		}
+	}
+}
+
+func TestReportWithoutAdaptiveKeepsCadence(t *testing.T) {
+	s, clk := newTestScheduler()
+	s.Add(&device.Device{ID: "plain", IntervalSec: 60})
+
+	before := s.Status("plain").NextRun
+	s.Report(&health.HealthStatus{DeviceID: "plain", Status: "DOWN", LastCheck: clk.Now().Add(time.Minute)})
+
+	st := s.Status("plain")
+	if !st.NextRun.Equal(before) || st.EffectiveIntervalSec != 60 || st.ConsecutiveFailures != 1 {
+		t.Fatalf("unexpected status: %+v (next run before %v)", st, before)
+	}
+}
+
+func TestRunNowKeepsRegularCadence(t *testing.T) {
+	s, clk := newTestScheduler()
+	d := &device.Device{ID: "web", Address: "10.0.0.1:80", CheckMethod: "tcp_check", IntervalSec: 3600, RetryIntervalSec: 10}
+	_ = s.addWithNextRun(context.Background(), d, clk.Now().Add(30*time.Minute), true)
+
+	before := s.Status("web").NextRun
+	requestID, result := s.RunNow(context.Background(), d)
+
+	job, err := s.TryNextJob(context.Background())
+	if err != nil || job == nil {
+		t.Fatalf("expected the on-demand job, got %v, %v", job, err)
+	}
+	if job.DeviceID != "web" || job.Address != "10.0.0.1:80" || job.RequestID == "" || job.RequestID != requestID {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if next, _ := s.TryNextJob(context.Background()); next != nil {
+		t.Fatalf("on-demand job must not be rescheduled: %+v", next)
+	}
+
+	// A regular run reporting first is not the answer.
+	s.Report(&health.HealthStatus{DeviceID: "web", Status: "UP", LastCheck: clk.Now()})
+	select {
+	case got := <-result:
+		t.Fatalf("regular result delivered to RunNow: %+v", got)
+	default:
+	}
+	before = s.Status("web").NextRun
+
+	h := &health.HealthStatus{DeviceID: "web", Status: "DOWN", LastCheck: clk.Now(), RequestID: job.RequestID}
+	s.Report(h)
+
+	select {
+	case got := <-result:
+		if got != h {
+			t.Fatalf("unexpected result: %+v", got)
+		}
+	default:
+		t.Fatalf("RunNow result not delivered")
+	}
+
+	st := s.Status("web")
+	if !st.NextRun.Equal(before) || st.ConsecutiveFailures != 0 {
+		t.Fatalf("regular cadence disturbed: %+v (next run before %v)", st, before)
+	}
+}
+
+func TestRunNowForgetsCallersThatStopWaiting(t *testing.T) {
+	s, _ := newTestScheduler()
+	d := &device.Device{ID: "web", Address: "10.0.0.1:80", CheckMethod: "tcp_check", IntervalSec: 3600}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.RunNow(ctx, d)
+	cancel()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		n := len(s.waiters)
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiters left behind", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimitsDeferJobs(t *testing.T) {
+	s, clk := newTestScheduler(WithoutSpread(), WithHostLimit(1), WithMethodLimit("cmd_ping", 1))
+	ctx := context.Background()
+
+	s.Add(&device.Device{ID: "ssh", Address: "10.0.0.1:22", CheckMethod: "tcp_check", IntervalSec: 60})
+	s.Add(&device.Device{ID: "web", Address: "http://10.0.0.1:80/", CheckMethod: "http", IntervalSec: 60})
+	s.Add(&device.Device{ID: "ping", Address: "10.0.0.2", CheckMethod: "cmd_ping", IntervalSec: 60})
+	s.Add(&device.Device{ID: "ping2", Address: "10.0.0.3", CheckMethod: "cmd_ping", IntervalSec: 60})
+
+	got := map[string]bool{}
+	for {
+		job, err := s.TryNextJob(ctx)
+		if err != nil {
+			t.Fatalf("TryNextJob: %v", err)
+		}
+		if job == nil {
+			break
+		}
+		got[job.DeviceID] = true
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected one check per host and method in flight, got %v", got)
+	}
+
+	st := s.Deferred()
+	if st == nil || st.Waiting != 2 || st.ByHost["10.0.0.1"] != 1 || st.ByMethod["cmd_ping"] != 1 {
+		t.Fatalf("unexpected deferred stats: %+v", st)
+	}
+
+	clk.Advance(5 * time.Second)
+	for id := range got {
+		s.Report(&health.HealthStatus{DeviceID: id, Status: "UP", LastCheck: clk.Now()})
+	}
+	for i := 0; i < 2; i++ {
+		job, err := s.TryNextJob(ctx)
+		if err != nil || job == nil {
+			t.Fatalf("deferred job not handed out after capacity freed: %v, %v", job, err)
+		}
+		if got[job.DeviceID] {
+			t.Fatalf("job %s handed out twice", job.DeviceID)
+		}
+		// the time spent waiting for capacity counts as lag
+		if lag := s.Status(job.DeviceID).LagMs; lag < 5000 {
+			t.Fatalf("lag of deferred job %s = %dms, want at least 5000ms", job.DeviceID, lag)
+		}
+	}
+	if st := s.Deferred(); st.Waiting != 0 {
+		t.Fatalf("jobs still waiting: %+v", st)
+	}
+}
+
+func TestLagAndOverloadDetection(t *testing.T) {
+	var alerts []bool
+	s, clk := newTestScheduler(WithLagThreshold(time.Second), WithOverloadHook(func(overloaded bool, st LagStats) {
+		alerts = append(alerts, overloaded)
+	}))
+	ctx := context.Background()
+
+	now := clk.Now()
+	_ = s.add(ctx, &CheckJob{DeviceID: "late", IntervalSec: 60, nextRun: now.Add(-2 * time.Minute)}, true)
+	_ = s.add(ctx, &CheckJob{DeviceID: "stuck", IntervalSec: 60, nextRun: now.Add(-90 * time.Second)}, true)
+
+	if job, err := s.TryNextJob(ctx); err != nil || job == nil || job.DeviceID != "late" {
+		t.Fatalf("expected the late job, got %v, %v", job, err)
+	}
+
+	lag := s.Lag()
+	if lag.Dispatched != 1 || lag.Late != 1 || lag.LastLagMs != 120000 || lag.AvgLagMs != 120000 {
+		t.Fatalf("unexpected lag stats: %+v", lag)
+	}
+	if st := s.Status("late"); st.LagMs != 120000 {
+		t.Fatalf("device lag not recorded: %+v", st)
+	}
+
+	st, err := s.CheckOverload(ctx)
+	if err != nil {
+		t.Fatalf("CheckOverload: %v", err)
+	}
+	if !st.Overloaded || st.Overdue != 1 {
+		t.Fatalf("expected overload with one overdue job: %+v", st)
+	}
+	if len(alerts) != 1 || !alerts[0] {
+		t.Fatalf("overload hook not called: %v", alerts)
+	}
+
+	// a second check without change does not alert again
+	if _, err := s.CheckOverload(ctx); err != nil || len(alerts) != 1 {
+		t.Fatalf("repeated alert: %v, %v", alerts, err)
+	}
+}
@@ -0,0 +1,313 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+// statusRank orders statuses from best to worst for worst_of / best_of.
+var statusRank = map[string]int{
+	"UP":             0,
+	"UNKNOWN":        1,
+	"UNKNOWN_METHOD": 2,
+	"DOWN":           3,
+}
+
+func rank(status string) int {
+	if r, ok := statusRank[status]; ok {
+		return r
+	}
+	return statusRank["UNKNOWN"]
+}
+
+type subResult struct {
+	Status    string                 `json:"status"`
+	LatencyMS int                    `json:"latency_ms"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+type compositeStackKey struct{}
+
+// MakeCompositeChecker registers a checker combining other checker methods.
+// mode is "expression" (boolean logic over the methods' UP state),
+// "worst_of" or "best_of".
+func (e *Engine) MakeCompositeChecker(name, mode, expression string, methods []string) error {
+	if mode == "" {
+		mode = "expression"
+	}
+
+	var expr boolExpr
+	switch mode {
+	case "expression":
+		var err error
+		if expr, err = parseBoolExpr(expression); err != nil {
+			return fmt.Errorf("composite checker %s: %w", name, err)
+		}
+		methods = expr.methods(nil)
+	case "worst_of", "best_of":
+		if len(methods) == 0 {
+			return fmt.Errorf("composite checker %s: no checkers", name)
+		}
+	default:
+		return fmt.Errorf("composite checker %s: unknown mode %q", name, mode)
+	}
+
+	methods = uniqueStrings(methods)
+
+	fn := func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		stack, _ := ctx.Value(compositeStackKey{}).([]string)
+		for _, s := range stack {
+			if s == name {
+				return "UNKNOWN", -1, nil, fmt.Errorf("composite cycle: %s -> %s", strings.Join(stack, " -> "), name)
+			}
+		}
+		ctx = context.WithValue(ctx, compositeStackKey{}, append(stack[:len(stack):len(stack)], name))
+
+		start := time.Now()
+		results := e.runAll(ctx, job, methods)
+		latency := int(time.Since(start) / time.Millisecond)
+
+		data := map[string]interface{}{
+			"results": results,
+		}
+
+		var status string
+		switch mode {
+		case "expression":
+			status = "DOWN"
+			if expr.eval(results) {
+				status = "UP"
+			}
+		case "worst_of":
+			status = "UP"
+			for _, m := range methods {
+				if rank(results[m].Status) > rank(status) {
+					status = results[m].Status
+				}
+			}
+		case "best_of":
+			status = "DOWN"
+			for _, m := range methods {
+				if rank(results[m].Status) < rank(status) {
+					status = results[m].Status
+				}
+			}
+		}
+
+		return status, latency, data, nil
+	}
+
+	e.RegisterChecker(name, fn)
+	return nil
+}
+
+// runAll runs the given checker methods concurrently against one job.
+func (e *Engine) runAll(ctx context.Context, job *scheduler.CheckJob, methods []string) map[string]*subResult {
+	results := make(map[string]*subResult, len(methods))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, m := range methods {
+		wg.Add(1)
+		go func(m string) {
+			defer wg.Done()
+
+			res := &subResult{Status: "UNKNOWN_METHOD", LatencyMS: -1}
+			if fn := e.getChecker(m); fn != nil {
+				sub := *job
+				sub.Method = m
+
+				status, latency, data, err := fn(ctx, &sub)
+				if status == "" {
+					status = "UNKNOWN"
+					if err != nil {
+						status = "DOWN"
+					}
+				}
+				res = &subResult{Status: status, LatencyMS: latency, Data: data}
+				if err != nil {
+					res.Error = err.Error()
+				}
+			}
+
+			mu.Lock()
+			results[m] = res
+			mu.Unlock()
+		}(m)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// boolExpr is a parsed composite expression such as
+// "tcp_check AND (http_home OR http_backup)".
+type boolExpr interface {
+	eval(results map[string]*subResult) bool
+	methods(acc []string) []string
+}
+
+type methodExpr string
+type notExpr struct{ x boolExpr }
+type andExpr struct{ l, r boolExpr }
+type orExpr struct{ l, r boolExpr }
+
+func (m methodExpr) eval(res map[string]*subResult) bool {
+	r, ok := res[string(m)]
+	return ok && r.Status == "UP"
+}
+func (n notExpr) eval(res map[string]*subResult) bool { return !n.x.eval(res) }
+func (a andExpr) eval(res map[string]*subResult) bool { return a.l.eval(res) && a.r.eval(res) }
+func (o orExpr) eval(res map[string]*subResult) bool  { return o.l.eval(res) || o.r.eval(res) }
+
+func (m methodExpr) methods(acc []string) []string { return append(acc, string(m)) }
+func (n notExpr) methods(acc []string) []string    { return n.x.methods(acc) }
+func (a andExpr) methods(acc []string) []string    { return a.r.methods(a.l.methods(acc)) }
+func (o orExpr) methods(acc []string) []string     { return o.r.methods(o.l.methods(acc)) }
+
+// parseBoolExpr parses AND / OR / NOT (also && || !) with parentheses.
+// NOT binds tighter than AND, which binds tighter than OR.
+func parseBoolExpr(s string) (boolExpr, error) {
+	p := &exprParser{tokens: tokenize(s)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+func tokenize(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')' || c == '!':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		default:
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && !strings.ContainsRune("()!&|", rune(s[j])) {
+				j++
+			}
+			if j == i {
+				// a lone '&' or '|'
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) parseOr() (boolExpr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); strings.EqualFold(t, "OR") || t == "||"; t = p.peek() {
+		p.pos++
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orExpr{l, r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseAnd() (boolExpr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); strings.EqualFold(t, "AND") || t == "&&"; t = p.peek() {
+		p.pos++
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = andExpr{l, r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseNot() (boolExpr, error) {
+	t := p.peek()
+	if strings.EqualFold(t, "NOT") || t == "!" {
+		p.pos++
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (boolExpr, error) {
+	t := p.peek()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case t == "(":
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return e, nil
+	case t == ")" || t == "&&" || t == "||" || t == "&" || t == "|" ||
+		strings.EqualFold(t, "AND") || strings.EqualFold(t, "OR"):
+		return nil, fmt.Errorf("unexpected %q", t)
+	default:
+		p.pos++
+		return methodExpr(t), nil
+	}
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+func staticChecker(status string) CheckerFunc {
+	return func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		if status == "DOWN" {
+			return status, 1, nil, errors.New("refused")
+		}
+		return status, 1, nil, nil
+	}
+}
+
+func newCompositeEngine() *Engine {
+	e := NewEngine()
+	e.RegisterChecker("tcp_up", staticChecker("UP"))
+	e.RegisterChecker("http_home", staticChecker("DOWN"))
+	e.RegisterChecker("http_backup", staticChecker("UP"))
+	e.RegisterChecker("grpc_unknown", staticChecker("UNKNOWN"))
+	return e
+}
+
+func TestCompositeChecker_Expression(t *testing.T) {
+	cases := map[string]string{
+		"tcp_up AND (http_home OR http_backup)": "UP",
+		"tcp_up && http_home":                   "DOWN",
+		"NOT http_home and tcp_up":              "UP",
+		"!tcp_up || http_home":                  "DOWN",
+		"http_home OR missing_method":           "DOWN",
+	}
+
+	for expr, want := range cases {
+		e := newCompositeEngine()
+		if err := e.MakeCompositeChecker("svc", "", expr, nil); err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+
+		h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Method: "svc"})
+		if h.Status != want {
+			t.Fatalf("%s: status = %s, want %s", expr, h.Status, want)
+		}
+	}
+}
+
+func TestCompositeChecker_SubResults(t *testing.T) {
+	e := newCompositeEngine()
+	if err := e.MakeCompositeChecker("svc", "", "tcp_up AND (http_home OR http_backup)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Method: "svc"})
+	results := h.Data["results"].(map[string]*subResult)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 sub-results, got %v", results)
+	}
+	if r := results["http_home"]; r.Status != "DOWN" || r.Error != "refused" {
+		t.Fatalf("unexpected http_home result: %+v", r)
+	}
+}
+
+func TestCompositeChecker_WorstAndBestOf(t *testing.T) {
+	e := newCompositeEngine()
+	_ = e.MakeCompositeChecker("worst", "worst_of", "", []string{"tcp_up", "grpc_unknown"})
+	_ = e.MakeCompositeChecker("worst_down", "worst_of", "", []string{"tcp_up", "http_home", "grpc_unknown"})
+	_ = e.MakeCompositeChecker("best", "best_of", "", []string{"http_home", "grpc_unknown"})
+
+	want := map[string]string{"worst": "UNKNOWN", "worst_down": "DOWN", "best": "UNKNOWN"}
+	for method, status := range want {
+		h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Method: method})
+		if h.Status != status {
+			t.Fatalf("%s: status = %s, want %s", method, h.Status, status)
+		}
+	}
+}
+
+func TestCompositeChecker_Cycle(t *testing.T) {
+	e := newCompositeEngine()
+	_ = e.MakeCompositeChecker("a", "", "tcp_up AND b", nil)
+	_ = e.MakeCompositeChecker("b", "", "a", nil)
+
+	h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Method: "a"})
+	if h.Status != "DOWN" {
+		t.Fatalf("cycle should evaluate to DOWN, got %s", h.Status)
+	}
+}
+
+func TestParseBoolExpr_Errors(t *testing.T) {
+	for _, expr := range []string{"", "a AND", "(a OR b", "a b", "OR a", "a & b", "a )"} {
+		if _, err := parseBoolExpr(expr); err == nil {
+			t.Fatalf("%q should not parse", expr)
+		}
+	}
+}
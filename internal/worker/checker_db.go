@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// DBOptions configures the database and cache protocol checkers. Secrets are
+// never stored in checkers.yaml; PasswordEnv names the environment variable
+// holding the password and is resolved on every check.
+type DBOptions struct {
+	Username      string
+	PasswordEnv   string
+	Database      string
+	TLS           bool
+	TLSSkipVerify bool
+}
+
+func (o DBOptions) password() string {
+	if o.PasswordEnv == "" {
+		return ""
+	}
+	return os.Getenv(o.PasswordEnv)
+}
+
+func (e *Engine) MakeRedisChecker(name string, opts DBOptions) error {
+	if opts.Database != "" {
+		if _, err := strconv.Atoi(opts.Database); err != nil {
+			return fmt.Errorf("redis checker %s: database must be a number", name)
+		}
+	}
+	e.RegisterChecker(name, newRedisChecker(opts))
+	return nil
+}
+
+func (e *Engine) MakePostgresChecker(name string, opts DBOptions) {
+	e.RegisterChecker(name, newSQLChecker("postgres", postgresDSN(opts), "SHOW server_version"))
+}
+
+func (e *Engine) MakeMySQLChecker(name string, opts DBOptions) {
+	e.RegisterChecker(name, newSQLChecker("mysql", mysqlDSN(opts), "SELECT VERSION()"))
+}
+
+func newRedisChecker(opts DBOptions) CheckerFunc {
+	return func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		client := redis.NewClient(redisOptions(opts, job.Address))
+		defer client.Close()
+
+		start := time.Now()
+		err := client.Ping(ctx).Err()
+		latency := int(time.Since(start) / time.Millisecond)
+		if err != nil {
+			return "DOWN", latency, nil, err
+		}
+
+		data := map[string]interface{}{
+			"query_ms": latency,
+		}
+		if info, err := client.Info(ctx, "server").Result(); err == nil {
+			if v := infoField(info, "redis_version"); v != "" {
+				data["server_version"] = v
+			}
+		}
+
+		return "UP", latency, data, nil
+	}
+}
+
+func redisOptions(opts DBOptions, address string) *redis.Options {
+	db, _ := strconv.Atoi(opts.Database)
+
+	o := &redis.Options{
+		Addr:            address,
+		Username:        opts.Username,
+		Password:        opts.password(),
+		DB:              db,
+		MaxRetries:      -1,
+		PoolSize:        1,
+		DisableIdentity: true,
+	}
+	if opts.TLS {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		o.TLSConfig = &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: opts.TLSSkipVerify,
+		}
+	}
+	return o
+}
+
+func infoField(info, field string) string {
+	for _, line := range strings.Split(info, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), field+":"); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// dsnFunc builds the data source name for one job's address.
+type dsnFunc func(address string, timeout time.Duration) string
+
+func newSQLChecker(driver string, dsn dsnFunc, versionQuery string) CheckerFunc {
+	return func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		timeout := checkTimeout(ctx, job)
+
+		db, err := sql.Open(driver, dsn(job.Address, timeout))
+		if err != nil {
+			return "DOWN", -1, nil, err
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		start := time.Now()
+		if err := db.PingContext(ctx); err != nil {
+			return "DOWN", int(time.Since(start) / time.Millisecond), nil, err
+		}
+		data := map[string]interface{}{
+			"connect_ms": int(time.Since(start) / time.Millisecond),
+		}
+
+		start = time.Now()
+		var one int
+		err = db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+		latency := int(time.Since(start) / time.Millisecond)
+		data["query_ms"] = latency
+		if err != nil {
+			return "DOWN", latency, data, err
+		}
+
+		var version string
+		if err := db.QueryRowContext(ctx, versionQuery).Scan(&version); err == nil {
+			data["server_version"] = version
+		}
+
+		return "UP", latency, data, nil
+	}
+}
+
+func postgresDSN(opts DBOptions) dsnFunc {
+	return func(address string, timeout time.Duration) string {
+		sslmode := "disable"
+		if opts.TLS {
+			sslmode = "verify-full"
+			if opts.TLSSkipVerify {
+				sslmode = "require"
+			}
+		}
+
+		q := url.Values{}
+		q.Set("sslmode", sslmode)
+		q.Set("connect_timeout", strconv.Itoa(int((timeout+time.Second-1)/time.Second)))
+
+		u := url.URL{
+			Scheme:   "postgres",
+			Host:     address,
+			Path:     "/" + opts.Database,
+			RawQuery: q.Encode(),
+		}
+		if opts.Username != "" {
+			u.User = url.UserPassword(opts.Username, opts.password())
+		}
+		return u.String()
+	}
+}
+
+func mysqlDSN(opts DBOptions) dsnFunc {
+	return func(address string, timeout time.Duration) string {
+		cfg := mysql.NewConfig()
+		cfg.User = opts.Username
+		cfg.Passwd = opts.password()
+		cfg.Net = "tcp"
+		cfg.Addr = address
+		cfg.DBName = opts.Database
+		cfg.Timeout = timeout
+		if opts.TLS {
+			cfg.TLSConfig = "true"
+			if opts.TLSSkipVerify {
+				cfg.TLSConfig = "skip-verify"
+			}
+		}
+		return cfg.FormatDSN()
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"regexp"
 	"time"
 
 	"github.com/Rin0913/monitor/internal/scheduler"
@@ -14,7 +15,8 @@ import (
 )
 
 type CheckerConfig struct {
-	Checkers map[string]CheckerEntry `yaml:"checkers"`
+	DefaultTimeoutSec int                     `yaml:"default_timeout_sec"`
+	Checkers          map[string]CheckerEntry `yaml:"checkers"`
 }
 
 type CheckerEntry struct {
@@ -23,6 +25,34 @@ type CheckerEntry struct {
 	Method     string `yaml:"method"`
 	Path       string `yaml:"path"`
 	TimeoutSec int    `yaml:"timeout_sec"`
+
+	// tcp
+	Send           string `yaml:"send"`
+	Expect         string `yaml:"expect"`
+	ReadTimeoutSec int    `yaml:"read_timeout_sec"`
+	TLS            bool   `yaml:"tls"`
+	StartTLS       string `yaml:"starttls"`
+	TLSServerName  string `yaml:"tls_server_name"`
+	TLSSkipVerify  bool   `yaml:"tls_skip_verify"`
+
+	// grpc_health
+	Service string `yaml:"service"`
+
+	// redis, postgres, mysql
+	Username    string `yaml:"username"`
+	PasswordEnv string `yaml:"password_env"`
+	Database    string `yaml:"database"`
+
+	// http_steps
+	Steps []HTTPStep `yaml:"steps"`
+
+	// composite
+	Mode       string   `yaml:"mode"`
+	Expression string   `yaml:"expression"`
+	Checkers   []string `yaml:"checkers"`
+
+	// plugin
+	Concurrency int `yaml:"concurrency"`
 }
 
 func (e *Engine) LoadConfig(path string) error {
@@ -36,17 +66,98 @@ func (e *Engine) LoadConfig(path string) error {
 		return err
 	}
 
+	e.SetDefaultTimeout(time.Duration(cfg.DefaultTimeoutSec) * time.Second)
+
 	for name, entry := range cfg.Checkers {
+		e.SetTimeout(name, time.Duration(entry.TimeoutSec)*time.Second)
+
 		switch entry.Type {
 		case "command":
 			e.MakeCommandChecker(name, entry.Command)
 			log.Printf("Load command `%s`: %s\n", name, entry.Command)
+		case "tcp":
+			opts, err := entry.tcpOptions()
+			if err == nil {
+				err = e.MakeTCPChecker(name, opts)
+			}
+			if err != nil {
+				log.Printf("[WARN] skip checker `%s`: %v\n", name, err)
+				continue
+			}
+			log.Printf("Load tcp checker `%s`\n", name)
+		case "grpc_health":
+			e.MakeGRPCHealthChecker(name, GRPCHealthOptions{
+				Service:       entry.Service,
+				TLS:           entry.TLS,
+				TLSServerName: entry.TLSServerName,
+				TLSSkipVerify: entry.TLSSkipVerify,
+			})
+			log.Printf("Load grpc_health checker `%s`: service=%q\n", name, entry.Service)
+		case "redis":
+			if err := e.MakeRedisChecker(name, entry.dbOptions()); err != nil {
+				log.Printf("[WARN] skip checker `%s`: %v\n", name, err)
+				continue
+			}
+			log.Printf("Load redis checker `%s`\n", name)
+		case "postgres":
+			e.MakePostgresChecker(name, entry.dbOptions())
+			log.Printf("Load postgres checker `%s`\n", name)
+		case "mysql":
+			e.MakeMySQLChecker(name, entry.dbOptions())
+			log.Printf("Load mysql checker `%s`\n", name)
+		case "http_steps":
+			if err := e.MakeHTTPStepsChecker(name, entry.Steps, entry.TLSSkipVerify); err != nil {
+				log.Printf("[WARN] skip checker `%s`: %v\n", name, err)
+				continue
+			}
+			log.Printf("Load http_steps checker `%s`: %d steps\n", name, len(entry.Steps))
+		case "composite":
+			if err := e.MakeCompositeChecker(name, entry.Mode, entry.Expression, entry.Checkers); err != nil {
+				log.Printf("[WARN] skip checker `%s`: %v\n", name, err)
+				continue
+			}
+			log.Printf("Load composite checker `%s`\n", name)
+		case "plugin":
+			if err := e.MakePluginChecker(name, entry.Command, entry.Concurrency); err != nil {
+				log.Printf("[WARN] skip checker `%s`: %v\n", name, err)
+				continue
+			}
+			log.Printf("Load plugin `%s`: %s\n", name, entry.Command)
 		}
 	}
 
 	return nil
 }
 
+func (c CheckerEntry) tcpOptions() (TCPOptions, error) {
+	opts := TCPOptions{
+		Send:          c.Send,
+		ReadTimeout:   time.Duration(c.ReadTimeoutSec) * time.Second,
+		TLS:           c.TLS,
+		StartTLS:      c.StartTLS,
+		TLSServerName: c.TLSServerName,
+		TLSSkipVerify: c.TLSSkipVerify,
+	}
+	if c.Expect != "" {
+		re, err := regexp.Compile(c.Expect)
+		if err != nil {
+			return opts, fmt.Errorf("invalid expect: %w", err)
+		}
+		opts.Expect = re
+	}
+	return opts, nil
+}
+
+func (c CheckerEntry) dbOptions() DBOptions {
+	return DBOptions{
+		Username:      c.Username,
+		PasswordEnv:   c.PasswordEnv,
+		Database:      c.Database,
+		TLS:           c.TLS,
+		TLSSkipVerify: c.TLSSkipVerify,
+	}
+}
+
 func (e *Engine) MakeCommandChecker(name string, command string) {
 	fn := func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
 		start := time.Now()
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+type GRPCHealthOptions struct {
+	Service       string
+	TLS           bool
+	TLSServerName string
+	TLSSkipVerify bool
+}
+
+func (e *Engine) MakeGRPCHealthChecker(name string, opts GRPCHealthOptions) {
+	e.RegisterChecker(name, newGRPCHealthChecker(opts))
+}
+
+func newGRPCHealthChecker(opts GRPCHealthOptions) CheckerFunc {
+	return func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		creds := insecure.NewCredentials()
+		if opts.TLS {
+			creds = credentials.NewTLS(&tls.Config{
+				ServerName:         opts.TLSServerName,
+				InsecureSkipVerify: opts.TLSSkipVerify,
+			})
+		}
+
+		conn, err := grpc.NewClient(job.Address, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return "DOWN", -1, nil, err
+		}
+		defer conn.Close()
+
+		data := map[string]interface{}{
+			"service": opts.Service,
+		}
+
+		start := time.Now()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+			Service: opts.Service,
+		})
+		latency := int(time.Since(start) / time.Millisecond)
+
+		if err != nil {
+			code := status.Code(err)
+			data["grpc_code"] = code.String()
+			if code == codes.NotFound {
+				return "UNKNOWN", latency, data, err
+			}
+			return "DOWN", latency, data, err
+		}
+
+		data["serving_status"] = resp.GetStatus().String()
+
+		switch resp.GetStatus() {
+		case healthpb.HealthCheckResponse_SERVING:
+			return "UP", latency, data, nil
+		case healthpb.HealthCheckResponse_NOT_SERVING:
+			return "DOWN", latency, data, nil
+		default:
+			return "UNKNOWN", latency, data, nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func startHealthServer(t *testing.T) (string, *health.Server) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	hs := health.NewServer()
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	return ln.Addr().String(), hs
+}
+
+func TestGRPCHealthChecker(t *testing.T) {
+	addr, hs := startHealthServer(t)
+	hs.SetServingStatus("orders", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("billing", healthpb.HealthCheckResponse_NOT_SERVING)
+	hs.SetServingStatus("search", healthpb.HealthCheckResponse_UNKNOWN)
+
+	cases := []struct {
+		service string
+		want    string
+		wantErr bool
+	}{
+		{service: "", want: "UP"},
+		{service: "orders", want: "UP"},
+		{service: "billing", want: "DOWN"},
+		{service: "search", want: "UNKNOWN"},
+		{service: "missing", want: "UNKNOWN", wantErr: true},
+	}
+
+	for _, c := range cases {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		fn := newGRPCHealthChecker(GRPCHealthOptions{Service: c.service})
+		status, latency, data, err := fn(ctx, &scheduler.CheckJob{DeviceID: "dev1", Address: addr})
+		cancel()
+
+		if status != c.want {
+			t.Fatalf("service %q: status = %s, want %s (err=%v)", c.service, status, c.want, err)
+		}
+		if (err != nil) != c.wantErr {
+			t.Fatalf("service %q: unexpected err: %v", c.service, err)
+		}
+		if latency < 0 {
+			t.Fatalf("service %q: latency not recorded", c.service)
+		}
+		if data["service"] != c.service {
+			t.Fatalf("service %q: unexpected data: %v", c.service, data)
+		}
+	}
+}
+
+func TestGRPCHealthChecker_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	status, _, _, err := newGRPCHealthChecker(GRPCHealthOptions{})(ctx, &scheduler.CheckJob{DeviceID: "dev1", Address: addr})
+	if status != "DOWN" || err == nil {
+		t.Fatalf("expected DOWN with error, got status=%s err=%v", status, err)
+	}
+}
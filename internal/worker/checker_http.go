@@ -0,0 +1,287 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+const maxStepBodyBytes = 1 << 20
+
+type HTTPStep struct {
+	Name         string                 `yaml:"name"`
+	Method       string                 `yaml:"method"`
+	URL          string                 `yaml:"url"`
+	Headers      map[string]string      `yaml:"headers"`
+	Body         string                 `yaml:"body"`
+	ExpectStatus int                    `yaml:"expect_status"`
+	ExpectBody   string                 `yaml:"expect_body"`
+	Extract      map[string]HTTPExtract `yaml:"extract"`
+}
+
+// HTTPExtract takes a value from a step response into a variable. JSON is a
+// dotted path into the body (e.g. "data.items.0.id").
+type HTTPExtract struct {
+	JSON   string `yaml:"json"`
+	Header string `yaml:"header"`
+}
+
+type httpStep struct {
+	HTTPStep
+	url        *template.Template
+	body       *template.Template
+	headers    map[string]*template.Template
+	expectBody *regexp.Regexp
+}
+
+type stepVars struct {
+	Address string
+	Vars    map[string]string
+}
+
+type stepResult struct {
+	Name       string `json:"name"`
+	StatusCode int    `json:"status_code,omitempty"`
+	DurationMS int    `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+var stepFuncs = template.FuncMap{
+	"env": os.Getenv,
+}
+
+func (e *Engine) MakeHTTPStepsChecker(name string, steps []HTTPStep, skipVerify bool) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("http_steps checker %s: no steps", name)
+	}
+
+	compiled := make([]*httpStep, 0, len(steps))
+	for i, s := range steps {
+		if s.Name == "" {
+			s.Name = "step" + strconv.Itoa(i+1)
+		}
+		c, err := compileStep(s)
+		if err != nil {
+			return fmt.Errorf("http_steps checker %s: step %s: %w", name, s.Name, err)
+		}
+		compiled = append(compiled, c)
+	}
+
+	e.RegisterChecker(name, newHTTPStepsChecker(compiled, skipVerify))
+	return nil
+}
+
+func compileStep(s HTTPStep) (*httpStep, error) {
+	if s.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+
+	c := &httpStep{
+		HTTPStep: s,
+		headers:  make(map[string]*template.Template, len(s.Headers)),
+	}
+	if c.Method == "" {
+		c.Method = http.MethodGet
+	}
+
+	var err error
+	if c.url, err = template.New("url").Funcs(stepFuncs).Parse(s.URL); err != nil {
+		return nil, err
+	}
+	if c.body, err = template.New("body").Funcs(stepFuncs).Parse(s.Body); err != nil {
+		return nil, err
+	}
+	for k, v := range s.Headers {
+		if c.headers[k], err = template.New(k).Funcs(stepFuncs).Parse(v); err != nil {
+			return nil, err
+		}
+	}
+	if s.ExpectBody != "" {
+		if c.expectBody, err = regexp.Compile(s.ExpectBody); err != nil {
+			return nil, err
+		}
+	}
+	for v, ex := range s.Extract {
+		if (ex.JSON == "") == (ex.Header == "") {
+			return nil, fmt.Errorf("extract %s: exactly one of json or header is required", v)
+		}
+	}
+	return c, nil
+}
+
+func newHTTPStepsChecker(steps []*httpStep, skipVerify bool) CheckerFunc {
+	return func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		start := time.Now()
+
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{
+			Jar: jar,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: skipVerify},
+			},
+		}
+		defer client.CloseIdleConnections()
+
+		vars := &stepVars{
+			Address: job.Address,
+			Vars:    make(map[string]string),
+		}
+
+		results := make([]stepResult, 0, len(steps))
+		data := map[string]interface{}{}
+
+		for _, s := range steps {
+			stepStart := time.Now()
+			code, err := s.run(ctx, client, vars)
+			res := stepResult{
+				Name:       s.Name,
+				StatusCode: code,
+				DurationMS: int(time.Since(stepStart) / time.Millisecond),
+			}
+			if err != nil {
+				res.Error = err.Error()
+			}
+			results = append(results, res)
+
+			if err != nil {
+				data["steps"] = results
+				data["failed_step"] = s.Name
+				return "DOWN", int(time.Since(start) / time.Millisecond), data, fmt.Errorf("step %s: %w", s.Name, err)
+			}
+		}
+
+		data["steps"] = results
+		return "UP", int(time.Since(start) / time.Millisecond), data, nil
+	}
+}
+
+func (s *httpStep) run(ctx context.Context, client *http.Client, vars *stepVars) (int, error) {
+	url, err := render(s.url, vars)
+	if err != nil {
+		return 0, err
+	}
+	body, err := render(s.body, vars)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, s.Method, url, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, t := range s.headers {
+		v, err := render(t, vars)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set(k, v)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(res.Body, maxStepBodyBytes))
+	if err != nil {
+		return res.StatusCode, fmt.Errorf("read body: %w", err)
+	}
+
+	if s.ExpectStatus != 0 {
+		if res.StatusCode != s.ExpectStatus {
+			return res.StatusCode, fmt.Errorf("status %d, want %d", res.StatusCode, s.ExpectStatus)
+		}
+	} else if res.StatusCode >= 400 {
+		return res.StatusCode, fmt.Errorf("status %d", res.StatusCode)
+	}
+
+	if s.expectBody != nil && !s.expectBody.Match(respBody) {
+		return res.StatusCode, fmt.Errorf("body does not match %q", s.ExpectBody)
+	}
+
+	for name, ex := range s.Extract {
+		var v string
+		if ex.Header != "" {
+			v = res.Header.Get(ex.Header)
+			if v == "" {
+				return res.StatusCode, fmt.Errorf("extract %s: header %s missing", name, ex.Header)
+			}
+		} else {
+			v, err = jsonPath(respBody, ex.JSON)
+			if err != nil {
+				return res.StatusCode, fmt.Errorf("extract %s: %w", name, err)
+			}
+		}
+		vars.Vars[name] = v
+	}
+
+	return res.StatusCode, nil
+}
+
+func render(t *template.Template, vars *stepVars) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// jsonPath resolves a dotted path such as "data.items.0.id" in a JSON
+// document and returns the value as a string. Numbers are returned as
+// written, so large IDs do not turn into e.g. 1.234567e+06.
+func jsonPath(body []byte, path string) (string, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("invalid json: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return "", fmt.Errorf("invalid json: trailing data")
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return "", fmt.Errorf("path %s: key %q not found", path, key)
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("path %s: invalid index %q", path, key)
+			}
+			v = node[i]
+		default:
+			return "", fmt.Errorf("path %s: cannot descend into %q", path, key)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case nil:
+		return "", fmt.Errorf("path %s: null value", path)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(val)
+		return string(b), nil
+	default:
+		return fmt.Sprint(val), nil
+	}
+}
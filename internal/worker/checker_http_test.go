@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+func newLoginServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		w.Header().Set("X-CSRF-Token", "csrf-1")
+		_, _ = w.Write([]byte(`{"data":{"token":"tok-42","roles":["admin"]}}`))
+	})
+	mux.HandleFunc("GET /me", func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("session")
+		if err != nil || c.Value != "abc" {
+			http.Error(w, "no session", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer tok-42" || r.Header.Get("X-CSRF-Token") != "csrf-1" {
+			http.Error(w, "bad token", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"user":"monitor"}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func runSteps(t *testing.T, steps []HTTPStep, addr string) (string, map[string]interface{}, error) {
+	t.Helper()
+
+	e := NewEngine()
+	if err := e.MakeHTTPStepsChecker("login_flow", steps, false); err != nil {
+		t.Fatalf("make checker: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	status, _, data, err := e.getChecker("login_flow")(ctx, &scheduler.CheckJob{DeviceID: "dev1", Address: addr})
+	return status, data, err
+}
+
+func TestHTTPStepsChecker_LoginFlow(t *testing.T) {
+	ts := newLoginServer()
+	defer ts.Close()
+
+	steps := []HTTPStep{
+		{
+			Name:         "login",
+			Method:       http.MethodPost,
+			URL:          "http://{{.Address}}/login",
+			Body:         `{"user":"monitor"}`,
+			ExpectStatus: http.StatusOK,
+			Extract: map[string]HTTPExtract{
+				"token": {JSON: "data.token"},
+				"role":  {JSON: "data.roles.0"},
+				"csrf":  {Header: "X-CSRF-Token"},
+			},
+		},
+		{
+			Name: "profile",
+			URL:  "http://{{.Address}}/me",
+			Headers: map[string]string{
+				"Authorization": "Bearer {{.Vars.token}}",
+				"X-CSRF-Token":  "{{.Vars.csrf}}",
+			},
+			ExpectBody: `"user":"monitor"`,
+		},
+	}
+
+	status, data, err := runSteps(t, steps, strings.TrimPrefix(ts.URL, "http://"))
+	if status != "UP" || err != nil {
+		t.Fatalf("expected UP, got status=%s err=%v data=%v", status, err, data)
+	}
+
+	results := data["steps"].([]stepResult)
+	if len(results) != 2 || results[1].StatusCode != http.StatusOK {
+		t.Fatalf("unexpected step results: %+v", results)
+	}
+	if _, ok := data["failed_step"]; ok {
+		t.Fatalf("failed_step should not be set: %v", data)
+	}
+}
+
+func TestHTTPStepsChecker_FailingStep(t *testing.T) {
+	ts := newLoginServer()
+	defer ts.Close()
+
+	steps := []HTTPStep{
+		{Name: "login", Method: http.MethodPost, URL: "http://{{.Address}}/login"},
+		{Name: "profile", URL: "http://{{.Address}}/me", ExpectStatus: http.StatusOK},
+		{Name: "never", URL: "http://{{.Address}}/me"},
+	}
+
+	status, data, err := runSteps(t, steps, strings.TrimPrefix(ts.URL, "http://"))
+	if status != "DOWN" || err == nil {
+		t.Fatalf("expected DOWN, got status=%s err=%v", status, err)
+	}
+	if data["failed_step"] != "profile" {
+		t.Fatalf("unexpected failed_step: %v", data["failed_step"])
+	}
+	results := data["steps"].([]stepResult)
+	if len(results) != 2 || results[1].StatusCode != http.StatusForbidden {
+		t.Fatalf("unexpected step results: %+v", results)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	body := []byte(`{"a":{"b":[{"c":1.5},{"c":"x"}],"n":null,"id":1234567,"big":12345678901234567890}}`)
+
+	if v, err := jsonPath(body, "a.b.0.c"); err != nil || v != "1.5" {
+		t.Fatalf("a.b.0.c = %q, %v", v, err)
+	}
+	if v, err := jsonPath(body, "a.b.1.c"); err != nil || v != "x" {
+		t.Fatalf("a.b.1.c = %q, %v", v, err)
+	}
+	if v, err := jsonPath(body, "a.id"); err != nil || v != "1234567" {
+		t.Fatalf("a.id = %q, %v", v, err)
+	}
+	if v, err := jsonPath(body, "a.big"); err != nil || v != "12345678901234567890" {
+		t.Fatalf("a.big = %q, %v", v, err)
+	}
+	if _, err := jsonPath([]byte(`{"a":1} x`), "a"); err == nil {
+		t.Fatal("trailing data should fail")
+	}
+	for _, p := range []string{"a.x", "a.b.5", "a.n", "a.b.0.c.d"} {
+		if _, err := jsonPath(body, p); err == nil {
+			t.Fatalf("%s should fail", p)
+		}
+	}
+}
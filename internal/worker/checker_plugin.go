@@ -0,0 +1,347 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+const (
+	pluginMaxLineBytes    = 1 << 20
+	pluginMinRestartDelay = 1 * time.Second
+	pluginMaxRestartDelay = 30 * time.Second
+	pluginStableRun       = 10 * time.Second
+)
+
+var errPluginExited = errors.New("plugin exited")
+
+// pluginRequest is written to the plugin's stdin as one JSON line per check.
+type pluginRequest struct {
+	ID         string `json:"id"`
+	DeviceID   string `json:"device_id"`
+	Address    string `json:"address"`
+	Method     string `json:"method"`
+	TimeoutSec int    `json:"timeout_sec"`
+}
+
+// pluginResponse is read from the plugin's stdout as one JSON line per check.
+// Responses may arrive in any order; ID ties them to their request.
+type pluginResponse struct {
+	ID        string                 `json:"id"`
+	Status    string                 `json:"status"`
+	LatencyMS int                    `json:"latency_ms"`
+	Data      map[string]interface{} `json:"data"`
+	Metrics   map[string]float64     `json:"metrics"`
+	Error     string                 `json:"error"`
+}
+
+// pluginWrite is a request line for the writer of a plugin process, which
+// reports the result of the write on err.
+type pluginWrite struct {
+	line []byte
+	err  chan error
+}
+
+type pluginProcess struct {
+	name    string
+	command string
+	sem     chan struct{}
+
+	mu        sync.Mutex
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	writes    chan pluginWrite
+	exited    chan struct{}
+	pending   map[string]chan *pluginResponse
+	nextID    uint64
+	startedAt time.Time
+	delay     time.Duration
+	closed    bool
+}
+
+func (e *Engine) MakePluginChecker(name, command string, concurrency int) error {
+	if command == "" {
+		return fmt.Errorf("plugin checker %s: missing command", name)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	p := &pluginProcess{
+		name:    name,
+		command: command,
+		sem:     make(chan struct{}, concurrency),
+		pending: make(map[string]chan *pluginResponse),
+	}
+
+	e.mu.Lock()
+	e.closers = append(e.closers, p)
+	e.mu.Unlock()
+
+	e.RegisterChecker(name, p.check)
+	return nil
+}
+
+func (p *pluginProcess) check(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return "UNKNOWN", -1, nil, fmt.Errorf("plugin %s busy: %w", p.name, ctx.Err())
+	}
+	defer func() { <-p.sem }()
+
+	timeout := int((checkTimeout(ctx, job) + time.Second - 1) / time.Second)
+
+	start := time.Now()
+	res, err := p.call(ctx, pluginRequest{
+		DeviceID:   job.DeviceID,
+		Address:    job.Address,
+		Method:     job.Method,
+		TimeoutSec: timeout,
+	})
+	if err != nil {
+		return "UNKNOWN", int(time.Since(start) / time.Millisecond), nil, err
+	}
+
+	data := res.Data
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	if len(res.Metrics) > 0 {
+		data["metrics"] = res.Metrics
+	}
+
+	latency := res.LatencyMS
+	if latency <= 0 {
+		latency = int(time.Since(start) / time.Millisecond)
+	}
+
+	if res.Error != "" {
+		return res.Status, latency, data, errors.New(res.Error)
+	}
+	return res.Status, latency, data, nil
+}
+
+func (p *pluginProcess) call(ctx context.Context, req pluginRequest) (*pluginResponse, error) {
+	ch := make(chan *pluginResponse, 1)
+
+	p.mu.Lock()
+	if err := p.ensureStartedLocked(); err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.nextID++
+	req.ID = strconv.FormatUint(p.nextID, 10)
+	p.pending[req.ID] = ch
+	writes, exited := p.writes, p.exited
+	p.mu.Unlock()
+
+	// The write happens outside p.mu: a plugin that stops reading its stdin
+	// must not keep readLoop from delivering responses, nor hold callers
+	// past their deadline.
+	line, _ := json.Marshal(req)
+	w := pluginWrite{line: append(line, '\n'), err: make(chan error, 1)}
+	select {
+	case writes <- w:
+	case <-exited:
+		return nil, fmt.Errorf("plugin %s: %w", p.name, errPluginExited)
+	case <-ctx.Done():
+		p.forget(req.ID)
+		return nil, ctx.Err()
+	}
+	select {
+	case err := <-w.err:
+		if err != nil {
+			p.forget(req.ID)
+			return nil, fmt.Errorf("plugin %s: write request: %w", p.name, err)
+		}
+	case <-ctx.Done():
+		p.forget(req.ID)
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-ch:
+		if res == nil {
+			return nil, fmt.Errorf("plugin %s: %w", p.name, errPluginExited)
+		}
+		return res, nil
+	case <-ctx.Done():
+		p.forget(req.ID)
+		return nil, ctx.Err()
+	}
+}
+
+func (p *pluginProcess) forget(id string) {
+	p.mu.Lock()
+	delete(p.pending, id)
+	p.mu.Unlock()
+}
+
+// writeLoop writes the request lines of a plugin process to its stdin, one
+// at a time, until the process exits.
+func (p *pluginProcess) writeLoop(stdin io.Writer, writes <-chan pluginWrite, exited <-chan struct{}) {
+	for {
+		select {
+		case w := <-writes:
+			_, err := stdin.Write(w.line)
+			w.err <- err
+		case <-exited:
+			return
+		}
+	}
+}
+
+// ensureStartedLocked (re)starts the plugin process if it is not running.
+// Restarts after a crash are delayed with exponential backoff so that a
+// broken plugin is not respawned in a tight loop.
+func (p *pluginProcess) ensureStartedLocked() error {
+	if p.closed {
+		return fmt.Errorf("plugin %s: closed", p.name)
+	}
+	if p.cmd != nil {
+		return nil
+	}
+	if !p.startedAt.IsZero() && time.Since(p.startedAt) < p.delay {
+		return fmt.Errorf("plugin %s: restarting", p.name)
+	}
+
+	cmd := exec.Command("sh", "-c", "exec "+p.command)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		p.startedAt = time.Now()
+		p.bumpDelayLocked()
+		return fmt.Errorf("plugin %s: start: %w", p.name, err)
+	}
+
+	log.Printf("[INFO] plugin %s started: pid=%d\n", p.name, cmd.Process.Pid)
+
+	p.cmd = cmd
+	p.stdin = stdin
+	p.writes = make(chan pluginWrite)
+	p.exited = make(chan struct{})
+	p.startedAt = time.Now()
+
+	go p.logStderr(stderr)
+	go p.writeLoop(stdin, p.writes, p.exited)
+	go p.readLoop(cmd, stdout, p.exited)
+	return nil
+}
+
+func (p *pluginProcess) bumpDelayLocked() {
+	if p.delay < pluginMinRestartDelay {
+		p.delay = pluginMinRestartDelay
+	} else if p.delay < pluginMaxRestartDelay {
+		p.delay *= 2
+		if p.delay > pluginMaxRestartDelay {
+			p.delay = pluginMaxRestartDelay
+		}
+	}
+}
+
+func (p *pluginProcess) readLoop(cmd *exec.Cmd, stdout io.Reader, exited chan struct{}) {
+	defer close(exited)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), pluginMaxLineBytes)
+
+	for scanner.Scan() {
+		var res pluginResponse
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			log.Printf("[WARN] plugin %s: invalid response: %v\n", p.name, err)
+			continue
+		}
+
+		p.mu.Lock()
+		ch, ok := p.pending[res.ID]
+		delete(p.pending, res.ID)
+		p.mu.Unlock()
+
+		if ok {
+			ch <- &res
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		// Nothing reads stdout any more, so a plugin writing to it would
+		// block forever and Wait would never return.
+		log.Printf("[WARN] plugin %s: reading responses: %v\n", p.name, err)
+		_ = cmd.Process.Kill()
+	}
+
+	err := cmd.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed {
+		log.Printf("[WARN] plugin %s exited: %v\n", p.name, err)
+	}
+	if time.Since(p.startedAt) >= pluginStableRun {
+		p.delay = 0
+	} else {
+		p.bumpDelayLocked()
+	}
+
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+	p.cmd = nil
+	p.stdin = nil
+	p.writes = nil
+}
+
+func (p *pluginProcess) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Printf("[PLUGIN %s] %s\n", p.name, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("[WARN] plugin %s: reading stderr: %v\n", p.name, err)
+		// keep draining so the plugin never blocks on a full stderr pipe
+		_, _ = io.Copy(io.Discard, stderr)
+	}
+}
+
+// Close stops the plugin process. Closing stdin asks the plugin to exit; it
+// is killed if it does not do so in time.
+func (p *pluginProcess) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	cmd, stdin, exited := p.cmd, p.stdin, p.exited
+	p.mu.Unlock()
+
+	if cmd == nil {
+		return nil
+	}
+	_ = stdin.Close()
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+// TestPluginHelperProcess is not a real test: it is the plugin executable
+// started by the plugin tests.
+func TestPluginHelperProcess(t *testing.T) {
+	if os.Getenv("MONITOR_WANT_PLUGIN_HELPER") != "1" {
+		return
+	}
+
+	var mu sync.Mutex
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req pluginRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			fmt.Fprintln(os.Stderr, "bad request:", err)
+			continue
+		}
+
+		switch req.Address {
+		case "crash":
+			os.Exit(3)
+		case "stall":
+			// stop reading requests for a while
+			time.Sleep(2 * time.Second)
+			mu.Lock()
+			_ = out.Encode(pluginResponse{ID: req.ID, Status: "UP"})
+			mu.Unlock()
+		case "noisy":
+			// a stderr line far longer than the log scanner accepts
+			fmt.Fprintln(os.Stderr, strings.Repeat("x", 2<<20))
+			mu.Lock()
+			_ = out.Encode(pluginResponse{ID: req.ID, Status: "UP"})
+			mu.Unlock()
+		case "huge":
+			// a response line longer than pluginMaxLineBytes
+			mu.Lock()
+			_ = out.Encode(pluginResponse{ID: req.ID, Status: "UP", Error: strings.Repeat("x", 2<<20)})
+			mu.Unlock()
+		case "slow":
+			go func(req pluginRequest) {
+				time.Sleep(300 * time.Millisecond)
+				mu.Lock()
+				_ = out.Encode(pluginResponse{ID: req.ID, Status: "UP", LatencyMS: 300})
+				mu.Unlock()
+			}(req)
+		default:
+			mu.Lock()
+			_ = out.Encode(pluginResponse{
+				ID:        req.ID,
+				Status:    "DOWN",
+				LatencyMS: 7,
+				Data:      map[string]interface{}{"pid": os.Getpid()},
+				Metrics:   map[string]float64{"queue_depth": 12},
+				Error:     "queue stalled",
+			})
+			mu.Unlock()
+		}
+	}
+	os.Exit(0)
+}
+
+func newHelperPlugin(t *testing.T, concurrency int) *Engine {
+	t.Helper()
+	t.Setenv("MONITOR_WANT_PLUGIN_HELPER", "1")
+
+	e := NewEngine()
+	cmd := fmt.Sprintf("%s -test.run=^TestPluginHelperProcess$", os.Args[0])
+	if err := e.MakePluginChecker("plug", cmd, concurrency); err != nil {
+		t.Fatalf("make plugin: %v", err)
+	}
+	t.Cleanup(e.Close)
+	return e
+}
+
+func TestPluginChecker_Result(t *testing.T) {
+	e := newHelperPlugin(t, 1)
+
+	h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Address: "queue", Method: "plug", TimeoutS: 2})
+	if h.Status != "DOWN" || h.Latency != 7 {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+	if h.Data["error"] != "queue stalled" {
+		t.Fatalf("error not recorded: %v", h.Data)
+	}
+	metrics, ok := h.Data["metrics"].(map[string]float64)
+	if !ok || metrics["queue_depth"] != 12 {
+		t.Fatalf("metrics not recorded: %v", h.Data)
+	}
+}
+
+func TestPluginChecker_LongLived(t *testing.T) {
+	e := newHelperPlugin(t, 1)
+
+	job := &scheduler.CheckJob{DeviceID: "dev1", Address: "queue", Method: "plug", TimeoutS: 2}
+	first := e.Handle(context.Background(), job)
+	second := e.Handle(context.Background(), job)
+	if first.Data["pid"] != second.Data["pid"] {
+		t.Fatalf("plugin should not be forked per check: %v != %v", first.Data["pid"], second.Data["pid"])
+	}
+}
+
+func TestPluginChecker_RestartOnCrash(t *testing.T) {
+	e := newHelperPlugin(t, 1)
+
+	h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Address: "crash", Method: "plug", TimeoutS: 2})
+	if h.Status != "UNKNOWN" {
+		t.Fatalf("crash should yield UNKNOWN, got %+v", h)
+	}
+
+	time.Sleep(pluginMinRestartDelay + 100*time.Millisecond)
+
+	h = e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Address: "queue", Method: "plug", TimeoutS: 2})
+	if h.Status != "DOWN" || h.Data["error"] != "queue stalled" {
+		t.Fatalf("plugin not restarted: %+v", h)
+	}
+}
+
+func TestPluginChecker_StalledStdin(t *testing.T) {
+	e := newHelperPlugin(t, 2)
+
+	go e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev0", Address: "stall", Method: "plug", TimeoutS: 5})
+	time.Sleep(300 * time.Millisecond)
+
+	// The request does not fit into the pipe, so it cannot be written
+	// until the plugin reads again. The check still ends at its timeout.
+	start := time.Now()
+	h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Address: strings.Repeat("x", 1<<20), Method: "plug", TimeoutS: 1})
+	if d := time.Since(start); d > 1500*time.Millisecond {
+		t.Fatalf("check took %v despite its 1s timeout", d)
+	}
+	if h.Status != "UNKNOWN" {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+}
+
+func TestPluginChecker_OverlongLines(t *testing.T) {
+	e := newHelperPlugin(t, 1)
+
+	h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Address: "noisy", Method: "plug", TimeoutS: 2})
+	if h.Status != "UP" {
+		t.Fatalf("long stderr line blocked the plugin: %+v", h)
+	}
+
+	h = e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Address: "huge", Method: "plug", TimeoutS: 2})
+	if h.Status != "UNKNOWN" {
+		t.Fatalf("overlong response should yield UNKNOWN, got %+v", h)
+	}
+
+	time.Sleep(pluginMinRestartDelay + 100*time.Millisecond)
+
+	h = e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Address: "queue", Method: "plug", TimeoutS: 2})
+	if h.Status != "DOWN" || h.Data["error"] != "queue stalled" {
+		t.Fatalf("plugin not restarted: %+v", h)
+	}
+}
+
+func TestPluginChecker_Concurrency(t *testing.T) {
+	for _, c := range []struct {
+		concurrency int
+		min, max    time.Duration
+	}{
+		{concurrency: 1, min: 850 * time.Millisecond, max: 5 * time.Second},
+		{concurrency: 3, min: 0, max: 750 * time.Millisecond},
+	} {
+		e := newHelperPlugin(t, c.concurrency)
+
+		// warm up so that process start does not count
+		e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev0", Address: "queue", Method: "plug", TimeoutS: 2})
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Address: "slow", Method: "plug", TimeoutS: 5})
+				if h.Status != "UP" {
+					t.Errorf("unexpected health: %+v", h)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if d := time.Since(start); d < c.min || d > c.max {
+			t.Fatalf("concurrency=%d: took %v, want between %v and %v", c.concurrency, d, c.min, c.max)
+		}
+	}
+}
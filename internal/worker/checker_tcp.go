@@ -0,0 +1,280 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+const maxBannerBytes = 4096
+
+type TCPOptions struct {
+	Send          string
+	Expect        *regexp.Regexp
+	ReadTimeout   time.Duration
+	TLS           bool
+	StartTLS      string
+	TLSServerName string
+	TLSSkipVerify bool
+}
+
+func (e *Engine) MakeTCPChecker(name string, opts TCPOptions) error {
+	switch opts.StartTLS {
+	case "", "smtp", "imap", "pop3":
+	default:
+		return fmt.Errorf("tcp checker %s: unsupported starttls %q", name, opts.StartTLS)
+	}
+	if opts.TLS && opts.StartTLS != "" {
+		return fmt.Errorf("tcp checker %s: tls and starttls are exclusive", name)
+	}
+
+	e.RegisterChecker(name, newTCPChecker(opts))
+	return nil
+}
+
+func newTCPChecker(opts TCPOptions) CheckerFunc {
+	return func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		start := time.Now()
+
+		timeout := checkTimeout(ctx, job)
+
+		dialer := net.Dialer{
+			Timeout: timeout,
+		}
+
+		conn, err := dialer.DialContext(ctx, "tcp", job.Address)
+		if err != nil {
+			return "DOWN", int(time.Since(start) / time.Millisecond), nil, err
+		}
+		defer conn.Close()
+
+		if !opts.probes() {
+			return "UP", int(time.Since(start) / time.Millisecond), nil, nil
+		}
+
+		data := map[string]interface{}{
+			"connect_ms": int(time.Since(start) / time.Millisecond),
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+
+		banner, err := opts.exchange(ctx, conn, job.Address, data)
+		latency := int(time.Since(start) / time.Millisecond)
+		if banner != "" {
+			data["banner"] = banner
+		}
+		if err != nil {
+			return "DOWN", latency, data, err
+		}
+
+		return "UP", latency, data, nil
+	}
+}
+
+func (o TCPOptions) probes() bool {
+	return o.Send != "" || o.Expect != nil || o.TLS || o.StartTLS != ""
+}
+
+// exchange runs the optional TLS upgrade and send/expect dialogue over conn.
+// It returns whatever banner was captured, even when the exchange fails.
+func (o TCPOptions) exchange(ctx context.Context, conn net.Conn, address string, data map[string]interface{}) (string, error) {
+	var banner string
+
+	if o.TLS || o.StartTLS != "" {
+		if o.StartTLS != "" {
+			greeting, err := startTLS(conn, o.StartTLS, o.readDeadline(ctx))
+			banner = greeting
+			if err != nil {
+				return banner, err
+			}
+		}
+
+		tlsConn := tls.Client(conn, o.tlsConfig(address))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return banner, fmt.Errorf("tls handshake: %w", err)
+		}
+		data["tls_version"] = tls.VersionName(tlsConn.ConnectionState().Version)
+		conn = tlsConn
+	}
+
+	if o.Send != "" {
+		if _, err := io.WriteString(conn, o.Send); err != nil {
+			return banner, fmt.Errorf("send: %w", err)
+		}
+	}
+
+	// With STARTTLS and nothing to send, the greeting read before the
+	// upgrade is the banner; there is nothing more to wait for.
+	if o.Send == "" && banner != "" {
+		if o.Expect != nil && !o.Expect.MatchString(banner) {
+			return banner, fmt.Errorf("banner %q does not match %q", banner, o.Expect.String())
+		}
+		return banner, nil
+	}
+
+	if o.Send == "" && o.Expect == nil {
+		return banner, nil
+	}
+
+	return readBanner(conn, o.Expect, o.readDeadline(ctx))
+}
+
+func (o TCPOptions) readDeadline(ctx context.Context) time.Time {
+	var deadline time.Time
+	if o.ReadTimeout > 0 {
+		deadline = time.Now().Add(o.ReadTimeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	return deadline
+}
+
+func (o TCPOptions) tlsConfig(address string) *tls.Config {
+	serverName := o.TLSServerName
+	if serverName == "" {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			serverName = host
+		} else {
+			serverName = address
+		}
+	}
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: o.TLSSkipVerify,
+	}
+}
+
+// readBanner reads from conn until expect matches, the peer closes the
+// connection or the deadline passes. Without expect it returns after the
+// first chunk of data.
+func readBanner(conn net.Conn, expect *regexp.Regexp, deadline time.Time) (string, error) {
+	if !deadline.IsZero() {
+		_ = conn.SetReadDeadline(deadline)
+	}
+
+	var buf bytes.Buffer
+	chunk := make([]byte, 512)
+	for buf.Len() < maxBannerBytes {
+		n, err := conn.Read(chunk)
+		buf.Write(chunk[:n])
+
+		if expect == nil && buf.Len() > 0 {
+			return buf.String(), nil
+		}
+		if expect != nil && expect.Match(buf.Bytes()) {
+			return buf.String(), nil
+		}
+		if err != nil {
+			if expect == nil {
+				return buf.String(), fmt.Errorf("read banner: %w", err)
+			}
+			return buf.String(), fmt.Errorf("banner %q does not match %q: %w", buf.String(), expect.String(), err)
+		}
+	}
+
+	if expect != nil {
+		return buf.String(), fmt.Errorf("banner does not match %q within %d bytes", expect.String(), maxBannerBytes)
+	}
+	return buf.String(), nil
+}
+
+// startTLS performs the plaintext part of a STARTTLS upgrade and returns the
+// server greeting.
+func startTLS(conn net.Conn, proto string, deadline time.Time) (string, error) {
+	if !deadline.IsZero() {
+		_ = conn.SetReadDeadline(deadline)
+	}
+	r := bufio.NewReader(conn)
+
+	switch proto {
+	case "smtp":
+		greeting, err := readSMTPReply(r, "220")
+		if err != nil {
+			return greeting, err
+		}
+		if _, err := io.WriteString(conn, "EHLO monitor\r\n"); err != nil {
+			return greeting, err
+		}
+		if _, err := readSMTPReply(r, "250"); err != nil {
+			return greeting, err
+		}
+		if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+			return greeting, err
+		}
+		_, err = readSMTPReply(r, "220")
+		return greeting, err
+
+	case "imap":
+		greeting, err := r.ReadString('\n')
+		if err != nil {
+			return greeting, fmt.Errorf("read greeting: %w", err)
+		}
+		if _, err := io.WriteString(conn, "a001 STARTTLS\r\n"); err != nil {
+			return greeting, err
+		}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return greeting, fmt.Errorf("starttls: %w", err)
+			}
+			if strings.HasPrefix(line, "a001 ") {
+				if !strings.HasPrefix(line, "a001 OK") {
+					return greeting, fmt.Errorf("starttls rejected: %s", strings.TrimSpace(line))
+				}
+				return greeting, nil
+			}
+		}
+
+	case "pop3":
+		greeting, err := r.ReadString('\n')
+		if err != nil {
+			return greeting, fmt.Errorf("read greeting: %w", err)
+		}
+		if _, err := io.WriteString(conn, "STLS\r\n"); err != nil {
+			return greeting, err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return greeting, fmt.Errorf("starttls: %w", err)
+		}
+		if !strings.HasPrefix(line, "+OK") {
+			return greeting, fmt.Errorf("starttls rejected: %s", strings.TrimSpace(line))
+		}
+		return greeting, nil
+	}
+
+	return "", fmt.Errorf("unsupported starttls %q", proto)
+}
+
+// readSMTPReply reads a possibly multi-line SMTP reply and checks its code.
+func readSMTPReply(r *bufio.Reader, code string) (string, error) {
+	var reply strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		reply.WriteString(line)
+		if err != nil {
+			return reply.String(), fmt.Errorf("read reply: %w", err)
+		}
+		if len(line) < 4 || line[3] != '-' {
+			break
+		}
+	}
+
+	s := reply.String()
+	if !strings.HasPrefix(s, code) {
+		return s, fmt.Errorf("unexpected reply %q, want %s", strings.TrimSpace(s), code)
+	}
+	return s, nil
+}
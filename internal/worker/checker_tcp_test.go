@@ -0,0 +1,176 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+// serveTCP accepts connections on a local listener and hands each one to fn.
+func serveTCP(t *testing.T, fn func(conn net.Conn)) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fn(conn)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func runTCPChecker(t *testing.T, opts TCPOptions, addr string) (string, map[string]interface{}, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	status, _, data, err := newTCPChecker(opts)(ctx, &scheduler.CheckJob{
+		DeviceID: "dev1",
+		Address:  addr,
+		TimeoutS: 2,
+	})
+	return status, data, err
+}
+
+func TestTCPChecker_ExpectBanner(t *testing.T) {
+	addr := serveTCP(t, func(conn net.Conn) {
+		_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	status, data, err := runTCPChecker(t, TCPOptions{Expect: regexp.MustCompile(`^SSH-2\.0-`)}, addr)
+	if err != nil || status != "UP" {
+		t.Fatalf("expected UP, got status=%s err=%v", status, err)
+	}
+	if !strings.HasPrefix(data["banner"].(string), "SSH-2.0-OpenSSH") {
+		t.Fatalf("unexpected banner: %v", data["banner"])
+	}
+}
+
+func TestTCPChecker_BannerMismatch(t *testing.T) {
+	addr := serveTCP(t, func(conn net.Conn) {
+		_, _ = conn.Write([]byte("421 service not available\r\n"))
+	})
+
+	status, data, err := runTCPChecker(t, TCPOptions{Expect: regexp.MustCompile(`^220 `)}, addr)
+	if err == nil || status != "DOWN" {
+		t.Fatalf("expected DOWN, got status=%s err=%v", status, err)
+	}
+	if !strings.HasPrefix(data["banner"].(string), "421") {
+		t.Fatalf("banner should be captured on mismatch: %v", data["banner"])
+	}
+}
+
+func TestTCPChecker_HungService(t *testing.T) {
+	addr := serveTCP(t, func(conn net.Conn) {
+		time.Sleep(time.Second)
+	})
+
+	opts := TCPOptions{
+		Expect:      regexp.MustCompile(`^220 `),
+		ReadTimeout: 100 * time.Millisecond,
+	}
+	start := time.Now()
+	status, _, err := runTCPChecker(t, opts, addr)
+	if err == nil || status != "DOWN" {
+		t.Fatalf("expected DOWN, got status=%s err=%v", status, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("read timeout not honored: %v", time.Since(start))
+	}
+}
+
+func TestTCPChecker_SendExpect(t *testing.T) {
+	addr := serveTCP(t, func(conn net.Conn) {
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		if line == "PING\r\n" {
+			_, _ = conn.Write([]byte("+PONG\r\n"))
+		}
+	})
+
+	opts := TCPOptions{
+		Send:   "PING\r\n",
+		Expect: regexp.MustCompile(`\+PONG`),
+	}
+	status, data, err := runTCPChecker(t, opts, addr)
+	if err != nil || status != "UP" {
+		t.Fatalf("expected UP, got status=%s err=%v", status, err)
+	}
+	if data["banner"] != "+PONG\r\n" {
+		t.Fatalf("unexpected banner: %q", data["banner"])
+	}
+}
+
+func TestTCPChecker_TLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	opts := TCPOptions{
+		TLS:           true,
+		TLSSkipVerify: true,
+		Send:          "HEAD / HTTP/1.0\r\n\r\n",
+		Expect:        regexp.MustCompile(`^HTTP/1\.[01] 200`),
+	}
+	status, data, err := runTCPChecker(t, opts, ts.Listener.Addr().String())
+	if err != nil || status != "UP" {
+		t.Fatalf("expected UP, got status=%s err=%v", status, err)
+	}
+	if data["tls_version"] == nil {
+		t.Fatalf("tls_version not recorded: %v", data)
+	}
+}
+
+func TestTCPChecker_StartTLSSMTP(t *testing.T) {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	cert := ts.TLS.Certificates[0]
+	ts.Close()
+
+	addr := serveTCP(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		_, _ = conn.Write([]byte("220 mx.example.com ESMTP\r\n"))
+		_, _ = r.ReadString('\n')
+		_, _ = conn.Write([]byte("250-mx.example.com\r\n250 STARTTLS\r\n"))
+		_, _ = r.ReadString('\n')
+		_, _ = conn.Write([]byte("220 ready\r\n"))
+
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		_ = tlsConn.Handshake()
+	})
+
+	opts := TCPOptions{
+		StartTLS:      "smtp",
+		TLSSkipVerify: true,
+		Expect:        regexp.MustCompile(`^220 .*ESMTP`),
+	}
+	status, data, err := runTCPChecker(t, opts, addr)
+	if err != nil || status != "UP" {
+		t.Fatalf("expected UP, got status=%s err=%v", status, err)
+	}
+	if data["banner"] != "220 mx.example.com ESMTP\r\n" {
+		t.Fatalf("unexpected banner: %q", data["banner"])
+	}
+}
@@ -2,26 +2,36 @@ package worker
 
 import (
 	"context"
-	"net"
+	"io"
 	"sync"
 	"time"
 
+	"github.com/Rin0913/monitor/internal/clock"
 	"github.com/Rin0913/monitor/internal/health"
 	"github.com/Rin0913/monitor/internal/scheduler"
 )
 
 type CheckerFunc func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error)
 
+const defaultCheckTimeout = 5 * time.Second
+
 type Engine struct {
-	mu       sync.RWMutex
-	checkers map[string]CheckerFunc
+	mu             sync.RWMutex
+	checkers       map[string]CheckerFunc
+	timeouts       map[string]time.Duration
+	defaultTimeout time.Duration
+	closers        []io.Closer
+	clock          clock.Clock
 }
 
 func NewEngine() *Engine {
 	e := &Engine{
-		checkers: make(map[string]CheckerFunc),
+		checkers:       make(map[string]CheckerFunc),
+		timeouts:       make(map[string]time.Duration),
+		defaultTimeout: defaultCheckTimeout,
+		clock:          clock.Real,
 	}
-	e.RegisterChecker("tcp_check", tcpChecker)
+	e.RegisterChecker("tcp_check", newTCPChecker(TCPOptions{}))
 	return e
 }
 
@@ -34,6 +44,90 @@ func (e *Engine) RegisterChecker(method string, fn CheckerFunc) {
 	e.mu.Unlock()
 }
 
+// SetClock makes the engine and the workers using it tell time by c.
+func (e *Engine) SetClock(c clock.Clock) {
+	if c == nil {
+		return
+	}
+	e.mu.Lock()
+	e.clock = c
+	e.mu.Unlock()
+}
+
+// Clock returns the clock of the engine.
+func (e *Engine) Clock() clock.Clock {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.clock
+}
+
+// SetTimeout sets the timeout of a checker method, used for devices that do
+// not set their own.
+func (e *Engine) SetTimeout(method string, d time.Duration) {
+	if method == "" || d <= 0 {
+		return
+	}
+	e.mu.Lock()
+	e.timeouts[method] = d
+	e.mu.Unlock()
+}
+
+// SetDefaultTimeout sets the timeout used when neither the device nor the
+// checker method set one.
+func (e *Engine) SetDefaultTimeout(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	e.mu.Lock()
+	e.defaultTimeout = d
+	e.mu.Unlock()
+}
+
+// resolveTimeout picks the job timeout from the device, then the checker
+// method, then the engine default. Timeouts that are not set on the device
+// are capped at the check interval.
+func (e *Engine) resolveTimeout(job *scheduler.CheckJob) time.Duration {
+	if job.TimeoutS > 0 {
+		return time.Duration(job.TimeoutS) * time.Second
+	}
+
+	e.mu.RLock()
+	timeout, ok := e.timeouts[job.Method]
+	if !ok {
+		timeout = e.defaultTimeout
+	}
+	e.mu.RUnlock()
+
+	if interval := time.Duration(job.IntervalSec) * time.Second; interval > 0 && timeout > interval {
+		timeout = interval
+	}
+	return timeout
+}
+
+// checkTimeout returns how long a checker may take: the time left until the
+// context deadline, or the job timeout when called without one.
+func checkTimeout(ctx context.Context, job *scheduler.CheckJob) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	if job.TimeoutS > 0 {
+		return time.Duration(job.TimeoutS) * time.Second
+	}
+	return defaultCheckTimeout
+}
+
+// Close releases resources held by checkers, such as plugin processes.
+func (e *Engine) Close() {
+	e.mu.Lock()
+	closers := e.closers
+	e.closers = nil
+	e.mu.Unlock()
+
+	for _, c := range closers {
+		_ = c.Close()
+	}
+}
+
 func (e *Engine) getChecker(method string) CheckerFunc {
 	e.mu.RLock()
 	fn := e.checkers[method]
@@ -52,22 +146,25 @@ func (e *Engine) Handle(ctx context.Context, job *scheduler.CheckJob) *health.He
 			DeviceID:  job.DeviceID,
 			Status:    "UNKNOWN_METHOD",
 			Latency:   -1,
-			LastCheck: time.Now(),
+			LastCheck: e.Clock().Now(),
 			Data: map[string]interface{}{
 				"method": job.Method,
 			},
+			RequestID: job.RequestID,
 		}
 	}
 
-	timeout := time.Duration(job.TimeoutS) * time.Second
-	if timeout <= 0 {
-		timeout = 5 * time.Second
-	}
+	timeout := e.resolveTimeout(job)
+
+	// Checkers see the resolved timeout both as the context deadline and
+	// in TimeoutS.
+	resolved := *job
+	resolved.TimeoutS = int((timeout + time.Second - 1) / time.Second)
 
 	jobCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	status, latency, data, err := fn(jobCtx, job)
+	status, latency, data, err := fn(jobCtx, &resolved)
 	if status == "" {
 		if err != nil {
 			status = "DOWN"
@@ -86,29 +183,8 @@ func (e *Engine) Handle(ctx context.Context, job *scheduler.CheckJob) *health.He
 		DeviceID:  job.DeviceID,
 		Status:    status,
 		Latency:   latency,
-		LastCheck: time.Now(),
+		LastCheck: e.Clock().Now(),
 		Data:      data,
+		RequestID: job.RequestID,
 	}
 }
-
-func tcpChecker(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
-	start := time.Now()
-
-	timeout := time.Duration(job.TimeoutS) * time.Second
-	if timeout <= 0 {
-		timeout = 5 * time.Second
-	}
-
-	dialer := net.Dialer{
-		Timeout: timeout,
-	}
-
-	conn, err := dialer.DialContext(ctx, "tcp", job.Address)
-	latency := int(time.Since(start) / time.Millisecond)
-	if err != nil {
-		return "DOWN", latency, nil, err
-	}
-	_ = conn.Close()
-
-	return "UP", latency, nil, nil
-}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rin0913/monitor/internal/clock"
+	"github.com/Rin0913/monitor/internal/scheduler"
+)
+
+func TestEngineHandle_TimeoutResolution(t *testing.T) {
+	e := NewEngine()
+	e.SetDefaultTimeout(7 * time.Second)
+	e.SetTimeout("slow_check", 20*time.Second)
+
+	var got time.Duration
+	var gotTimeoutS int
+	probe := func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		deadline, _ := ctx.Deadline()
+		got = time.Until(deadline).Round(time.Second)
+		gotTimeoutS = job.TimeoutS
+		return "UP", 0, nil, nil
+	}
+	e.RegisterChecker("slow_check", probe)
+	e.RegisterChecker("plain_check", probe)
+
+	cases := []struct {
+		name string
+		job  scheduler.CheckJob
+		want time.Duration
+	}{
+		{"device", scheduler.CheckJob{Method: "slow_check", IntervalSec: 300, TimeoutS: 3}, 3 * time.Second},
+		{"checker", scheduler.CheckJob{Method: "slow_check", IntervalSec: 300}, 20 * time.Second},
+		{"default", scheduler.CheckJob{Method: "plain_check", IntervalSec: 300}, 7 * time.Second},
+		{"capped at interval", scheduler.CheckJob{Method: "slow_check", IntervalSec: 10}, 10 * time.Second},
+	}
+
+	for _, c := range cases {
+		c.job.DeviceID = "dev1"
+		e.Handle(context.Background(), &c.job)
+		if got != c.want {
+			t.Fatalf("%s: timeout = %v, want %v", c.name, got, c.want)
+		}
+		if gotTimeoutS != int(c.want/time.Second) {
+			t.Fatalf("%s: job.TimeoutS = %d, want %d", c.name, gotTimeoutS, int(c.want/time.Second))
+		}
+	}
+}
+
+func TestEngineHandle_StampsCheckTimeFromClock(t *testing.T) {
+	now := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	e := NewEngine()
+	e.SetClock(clock.NewFake(now))
+	e.RegisterChecker("ok", func(ctx context.Context, job *scheduler.CheckJob) (string, int, map[string]interface{}, error) {
+		return "UP", 1, nil, nil
+	})
+
+	for _, method := range []string{"ok", "missing"} {
+		h := e.Handle(context.Background(), &scheduler.CheckJob{DeviceID: "dev1", Method: method})
+		if !h.LastCheck.Equal(now) {
+			t.Fatalf("%s: LastCheck = %v, want %v", method, h.LastCheck, now)
+		}
+	}
+}
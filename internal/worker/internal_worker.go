@@ -6,6 +6,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/Rin0913/monitor/internal/alert"
 	"github.com/Rin0913/monitor/internal/health"
 	"github.com/Rin0913/monitor/internal/scheduler"
 )
@@ -15,14 +16,16 @@ type InternalWorker struct {
 	engine     *Engine
 	scheduler  *scheduler.Scheduler
 	healthRepo health.Repository
+	alerts     *alert.Processor
 }
 
-func NewInternalWorker(name string, engine *Engine, repo health.Repository, s *scheduler.Scheduler) *InternalWorker {
+func NewInternalWorker(name string, engine *Engine, repo health.Repository, s *scheduler.Scheduler, alerts *alert.Processor) *InternalWorker {
 	return &InternalWorker{
 		name:       name,
 		engine:     engine,
 		scheduler:  s,
 		healthRepo: repo,
+		alerts:     alerts,
 	}
 }
 
@@ -49,11 +52,12 @@ func (w *InternalWorker) Run(ctx context.Context) error {
 			}
 
 			log.Printf("[ERROR] %s scheduler.NextJob failed: %v\n", w.name, err)
+			w.engine.Clock().Sleep(1 * time.Second)
 			continue
 		}
 
 		if job == nil {
-			time.Sleep(1 * time.Second)
+			w.engine.Clock().Sleep(1 * time.Second)
 			continue
 		}
 
@@ -67,16 +71,24 @@ func (w *InternalWorker) Run(ctx context.Context) error {
 			continue
 		}
 
-		ttl := time.Duration(job.TimeoutS*3) * time.Second
-
 		h.Runner = w.name
 
-		if err := w.healthRepo.Save(ctx, h, ttl); err != nil {
+		// Alert processing flags the result, so it comes before saving.
+		if w.alerts != nil {
+			if err := w.alerts.Process(ctx, h); err != nil {
+				log.Printf("[ERROR] worker %s failed to process alerts for deviceID=%s: %v\n",
+					w.name, h.DeviceID, err)
+			}
+		}
+
+		if err := w.healthRepo.Save(ctx, h, job.ResultTTL()); err != nil {
 			log.Printf("[ERROR] worker %s failed to save health status for deviceID=%s: %v\n",
 				w.name, job.DeviceID, err)
 			continue
 		}
 
+		w.scheduler.Report(h)
+
 		log.Printf("[INFO] worker %s health updated: deviceID=%s status=%s latency=%dms\n",
 			w.name, h.DeviceID, h.Status, h.Latency)
 	}
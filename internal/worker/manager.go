@@ -6,6 +6,8 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"github.com/Rin0913/monitor/internal/clock"
 )
 
 type Worker interface {
@@ -18,6 +20,7 @@ type Manager struct {
 	factory     Factory
 	num         int
 	backoff     time.Duration
+	clock       clock.Clock
 	ctx         context.Context
 	cancel      context.CancelFunc
 	wg          sync.WaitGroup
@@ -29,6 +32,15 @@ func NewManager(num int, backoff time.Duration, f Factory) *Manager {
 		factory: f,
 		num:     num,
 		backoff: backoff,
+		clock:   clock.Real,
+	}
+}
+
+// SetClock makes the manager wait out the restart backoff by c. It must be
+// called before Start.
+func (m *Manager) SetClock(c clock.Clock) {
+	if c != nil {
+		m.clock = c
 	}
 }
 
@@ -57,7 +69,7 @@ func (m *Manager) runOne(id int) {
 		log.Printf("[WARN] worker %d stopped with error: %v", id, err)
 
 		select {
-		case <-time.After(m.backoff):
+		case <-m.clock.After(m.backoff):
 		case <-m.ctx.Done():
 			return
 		}
@@ -38,18 +38,18 @@ func (w *RemoteWorker) Run(ctx context.Context) error {
 		job, status, err := PollJob(w.serverURL, w.workerID, w.key)
 		if err != nil {
 			log.Printf("[ERROR] %s poll job failed: %v\n", w.name, err)
-			time.Sleep(1 * time.Second)
+			w.engine.Clock().Sleep(1 * time.Second)
 			continue
 		}
 
 		if status == 204 || job == nil {
-			time.Sleep(1 * time.Second)
+			w.engine.Clock().Sleep(1 * time.Second)
 			continue
 		}
 
 		if status != 200 {
 			log.Printf("[WARN] worker %s poll returned status %d\n", w.name, status)
-			time.Sleep(1 * time.Second)
+			w.engine.Clock().Sleep(1 * time.Second)
 			continue
 		}
 
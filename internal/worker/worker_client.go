@@ -73,6 +73,8 @@ func ReportJob(serverURL, key string, h *health.HealthStatus) (int, error) {
 		"status":     h.Status,
 		"latency_ms": h.Latency,
 		"last_check": h.LastCheck,
+		"data":       h.Data,
+		"request_id": h.RequestID,
 	}
 
 	body, _ := json.Marshal(payload)